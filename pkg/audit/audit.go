@@ -0,0 +1,127 @@
+package audit
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/aws/aws-sdk-go/service/iam/iamiface"
+	"github.com/matt-deboer/assert-aws-iam-permissions/pkg/policy"
+	"github.com/matt-deboer/assert-aws-iam-permissions/pkg/types"
+)
+
+// Outcomes of an assertion for a principal
+const (
+	Pass = "PASS"
+	Fail = "FAIL"
+	// Skip marks assertions whose except_principals exclude the principal
+	Skip = "SKIP"
+)
+
+// Row holds the outcome of every assertion of the suite for one principal
+type Row struct {
+	Principal *Principal
+	Outcomes  []string
+	// Failures holds the messages of failed results
+	Failures []string
+}
+
+// Failed reports whether any assertion failed for the principal
+func (r *Row) Failed() bool {
+	return len(r.Failures) > 0
+}
+
+// Matrix is the per-principal pass/fail matrix of an audit
+type Matrix struct {
+	Assertions []*types.Assertion
+	Rows       []*Row
+}
+
+// Run evaluates the assertion suite against each principal's policies, using
+// the policy simulator when iamSvc is provided and the local engine otherwise
+func Run(principals []*Principal, assertions []*types.Assertion, iamSvc iamiface.IAMAPI) (*Matrix, error) {
+	matrix := &Matrix{Assertions: assertions}
+	for _, principal := range principals {
+		row := &Row{Principal: principal}
+		for _, assertion := range assertions {
+			if principal.isExcluded(assertion) {
+				row.Outcomes = append(row.Outcomes, Skip)
+				continue
+			}
+			results, err := policy.EvaluatePolicies(iamSvc, []*types.Assertion{principal.callerOf(assertion)}, principal.Policies)
+			if err != nil {
+				return nil, fmt.Errorf("Failed to evaluate %s; %v", principal.Arn, err)
+			}
+			outcome := Pass
+			for _, result := range results {
+				if !result.Passed {
+					outcome = Fail
+					row.Failures = append(row.Failures, result.Message())
+				}
+			}
+			row.Outcomes = append(row.Outcomes, outcome)
+		}
+		matrix.Rows = append(matrix.Rows, row)
+	}
+	return matrix, nil
+}
+
+func (p *Principal) isExcluded(assertion *types.Assertion) bool {
+	for _, pattern := range assertion.ExceptPrincipals {
+		if policy.MatchWildcard(pattern, p.Arn) {
+			return true
+		}
+	}
+	return false
+}
+
+// callerOf returns the assertion as made by the principal; the simulator
+// only accepts users as callers, so other principals are left unchanged
+func (p *Principal) callerOf(assertion *types.Assertion) *types.Assertion {
+	if p.Type != User || len(assertion.CallerArn) > 0 {
+		return assertion
+	}
+	caller := *assertion
+	caller.CallerArn = p.Arn
+	return &caller
+}
+
+// Failed returns the number of principals which failed any assertion
+func (m *Matrix) Failed() int {
+	failed := 0
+	for _, row := range m.Rows {
+		if row.Failed() {
+			failed++
+		}
+	}
+	return failed
+}
+
+// Write prints the matrix as a table with a column per assertion, followed
+// by a legend of the assertion comments
+func (m *Matrix) Write(w io.Writer) error {
+	table := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	header := []string{"PRINCIPAL", "TYPE"}
+	for i := range m.Assertions {
+		header = append(header, fmt.Sprintf("#%d", i+1))
+	}
+	header = append(header, "RESULT")
+	fmt.Fprintln(table, strings.Join(header, "\t"))
+	for _, row := range m.Rows {
+		result := Pass
+		if row.Failed() {
+			result = Fail
+		}
+		columns := append([]string{row.Principal.Arn, row.Principal.Type}, row.Outcomes...)
+		fmt.Fprintln(table, strings.Join(append(columns, result), "\t"))
+	}
+	if err := table.Flush(); err != nil {
+		return err
+	}
+	fmt.Fprintln(w)
+	for i, assertion := range m.Assertions {
+		fmt.Fprintf(w, "#%d: %s\n", i+1, assertion.Comment)
+	}
+	return nil
+}
@@ -0,0 +1,146 @@
+package audit
+
+import (
+	"bytes"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/matt-deboer/assert-aws-iam-permissions/pkg/types"
+)
+
+const adminPolicy = `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":"*","Resource":"*"}]}`
+
+// testDetails mixes the AWS CLI form (policy documents as objects) with
+// the API form (URL-encoded policy documents)
+var testDetails = `
+{
+	"UserDetailList": [
+		{
+			"UserName": "alice",
+			"Arn": "arn:aws:iam::123456789012:user/alice",
+			"GroupList": ["admins"],
+			"UserPolicyList": [],
+			"AttachedManagedPolicies": []
+		},
+		{
+			"UserName": "bob",
+			"Arn": "arn:aws:iam::123456789012:user/bob",
+			"GroupList": [],
+			"UserPolicyList": [
+				{
+					"PolicyName": "read-only",
+					"PolicyDocument": "` + url.PathEscape(`{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":"s3:Get*","Resource":"*"}]}`) + `"
+				}
+			],
+			"AttachedManagedPolicies": []
+		}
+	],
+	"GroupDetailList": [
+		{
+			"GroupName": "admins",
+			"Arn": "arn:aws:iam::123456789012:group/admins",
+			"GroupPolicyList": [],
+			"AttachedManagedPolicies": [
+				{"PolicyName": "AdministratorAccess", "PolicyArn": "arn:aws:iam::aws:policy/AdministratorAccess"}
+			]
+		}
+	],
+	"RoleDetailList": [
+		{
+			"RoleName": "break-glass",
+			"Arn": "arn:aws:iam::123456789012:role/break-glass",
+			"AssumeRolePolicyDocument": {"Version":"2012-10-17","Statement":[]},
+			"RolePolicyList": [],
+			"AttachedManagedPolicies": [
+				{"PolicyName": "AdministratorAccess", "PolicyArn": "arn:aws:iam::aws:policy/AdministratorAccess"}
+			]
+		}
+	],
+	"Policies": [
+		{
+			"PolicyName": "AdministratorAccess",
+			"Arn": "arn:aws:iam::aws:policy/AdministratorAccess",
+			"DefaultVersionId": "v1",
+			"PolicyVersionList": [
+				{"VersionId": "v1", "IsDefaultVersion": true, "Document": ` + adminPolicy + `}
+			]
+		}
+	]
+}
+`
+
+func TestResolvePrincipals(t *testing.T) {
+	details, err := LoadDetails(strings.NewReader(testDetails))
+	if err != nil {
+		t.Fatal(err)
+	}
+	principals, err := ResolvePrincipals(details)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(principals) != 4 {
+		t.Fatalf("expected 4 principals, but got %d", len(principals))
+	}
+	for _, principal := range principals {
+		if principal.Arn == "arn:aws:iam::123456789012:user/alice" {
+			if len(principal.Policies) != 1 || principal.PolicyNames[0] != "group/admins/arn:aws:iam::aws:policy/AdministratorAccess" {
+				t.Errorf("expected alice to inherit the admins group policy, but got %v", principal.PolicyNames)
+			}
+		}
+		if principal.Arn == "arn:aws:iam::123456789012:user/bob" && !strings.Contains(principal.Policies[0], `"s3:Get*"`) {
+			t.Errorf("expected bob's inline policy to be URL-decoded, but got %s", principal.Policies[0])
+		}
+	}
+}
+
+func TestRun(t *testing.T) {
+	details, err := LoadDetails(strings.NewReader(testDetails))
+	if err != nil {
+		t.Fatal(err)
+	}
+	principals, err := ResolvePrincipals(details)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertions := []*types.Assertion{
+		&types.Assertion{
+			Comment:          "nobody but break-glass can create users",
+			ActionNames:      []string{"iam:CreateUser"},
+			ExpectedResult:   "denied",
+			ExceptPrincipals: []string{"arn:aws:iam::*:role/break-glass"},
+		},
+		&types.Assertion{
+			Comment:        "nobody can delete the audit bucket",
+			ActionNames:    []string{"s3:DeleteBucket"},
+			ResourceArns:   []string{"arn:aws:s3:::audit"},
+			ExpectedResult: "denied",
+		},
+	}
+
+	matrix, err := Run(principals, assertions, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string][]string{
+		"arn:aws:iam::123456789012:group/admins":     {Fail, Fail},
+		"arn:aws:iam::123456789012:role/break-glass": {Skip, Fail},
+		"arn:aws:iam::123456789012:user/alice":       {Fail, Fail},
+		"arn:aws:iam::123456789012:user/bob":         {Pass, Pass},
+	}
+	for _, row := range matrix.Rows {
+		if strings.Join(row.Outcomes, ",") != strings.Join(expected[row.Principal.Arn], ",") {
+			t.Errorf("%s: expected %v, but got %v", row.Principal.Arn, expected[row.Principal.Arn], row.Outcomes)
+		}
+	}
+	if matrix.Failed() != 3 {
+		t.Errorf("expected 3 failed principals, but got %d", matrix.Failed())
+	}
+
+	output := &bytes.Buffer{}
+	matrix.Write(output)
+	if !strings.Contains(output.String(), "arn:aws:iam::123456789012:user/bob          user   PASS  PASS  PASS") {
+		t.Errorf("unexpected matrix:\n%s", output.String())
+	}
+}
@@ -0,0 +1,209 @@
+// Package audit evaluates an assertion suite against every principal in an account
+package audit // import "github.com/matt-deboer/assert-aws-iam-permissions/pkg/audit"
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/aws/aws-sdk-go/service/iam/iamiface"
+)
+
+// Principal types
+const (
+	User  = "user"
+	Group = "group"
+	Role  = "role"
+)
+
+// the keys of the authorization details which hold policy documents
+var documentKeys = map[string]bool{
+	"PolicyDocument":           true,
+	"Document":                 true,
+	"AssumeRolePolicyDocument": true,
+}
+
+// Principal is an IAM user, group or role, along with the identity policies
+// in effect for it
+type Principal struct {
+	Type string
+	Name string
+	Arn  string
+	// PolicyNames names each of the policies, in the same order as Policies
+	PolicyNames []string
+	// Policies holds the decoded policy documents
+	Policies []string
+}
+
+// FetchDetails retrieves the authorization details of every user, group,
+// role and managed policy in the account
+func FetchDetails(iamSvc iamiface.IAMAPI) (*iam.GetAccountAuthorizationDetailsOutput, error) {
+	details := &iam.GetAccountAuthorizationDetailsOutput{}
+	err := iamSvc.GetAccountAuthorizationDetailsPages(&iam.GetAccountAuthorizationDetailsInput{},
+		func(page *iam.GetAccountAuthorizationDetailsOutput, lastPage bool) bool {
+			details.UserDetailList = append(details.UserDetailList, page.UserDetailList...)
+			details.GroupDetailList = append(details.GroupDetailList, page.GroupDetailList...)
+			details.RoleDetailList = append(details.RoleDetailList, page.RoleDetailList...)
+			details.Policies = append(details.Policies, page.Policies...)
+			return true
+		})
+	if err != nil {
+		return nil, err
+	}
+	return details, nil
+}
+
+// LoadDetails reads a saved GetAccountAuthorizationDetails response. Both the
+// API form, where policy documents are URL-encoded strings, and the form
+// written by the AWS CLI, where they are JSON objects, are accepted.
+func LoadDetails(r io.Reader) (*iam.GetAccountAuthorizationDetailsOutput, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	var raw interface{}
+	if err = json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("Failed to parse authorization details; %v", err)
+	}
+	if raw, err = stringifyDocuments(raw); err != nil {
+		return nil, err
+	}
+	if data, err = json.Marshal(raw); err != nil {
+		return nil, err
+	}
+	var details iam.GetAccountAuthorizationDetailsOutput
+	if err = json.Unmarshal(data, &details); err != nil {
+		return nil, fmt.Errorf("Failed to parse authorization details; %v", err)
+	}
+	return &details, nil
+}
+
+// stringifyDocuments replaces policy documents given as JSON objects with
+// their serialized form, matching the string fields of the SDK types
+func stringifyDocuments(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, child := range v {
+			if _, isObject := child.(map[string]interface{}); isObject && documentKeys[key] {
+				document, err := json.Marshal(child)
+				if err != nil {
+					return nil, err
+				}
+				v[key] = string(document)
+				continue
+			}
+			converted, err := stringifyDocuments(child)
+			if err != nil {
+				return nil, err
+			}
+			v[key] = converted
+		}
+	case []interface{}:
+		for i, child := range v {
+			converted, err := stringifyDocuments(child)
+			if err != nil {
+				return nil, err
+			}
+			v[i] = converted
+		}
+	}
+	return value, nil
+}
+
+// decodeDocument returns the JSON of a policy document, URL-decoding it
+// when it is in the form returned by the IAM API
+func decodeDocument(document *string) (string, error) {
+	doc := aws.StringValue(document)
+	if strings.HasPrefix(strings.TrimSpace(doc), "{") {
+		return doc, nil
+	}
+	decoded, err := url.PathUnescape(doc)
+	if err != nil {
+		return "", fmt.Errorf("Failed to decode policy document; %v", err)
+	}
+	return decoded, nil
+}
+
+// ResolvePrincipals determines the inline, attached managed and (for users)
+// group policies of every principal in the authorization details
+func ResolvePrincipals(details *iam.GetAccountAuthorizationDetailsOutput) ([]*Principal, error) {
+	managed := map[string]string{}
+	for _, policy := range details.Policies {
+		for _, version := range policy.PolicyVersionList {
+			if aws.BoolValue(version.IsDefaultVersion) {
+				document, err := decodeDocument(version.Document)
+				if err != nil {
+					return nil, err
+				}
+				managed[aws.StringValue(policy.Arn)] = document
+			}
+		}
+	}
+
+	groups := map[string]*Principal{}
+	principals := []*Principal{}
+	for _, group := range details.GroupDetailList {
+		principal := &Principal{Type: Group, Name: aws.StringValue(group.GroupName), Arn: aws.StringValue(group.Arn)}
+		if err := principal.addPolicies(group.GroupPolicyList, group.AttachedManagedPolicies, managed); err != nil {
+			return nil, err
+		}
+		groups[principal.Name] = principal
+		principals = append(principals, principal)
+	}
+	for _, user := range details.UserDetailList {
+		principal := &Principal{Type: User, Name: aws.StringValue(user.UserName), Arn: aws.StringValue(user.Arn)}
+		if err := principal.addPolicies(user.UserPolicyList, user.AttachedManagedPolicies, managed); err != nil {
+			return nil, err
+		}
+		for _, groupName := range aws.StringValueSlice(user.GroupList) {
+			group, ok := groups[groupName]
+			if !ok {
+				return nil, fmt.Errorf("Group %s of user %s is not present in the authorization details", groupName, principal.Name)
+			}
+			for i, name := range group.PolicyNames {
+				principal.PolicyNames = append(principal.PolicyNames, "group/"+groupName+"/"+name)
+				principal.Policies = append(principal.Policies, group.Policies[i])
+			}
+		}
+		principals = append(principals, principal)
+	}
+	for _, role := range details.RoleDetailList {
+		principal := &Principal{Type: Role, Name: aws.StringValue(role.RoleName), Arn: aws.StringValue(role.Arn)}
+		if err := principal.addPolicies(role.RolePolicyList, role.AttachedManagedPolicies, managed); err != nil {
+			return nil, err
+		}
+		principals = append(principals, principal)
+	}
+
+	sort.SliceStable(principals, func(i, j int) bool {
+		return principals[i].Arn < principals[j].Arn
+	})
+	return principals, nil
+}
+
+func (p *Principal) addPolicies(inline []*iam.PolicyDetail, attached []*iam.AttachedPolicy, managed map[string]string) error {
+	for _, policy := range inline {
+		document, err := decodeDocument(policy.PolicyDocument)
+		if err != nil {
+			return err
+		}
+		p.PolicyNames = append(p.PolicyNames, "inline/"+aws.StringValue(policy.PolicyName))
+		p.Policies = append(p.Policies, document)
+	}
+	for _, policy := range attached {
+		arn := aws.StringValue(policy.PolicyArn)
+		document, ok := managed[arn]
+		if !ok {
+			return fmt.Errorf("Managed policy %s attached to %s is not present in the authorization details", arn, p.Arn)
+		}
+		p.PolicyNames = append(p.PolicyNames, arn)
+		p.Policies = append(p.Policies, document)
+	}
+	return nil
+}
@@ -0,0 +1,221 @@
+// Package cfn extracts the policy documents of the resources of a CloudFormation template
+package cfn // import "github.com/matt-deboer/assert-aws-iam-permissions/pkg/cfn"
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"github.com/matt-deboer/assert-aws-iam-permissions/pkg/tfplan"
+)
+
+// policyProperty is a property of a resource type holding a policy document
+type policyProperty struct {
+	Name string
+	Kind string
+}
+
+// policyProperties are the properties holding policy documents, by resource type
+var policyProperties = map[string][]policyProperty{
+	"AWS::IAM::Policy":        {{"PolicyDocument", tfplan.Identity}},
+	"AWS::IAM::ManagedPolicy": {{"PolicyDocument", tfplan.Identity}},
+	"AWS::IAM::Role":          {{"AssumeRolePolicyDocument", tfplan.Trust}},
+	"AWS::S3::BucketPolicy":   {{"PolicyDocument", tfplan.Resource}},
+	"AWS::SQS::QueuePolicy":   {{"PolicyDocument", tfplan.Resource}},
+	"AWS::SNS::TopicPolicy":   {{"PolicyDocument", tfplan.Resource}},
+	"AWS::KMS::Key":           {{"KeyPolicy", tfplan.Resource}},
+}
+
+// inlinePolicyTypes are the resource types holding a list of named identity
+// policies in their Policies property
+var inlinePolicyTypes = map[string]bool{
+	"AWS::IAM::Role":  true,
+	"AWS::IAM::User":  true,
+	"AWS::IAM::Group": true,
+}
+
+// pseudoParameterDefaults are the pseudo parameters which needn't be supplied
+var pseudoParameterDefaults = map[string]interface{}{
+	"AWS::Partition": "aws",
+	"AWS::URLSuffix": "amazonaws.com",
+}
+
+// Policy is a policy document of a resource in a template
+type Policy struct {
+	// ID locates the policy: the logical ID of its resource, followed by the
+	// name of the policy for the inline policies of roles, users and groups
+	ID   string
+	Type string
+	// Kind is one of the kinds of policy documents of plans, e.g. tfplan.Identity
+	Kind string
+	// Document is the policy document with its intrinsic functions resolved
+	Document string
+	// Err is set when the document could not be resolved
+	Err  error
+	Tags map[string]string
+}
+
+type template struct {
+	Parameters map[string]struct {
+		Type    string
+		Default interface{}
+	}
+	Resources map[string]struct {
+		Type       string
+		Properties map[string]interface{}
+	}
+}
+
+// LoadParameters reads the values of parameters from a JSON or YAML file,
+// holding either a map of names to values, the same map under the key
+// "Parameters" (as in CodePipeline template configuration files) or a list
+// of objects with ParameterKey and ParameterValue (as taken by the AWS CLI).
+// Pseudo parameters (e.g. AWS::AccountId), the Refs of resources (by logical
+// ID) and their attributes (by logical ID and attribute, e.g. Role.Arn) may
+// be given along with the parameters.
+func LoadParameters(path string) (map[string]interface{}, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse parameters file %s; %v", path, err)
+	}
+	parameters := map[string]interface{}{}
+	switch v := doc.(type) {
+	case []interface{}:
+		for _, item := range v {
+			parameter, _ := item.(map[string]interface{})
+			key, ok := parameter["ParameterKey"].(string)
+			if !ok {
+				return nil, fmt.Errorf("Invalid parameters file %s; expected a ParameterKey for each parameter", path)
+			}
+			parameters[key] = parameter["ParameterValue"]
+		}
+	case map[string]interface{}:
+		if nested, ok := v["Parameters"].(map[string]interface{}); ok {
+			v = nested
+		}
+		for key, value := range v {
+			parameters[key] = value
+		}
+	case nil:
+	default:
+		return nil, fmt.Errorf("Invalid parameters file %s; expected a map or list of parameters", path)
+	}
+	return parameters, nil
+}
+
+// Extract returns the policy documents of the resources of a template,
+// written in JSON or YAML, ordered by logical ID. References are resolved
+// from the parameters, the defaults of the template's parameters and the
+// defaults of AWS::Partition and AWS::URLSuffix; a policy whose references
+// can't be resolved is returned with an Err.
+func Extract(data []byte, parameters map[string]interface{}) ([]*Policy, error) {
+	doc, err := parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse template; %v", err)
+	}
+	// round trip the parsed template through JSON, to decode it into a template
+	encoded, err := json.Marshal(doc)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse template; %v", err)
+	}
+	var t template
+	if err = json.Unmarshal(encoded, &t); err != nil || len(t.Resources) == 0 {
+		return nil, fmt.Errorf("Failed to parse template; expected a CloudFormation template with Resources")
+	}
+
+	r := &resolver{values: map[string]interface{}{}}
+	for name, value := range pseudoParameterDefaults {
+		r.values[name] = value
+	}
+	for name, parameter := range t.Parameters {
+		if parameter.Default != nil {
+			r.values[name] = parameterValue(parameter.Type, parameter.Default)
+		}
+	}
+	for name, value := range parameters {
+		r.values[name] = parameterValue(t.Parameters[name].Type, value)
+	}
+
+	ids := []string{}
+	for id := range t.Resources {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	policies := []*Policy{}
+	for _, id := range ids {
+		resource := t.Resources[id]
+		tags := resourceTags(r, resource.Properties["Tags"])
+		for _, property := range policyProperties[resource.Type] {
+			if document, ok := resource.Properties[property.Name]; ok {
+				policy := &Policy{ID: id, Type: resource.Type, Kind: property.Kind, Tags: tags}
+				policy.Document, policy.Err = policyDocument(r, document)
+				policies = append(policies, policy)
+			}
+		}
+		if !inlinePolicyTypes[resource.Type] {
+			continue
+		}
+		inlinePolicies, _ := resource.Properties["Policies"].([]interface{})
+		for i, inline := range inlinePolicies {
+			properties, _ := inline.(map[string]interface{})
+			policy := &Policy{ID: fmt.Sprintf("%s.Policies[%d]", id, i), Type: resource.Type, Kind: tfplan.Identity, Tags: tags}
+			name, err := r.resolve(properties["PolicyName"])
+			if s, ok := name.(string); ok && err == nil {
+				policy.ID = fmt.Sprintf("%s.Policies[%q]", id, s)
+			}
+			policy.Document, policy.Err = policyDocument(r, properties["PolicyDocument"])
+			policies = append(policies, policy)
+		}
+	}
+	return policies, nil
+}
+
+// parameterValue splits the values of list parameters given as a string
+func parameterValue(parameterType string, value interface{}) interface{} {
+	s, ok := value.(string)
+	if ok && (strings.HasPrefix(parameterType, "List<") || parameterType == "CommaDelimitedList") {
+		values := []interface{}{}
+		for _, item := range strings.Split(s, ",") {
+			values = append(values, strings.TrimSpace(item))
+		}
+		return values
+	}
+	return value
+}
+
+// policyDocument resolves a policy document, which may be written either as
+// an object or as a JSON string
+func policyDocument(r *resolver, document interface{}) (string, error) {
+	resolved, err := r.resolve(document)
+	if err != nil {
+		return "", err
+	}
+	if s, ok := resolved.(string); ok {
+		return s, nil
+	}
+	encoded, err := json.Marshal(resolved)
+	return string(encoded), err
+}
+
+func resourceTags(r *resolver, value interface{}) map[string]string {
+	tags := map[string]string{}
+	resolved, err := r.resolve(value)
+	if err != nil {
+		return tags
+	}
+	list, _ := resolved.([]interface{})
+	for _, item := range list {
+		tag, _ := item.(map[string]interface{})
+		key, _ := tag["Key"].(string)
+		if value, ok := tag["Value"].(string); ok && len(key) > 0 {
+			tags[key] = value
+		}
+	}
+	return tags
+}
@@ -0,0 +1,196 @@
+package cfn
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/matt-deboer/assert-aws-iam-permissions/pkg/tfplan"
+)
+
+func TestExtract(t *testing.T) {
+
+	template := `
+AWSTemplateFormatVersion: "2010-09-09"
+Parameters:
+  Stage:
+    Type: String
+    Default: test
+  Buckets:
+    Type: CommaDelimitedList
+Resources:
+  AppRole:
+    Type: AWS::IAM::Role
+    Properties:
+      AssumeRolePolicyDocument:
+        Version: 2012-10-17
+        Statement:
+          - Effect: Allow
+            Principal: {Service: lambda.amazonaws.com}
+            Action: sts:AssumeRole
+      Policies:
+        - PolicyName: !Sub ${Stage}-logs
+          PolicyDocument:
+            Statement:
+              - Effect: Allow
+                Action: logs:PutLogEvents
+                Resource: !Sub arn:${AWS::Partition}:logs:${AWS::Region}:${AWS::AccountId}:log-group:/app/${!aws:username}
+      Tags:
+        - Key: team
+          Value: !Ref Stage
+  AppPolicy:
+    Type: AWS::IAM::ManagedPolicy
+    Properties:
+      PolicyDocument:
+        Statement:
+          - Effect: Allow
+            Action: [s3:GetObject]
+            Resource:
+              - !Join ["", ["arn:aws:s3:::", !Select [1, !Ref Buckets], "/*"]]
+              - !If [IsProd, "arn:aws:s3:::prod/*", !Ref "AWS::NoValue"]
+  Queue:
+    Type: AWS::SQS::Queue
+`
+	parameters := map[string]interface{}{
+		"AWS::Region":    "us-east-1",
+		"AWS::AccountId": "123456789012",
+		"Buckets":        "first, second",
+	}
+	policies, err := Extract([]byte(template), parameters)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(policies) != 3 {
+		t.Fatalf("expected 3 policies, but got %d", len(policies))
+	}
+
+	if p := policies[0]; p.ID != "AppPolicy" || p.Kind != tfplan.Identity || p.Err == nil ||
+		!strings.Contains(p.Err.Error(), "Unsupported intrinsic function Fn::If") {
+		t.Errorf("unexpected policy %#v", p)
+	}
+	expected := `{"Statement":[{"Action":"sts:AssumeRole","Effect":"Allow","Principal":{"Service":"lambda.amazonaws.com"}}],"Version":"2012-10-17"}`
+	if p := policies[1]; p.ID != "AppRole" || p.Kind != tfplan.Trust || p.Err != nil || p.Document != expected {
+		t.Errorf("unexpected policy %#v", p)
+	}
+	expected = `{"Statement":[{"Action":"logs:PutLogEvents","Effect":"Allow",` +
+		`"Resource":"arn:aws:logs:us-east-1:123456789012:log-group:/app/${aws:username}"}]}`
+	if p := policies[2]; p.ID != `AppRole.Policies["test-logs"]` || p.Kind != tfplan.Identity || p.Err != nil || p.Document != expected {
+		t.Errorf("unexpected policy %#v", p)
+	}
+	if tags := policies[2].Tags; !reflect.DeepEqual(tags, map[string]string{"team": "test"}) {
+		t.Errorf("unexpected tags %v", tags)
+	}
+}
+
+func TestExtract_JSON(t *testing.T) {
+
+	template := `{
+  "Resources": {
+    "Policy": {
+      "Type": "AWS::S3::BucketPolicy",
+      "Properties": {
+        "Bucket": "data",
+        "PolicyDocument": {
+          "Statement": [{
+            "Effect": "Allow",
+            "Principal": {"AWS": {"Fn::GetAtt": ["Reader", "Arn"]}},
+            "Action": "s3:GetObject",
+            "Resource": {"Fn::Sub": ["arn:aws:s3:::${Name}/*", {"Name": {"Ref": "Bucket"}}]}
+          }]
+        }
+      }
+    }
+  }
+}`
+	policies, err := Extract([]byte(template), map[string]interface{}{"Reader.Arn": "arn:aws:iam::123456789012:role/reader"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(policies) != 1 || policies[0].Kind != tfplan.Resource {
+		t.Fatalf("unexpected policies %#v", policies)
+	}
+	if err = policies[0].Err; err == nil || err.Error() != "Unresolved reference to Bucket; define it in the parameters file" {
+		t.Errorf("unexpected error %v", err)
+	}
+
+	policies, err = Extract([]byte(template), map[string]interface{}{
+		"Reader.Arn": "arn:aws:iam::123456789012:role/reader",
+		"Bucket":     "data",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"Statement":[{"Action":"s3:GetObject","Effect":"Allow",` +
+		`"Principal":{"AWS":"arn:aws:iam::123456789012:role/reader"},"Resource":"arn:aws:s3:::data/*"}]}`
+	if policies[0].Err != nil || policies[0].Document != expected {
+		t.Errorf("unexpected policy %#v", policies[0])
+	}
+
+	if _, err = Extract([]byte(`{"AWSTemplateFormatVersion": "2010-09-09"}`), nil); err == nil {
+		t.Error("expected an error for a template without resources")
+	}
+}
+
+func TestExtract_AccountNumbers(t *testing.T) {
+
+	template := `
+Parameters:
+  TrustedAccount:
+    Type: String
+    Default: 123456789012
+Resources:
+  Role:
+    Type: AWS::IAM::Role
+    Properties:
+      AssumeRolePolicyDocument:
+        Statement:
+          - Effect: Allow
+            Principal:
+              AWS:
+                - !Sub arn:aws:iam::${TrustedAccount}:role/x
+                - !Join [":", [arn, aws, iam, "", 210987654321, root]]
+            Action: sts:AssumeRole
+`
+	policies, err := Extract([]byte(template), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"Statement":[{"Action":"sts:AssumeRole","Effect":"Allow",` +
+		`"Principal":{"AWS":["arn:aws:iam::123456789012:role/x","arn:aws:iam::210987654321:root"]}}]}`
+	if len(policies) != 1 {
+		t.Fatalf("unexpected policies %#v", policies)
+	}
+	if policies[0].Err != nil || policies[0].Document != expected {
+		t.Errorf("unexpected policy %s; %v", policies[0].Document, policies[0].Err)
+	}
+}
+
+func TestLoadParameters(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "cfn")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	expected := map[string]interface{}{"Stage": "prod", "Count": "2"}
+	for name, content := range map[string]string{
+		"map.yaml":     "Stage: prod\nCount: \"2\"\n",
+		"wrapped.json": `{"Parameters": {"Stage": "prod", "Count": "2"}}`,
+		"list.json":    `[{"ParameterKey": "Stage", "ParameterValue": "prod"}, {"ParameterKey": "Count", "ParameterValue": "2"}]`,
+	} {
+		path := filepath.Join(dir, name)
+		if err = ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		parameters, err := LoadParameters(path)
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+		} else if !reflect.DeepEqual(parameters, expected) {
+			t.Errorf("%s: expected %v, but got %v", name, expected, parameters)
+		}
+	}
+}
@@ -0,0 +1,196 @@
+package cfn
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// noValue is the value of a Ref to AWS::NoValue, which removes the property
+// or list item holding it
+type noValue struct{}
+
+// resolver evaluates intrinsic functions, from values keyed by parameter
+// name, pseudo parameter (e.g. AWS::AccountId), logical ID (the value of a
+// Ref to a resource) or logical ID and attribute (e.g. Role.Arn, for GetAtt)
+type resolver struct {
+	values map[string]interface{}
+}
+
+// resolve returns the value with its intrinsic functions evaluated
+func (r *resolver) resolve(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if len(v) == 1 {
+			for key, argument := range v {
+				if key == "Ref" || strings.HasPrefix(key, "Fn::") {
+					return r.function(key, argument)
+				}
+			}
+		}
+		resolved := map[string]interface{}{}
+		for key, item := range v {
+			item, err := r.resolve(item)
+			if err != nil {
+				return nil, err
+			}
+			if _, remove := item.(noValue); !remove {
+				resolved[key] = item
+			}
+		}
+		return resolved, nil
+	case []interface{}:
+		resolved := []interface{}{}
+		for _, item := range v {
+			item, err := r.resolve(item)
+			if err != nil {
+				return nil, err
+			}
+			if _, remove := item.(noValue); !remove {
+				resolved = append(resolved, item)
+			}
+		}
+		return resolved, nil
+	}
+	return value, nil
+}
+
+func (r *resolver) function(name string, argument interface{}) (interface{}, error) {
+	if name == "Fn::Sub" {
+		// the variables of Fn::Sub are resolved, but not its template string
+		return r.sub(argument)
+	}
+	argument, err := r.resolve(argument)
+	if err != nil {
+		return nil, err
+	}
+	arguments, _ := argument.([]interface{})
+	switch name {
+	case "Ref":
+		ref, ok := argument.(string)
+		if !ok {
+			return nil, fmt.Errorf("Invalid Ref %v; expected a name", argument)
+		}
+		return r.ref(ref)
+	case "Fn::GetAtt":
+		if len(arguments) != 2 {
+			return nil, fmt.Errorf("Invalid Fn::GetAtt %v; expected [LogicalId, Attribute]", argument)
+		}
+		return r.ref(fmt.Sprintf("%v.%v", arguments[0], arguments[1]))
+	case "Fn::Join":
+		if len(arguments) != 2 {
+			return nil, fmt.Errorf("Invalid Fn::Join %v; expected [delimiter, [values...]]", argument)
+		}
+		delimiter, ok := arguments[0].(string)
+		values, isList := arguments[1].([]interface{})
+		if !ok || !isList {
+			return nil, fmt.Errorf("Invalid Fn::Join %v; expected [delimiter, [values...]]", argument)
+		}
+		parts := []string{}
+		for _, value := range values {
+			part, err := stringValue(value)
+			if err != nil {
+				return nil, fmt.Errorf("Invalid Fn::Join; %v", err)
+			}
+			parts = append(parts, part)
+		}
+		return strings.Join(parts, delimiter), nil
+	case "Fn::Select":
+		if len(arguments) != 2 {
+			return nil, fmt.Errorf("Invalid Fn::Select %v; expected [index, [values...]]", argument)
+		}
+		index, err := strconv.Atoi(fmt.Sprint(arguments[0]))
+		values, isList := arguments[1].([]interface{})
+		if err != nil || !isList || index < 0 || index >= len(values) {
+			return nil, fmt.Errorf("Invalid Fn::Select %v; expected [index, [values...]]", argument)
+		}
+		return values[index], nil
+	case "Fn::Split":
+		if len(arguments) != 2 {
+			return nil, fmt.Errorf("Invalid Fn::Split %v; expected [delimiter, string]", argument)
+		}
+		delimiter, ok := arguments[0].(string)
+		s, isString := arguments[1].(string)
+		if !ok || !isString {
+			return nil, fmt.Errorf("Invalid Fn::Split %v; expected [delimiter, string]", argument)
+		}
+		values := []interface{}{}
+		for _, value := range strings.Split(s, delimiter) {
+			values = append(values, value)
+		}
+		return values, nil
+	}
+	return nil, fmt.Errorf("Unsupported intrinsic function %s; only Ref, Fn::Sub, Fn::Join, Fn::GetAtt, "+
+		"Fn::Select and Fn::Split are resolved", name)
+}
+
+var subVariablePattern = regexp.MustCompile(`\$\{([^}]*)\}`)
+
+// sub evaluates Fn::Sub, whose argument is a template string, or a list of a
+// template string and a map of variables
+func (r *resolver) sub(argument interface{}) (interface{}, error) {
+	template, ok := argument.(string)
+	variables := map[string]interface{}{}
+	if arguments, isList := argument.([]interface{}); isList && len(arguments) == 2 {
+		template, ok = arguments[0].(string)
+		resolved, err := r.resolve(arguments[1])
+		if err != nil {
+			return nil, err
+		}
+		if variables, isList = resolved.(map[string]interface{}); !isList {
+			ok = false
+		}
+	}
+	if !ok {
+		return nil, fmt.Errorf("Invalid Fn::Sub %v; expected a string, or [string, {variables...}]", argument)
+	}
+
+	var err error
+	substituted := subVariablePattern.ReplaceAllStringFunc(template, func(match string) string {
+		name := match[2 : len(match)-1]
+		// ${!Literal} is written as ${Literal}, e.g. for IAM policy variables
+		if strings.HasPrefix(name, "!") {
+			return "${" + name[1:] + "}"
+		}
+		value, found := variables[name]
+		if !found {
+			var refErr error
+			if value, refErr = r.ref(name); refErr != nil {
+				err = refErr
+				return match
+			}
+		}
+		s, stringErr := stringValue(value)
+		if stringErr != nil {
+			err = fmt.Errorf("Invalid Fn::Sub variable %s; %v", name, stringErr)
+		}
+		return s
+	})
+	return substituted, err
+}
+
+func (r *resolver) ref(name string) (interface{}, error) {
+	if name == "AWS::NoValue" {
+		return noValue{}, nil
+	}
+	value, ok := r.values[name]
+	if !ok {
+		return nil, fmt.Errorf("Unresolved reference to %s; define it in the parameters file", name)
+	}
+	return value, nil
+}
+
+func stringValue(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case string:
+		return v, nil
+	case float64:
+		// the numbers of a template are float64 once it has been through
+		// JSON, and account IDs mustn't be written in exponent form
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case bool, int, int64, uint64:
+		return fmt.Sprint(v), nil
+	}
+	return "", fmt.Errorf("expected a string, but got %v", value)
+}
@@ -0,0 +1,93 @@
+package cfn
+
+import (
+	"fmt"
+	"strings"
+
+	yaml "gopkg.in/yaml.v3"
+)
+
+// parse parses a JSON or YAML document into maps, slices and scalars,
+// expanding the short forms of intrinsic functions (e.g. !Sub) into their
+// full forms (e.g. {"Fn::Sub": ...})
+func parse(data []byte) (interface{}, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	if len(doc.Content) == 0 {
+		return nil, nil
+	}
+	return convert(doc.Content[0])
+}
+
+func convert(node *yaml.Node) (interface{}, error) {
+	if node.Kind == yaml.AliasNode {
+		return convert(node.Alias)
+	}
+	if strings.HasPrefix(node.Tag, "!") && !strings.HasPrefix(node.Tag, "!!") {
+		return convertShortForm(node)
+	}
+	switch node.Kind {
+	case yaml.MappingNode:
+		m := map[string]interface{}{}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			value, err := convert(node.Content[i+1])
+			if err != nil {
+				return nil, err
+			}
+			m[node.Content[i].Value] = value
+		}
+		return m, nil
+	case yaml.SequenceNode:
+		s := []interface{}{}
+		for _, item := range node.Content {
+			value, err := convert(item)
+			if err != nil {
+				return nil, err
+			}
+			s = append(s, value)
+		}
+		return s, nil
+	}
+	switch node.ShortTag() {
+	case "!!null":
+		return nil, nil
+	case "!!bool", "!!int", "!!float":
+		var value interface{}
+		if err := node.Decode(&value); err != nil {
+			return nil, err
+		}
+		return value, nil
+	}
+	// timestamps, such as an unquoted policy Version, are kept as written
+	return node.Value, nil
+}
+
+// convertShortForm expands a node tagged with the short form of an intrinsic
+// function, e.g. "!GetAtt Role.Arn" into {"Fn::GetAtt": ["Role", "Arn"]}
+func convertShortForm(node *yaml.Node) (interface{}, error) {
+	name := strings.TrimPrefix(node.Tag, "!")
+	untagged := *node
+	untagged.Tag = ""
+	if node.Kind == yaml.ScalarNode {
+		untagged.Tag = "!!str"
+	}
+	value, err := convert(&untagged)
+	if err != nil {
+		return nil, err
+	}
+	switch name {
+	case "Ref", "Condition":
+		return map[string]interface{}{name: value}, nil
+	case "GetAtt":
+		if s, ok := value.(string); ok {
+			parts := strings.SplitN(s, ".", 2)
+			if len(parts) != 2 {
+				return nil, fmt.Errorf("line %d: invalid !GetAtt %s; expected LogicalId.Attribute", node.Line, s)
+			}
+			value = []interface{}{parts[0], parts[1]}
+		}
+	}
+	return map[string]interface{}{"Fn::" + name: value}, nil
+}
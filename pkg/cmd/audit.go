@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/aws/aws-sdk-go/service/iam/iamiface"
+	"github.com/matt-deboer/assert-aws-iam-permissions/pkg/audit"
+	"github.com/matt-deboer/assert-aws-iam-permissions/pkg/policy"
+	"github.com/matt-deboer/assert-aws-iam-permissions/pkg/types"
+	log "github.com/sirupsen/logrus"
+	"github.com/urfave/cli"
+)
+
+func auditCommand(stdin io.Reader, stdout io.Writer) cli.Command {
+	prefix := "AAIP_AUDIT_"
+	return cli.Command{
+		Name:  "audit",
+		Usage: "Evaluate an assertion suite against every user, group and role in an account",
+		Description: `Resolves the inline, attached managed and group policies of each principal from
+   GetAccountAuthorizationDetails (or a saved JSON dump of its response), evaluates the assertion
+   suite against each of them, and prints a per-principal pass/fail matrix. Assertions may list
+   'except_principals' (ARN patterns) to which they don't apply.`,
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name: "assertions",
+				Usage: `A JSON array of assertion statement objects (see the global 'assertions' option);
+				if empty, assertions are read from JSON on stdin (under the key "assertions")`,
+				EnvVar: prefix + "ASSERTIONS",
+			},
+			cli.BoolFlag{
+				Name:   "read-stdin, i",
+				Usage:  "whether to read inputs from stdin",
+				EnvVar: prefix + "READ_STDIN",
+			},
+			cli.StringFlag{
+				Name: "authorization-details",
+				Usage: `A file containing a saved GetAccountAuthorizationDetails response (e.g. the output of
+				'aws iam get-account-authorization-details'); if empty, the details are fetched from the account`,
+				EnvVar: prefix + "AUTHORIZATION_DETAILS",
+			},
+			cli.StringFlag{
+				Name:   "save-authorization-details",
+				Usage:  `A file to which the fetched authorization details are saved, for later audits`,
+				EnvVar: prefix + "SAVE_AUTHORIZATION_DETAILS",
+			},
+			cli.BoolFlag{
+				Name:   "local",
+				Usage:  "Evaluate policies locally, rather than with the AWS policy simulator",
+				EnvVar: prefix + "LOCAL",
+			},
+		},
+		Action: func(c *cli.Context) {
+
+			if c.GlobalBool("verbose") {
+				log.SetLevel(log.DebugLevel)
+			}
+			checkTokenStdin(c, c.Bool("read-stdin"))
+
+			var assertions []*types.Assertion
+			if assertionsString := c.String("assertions"); len(assertionsString) > 0 {
+				err := json.Unmarshal([]byte(assertionsString), &assertions)
+				if err != nil {
+					log.Fatalf("Failed to unmarshal assertions array; %v", err)
+				}
+			}
+			var vars map[string]string
+			if c.Bool("read-stdin") {
+				stdinInputs := parseInput(stdin)
+				if len(stdinInputs.Assertions) > 0 {
+					assertions = stdinInputs.Assertions
+				}
+				vars = stdinInputs.Vars
+			}
+			if err := policy.InterpolateAssertions(assertions, resolveVars(c, vars)); err != nil {
+				log.Fatal(err)
+			}
+			if len(assertions) == 0 {
+				argError(c, "'assertions' is required")
+			}
+
+			local := c.Bool("local")
+			detailsFile := c.String("authorization-details")
+			var iamSvc iamiface.IAMAPI
+			if !local || len(detailsFile) == 0 {
+				iamSvc = newIAM(c)
+			}
+
+			principals, err := loadPrincipals(iamSvc, detailsFile, c.String("save-authorization-details"))
+			if err != nil {
+				log.Fatal(err)
+			}
+			if local {
+				iamSvc = nil
+				assertions = policy.WithContext(assertions, principalTagContext(c))
+			}
+
+			matrix, err := audit.Run(principals, assertions, iamSvc)
+			if err != nil {
+				log.Fatal(err)
+			}
+			matrix.Write(stdout)
+			for _, row := range matrix.Rows {
+				for _, failure := range row.Failures {
+					log.Debugf("%s: %s", row.Principal.Arn, failure)
+				}
+			}
+			if failed := matrix.Failed(); failed > 0 {
+				log.Fatalf("%d of %d principals failed the audit", failed, len(matrix.Rows))
+			}
+		},
+	}
+}
+
+func loadPrincipals(iamSvc iamiface.IAMAPI, detailsFile, saveFile string) ([]*audit.Principal, error) {
+	if len(detailsFile) > 0 {
+		file, err := os.Open(detailsFile)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		details, err := audit.LoadDetails(file)
+		if err != nil {
+			return nil, err
+		}
+		return audit.ResolvePrincipals(details)
+	}
+
+	details, err := audit.FetchDetails(iamSvc)
+	if err != nil {
+		return nil, err
+	}
+	if len(saveFile) > 0 {
+		data, err := json.MarshalIndent(details, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		if err = ioutil.WriteFile(saveFile, data, 0644); err != nil {
+			return nil, err
+		}
+	}
+	return audit.ResolvePrincipals(details)
+}
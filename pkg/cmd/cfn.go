@@ -0,0 +1,87 @@
+package main
+
+import (
+	"io"
+	"io/ioutil"
+
+	"github.com/matt-deboer/assert-aws-iam-permissions/pkg/cfn"
+	log "github.com/sirupsen/logrus"
+	"github.com/urfave/cli"
+)
+
+func cfnCommand(stdin io.Reader, stdout io.Writer) cli.Command {
+	prefix := "AAIP_CFN_"
+	return cli.Command{
+		Name:      "cfn",
+		Usage:     "Run assertion suites against the policies of a CloudFormation template",
+		ArgsUsage: "[template.json | template.yaml | -]",
+		Description: `Reads a CloudFormation template (such as those synthesized by the CDK), in JSON or YAML with the
+   short forms of intrinsic functions, from the named file or stdin, and extracts the policy documents of its
+   resources: identity policies (AWS::IAM::Policy, AWS::IAM::ManagedPolicy and the Policies of AWS::IAM::Role,
+   AWS::IAM::User and AWS::IAM::Group), role trust policies (AssumeRolePolicyDocument) and resource policies
+   (AWS::S3::BucketPolicy, AWS::SQS::QueuePolicy, AWS::SNS::TopicPolicy and the KeyPolicy of AWS::KMS::Key).
+   Ref, Fn::Sub, Fn::Join, Fn::GetAtt, Fn::Select and Fn::Split are resolved from the 'parameters' file and the
+   defaults of the template's parameters. Each policy is evaluated against the suite files of the 'suite' rules
+   matching its logical ID, with the output, reports and exit status of the 'test' command, as for 'tf-plan'.`,
+		Flags: append([]cli.Flag{
+			cli.StringSliceFlag{
+				Name: "suite",
+				Usage: `A rule of the form PATTERN=FILE, evaluating the assertion suite FILE against the policies of the
+				resources matching PATTERN: a logical ID in which '*' matches any characters (e.g. "AppRole*"; the
+				inline policies of a role are addressed as AppRole.Policies["name"]), or a tag of the form
+				tag:Key=Value; may be repeated`,
+				EnvVar: prefix + "SUITE",
+			},
+			cli.StringFlag{
+				Name: "parameters",
+				Usage: `A JSON or YAML file of the values of the template's parameters, as a map of names to values or
+				a list of ParameterKey and ParameterValue objects; pseudo parameters (e.g. AWS::AccountId), the Refs
+				of resources (by logical ID) and their attributes (e.g. AppRole.Arn) may be given too`,
+				EnvVar: prefix + "PARAMETERS",
+			},
+			cli.BoolFlag{
+				Name:   "require-suite",
+				Usage:  "Fail for policies matched by no 'suite' rule, rather than warning of them",
+				EnvVar: prefix + "REQUIRE_SUITE",
+			},
+		}, runFlags(prefix)...),
+		Action: func(c *cli.Context) {
+
+			if c.GlobalBool("verbose") {
+				log.SetLevel(log.DebugLevel)
+			}
+			checkTokenStdin(c, !c.Bool("local") && (len(c.Args().First()) == 0 || c.Args().First() == "-"))
+
+			rules := suiteRules(c)
+			options := runOptions(c)
+			parameters := map[string]interface{}{}
+			if path := c.String("parameters"); len(path) > 0 {
+				var err error
+				if parameters, err = cfn.LoadParameters(path); err != nil {
+					log.Fatal(err)
+				}
+			}
+
+			var data []byte
+			var err error
+			if path := c.Args().First(); len(path) > 0 && path != "-" {
+				data, err = ioutil.ReadFile(path)
+			} else {
+				data, err = ioutil.ReadAll(stdin)
+			}
+			if err != nil {
+				log.Fatalf("Failed to read template; %v", err)
+			}
+			policies, err := cfn.Extract(data, parameters)
+			if err != nil {
+				log.Fatal(err)
+			}
+
+			extracted := []*extractedPolicy{}
+			for _, p := range policies {
+				extracted = append(extracted, &extractedPolicy{Address: p.ID, Kind: p.Kind, Document: p.Document, Tags: p.Tags, Err: p.Err})
+			}
+			writeRun(c, stdout, runPolicies(c, rules, extracted, options))
+		},
+	}
+}
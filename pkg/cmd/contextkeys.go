@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/aws/aws-sdk-go/service/iam/iamiface"
+	"github.com/matt-deboer/assert-aws-iam-permissions/pkg/policy"
+	"github.com/matt-deboer/assert-aws-iam-permissions/pkg/types"
+	log "github.com/sirupsen/logrus"
+	"github.com/urfave/cli"
+)
+
+func contextKeysCommand(stdin io.Reader, stdout io.Writer) cli.Command {
+	prefix := "AAIP_CONTEXT_KEYS_"
+	return cli.Command{
+		Name:  "context-keys",
+		Usage: "List the context keys a policy reads, and lint the context entries of assertions",
+		Description: `Prints every context key referenced by the policy document (using GetContextKeysForCustomPolicy,
+   or a local extraction with --local). When assertions are supplied, warns about assertions for conditioned
+   actions which supply none of the keys the statement tests, and about context entries the policy never reads.`,
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name: "policy-json",
+				Usage: `The full contents of the IAM policy document; if empty, it is read from JSON on stdin
+				(under the key "policy_json")`,
+				EnvVar: prefix + "POLICY_JSON",
+			},
+			cli.StringFlag{
+				Name: "assertions",
+				Usage: `A JSON array of assertion statement objects (see the global 'assertions' option) to lint;
+				if empty, assertions are read from JSON on stdin (under the key "assertions")`,
+				EnvVar: prefix + "ASSERTIONS",
+			},
+			cli.BoolFlag{
+				Name:   "read-stdin, i",
+				Usage:  "whether to read inputs from stdin",
+				EnvVar: prefix + "READ_STDIN",
+			},
+			cli.BoolFlag{
+				Name:   "local",
+				Usage:  "Extract the context keys locally, rather than with GetContextKeysForCustomPolicy",
+				EnvVar: prefix + "LOCAL",
+			},
+		},
+		Action: func(c *cli.Context) {
+
+			if c.GlobalBool("verbose") {
+				log.SetLevel(log.DebugLevel)
+			}
+			checkTokenStdin(c, c.Bool("read-stdin") && !c.Bool("local"))
+
+			policyJSON := c.String("policy-json")
+			var assertions []*types.Assertion
+			var vars map[string]string
+			if assertionsString := c.String("assertions"); len(assertionsString) > 0 {
+				err := json.Unmarshal([]byte(assertionsString), &assertions)
+				if err != nil {
+					log.Fatalf("Failed to unmarshal assertions array; %v", err)
+				}
+			}
+			if c.Bool("read-stdin") {
+				stdinInputs := parseInput(stdin)
+				if len(stdinInputs.Assertions) > 0 {
+					assertions = stdinInputs.Assertions
+				}
+				if len(stdinInputs.PolicyJSON) > 0 {
+					policyJSON = stdinInputs.PolicyJSON
+				}
+				vars = stdinInputs.Vars
+			}
+			inputs := &types.Inputs{PolicyJSON: policyJSON, Assertions: assertions}
+			if err := interpolateInputs(inputs, resolveVars(c, vars)); err != nil {
+				log.Fatal(err)
+			}
+			policyJSON = inputs.PolicyJSON
+			if len(policyJSON) == 0 {
+				argError(c, "'policy-json' is required")
+			}
+
+			var iamSvc iamiface.IAMAPI
+			if !c.Bool("local") {
+				iamSvc = newIAM(c)
+			}
+			keys, err := policy.PolicyContextKeys(iamSvc, []string{policyJSON})
+			if err != nil {
+				log.Fatal(err)
+			}
+			for _, key := range keys {
+				fmt.Fprintln(stdout, key)
+			}
+
+			warnings, err := policy.LintAssertions(assertions, []string{policyJSON})
+			if err != nil {
+				log.Fatal(err)
+			}
+			for _, warning := range warnings {
+				log.Warn(warning)
+			}
+		},
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+
+	"github.com/aws/aws-sdk-go/service/iam/iamiface"
+	"github.com/matt-deboer/assert-aws-iam-permissions/pkg/drift"
+	"github.com/matt-deboer/assert-aws-iam-permissions/pkg/policy"
+	log "github.com/sirupsen/logrus"
+	"github.com/urfave/cli"
+)
+
+func driftCommand(stdin io.Reader, stdout io.Writer) cli.Command {
+	prefix := "AAIP_DRIFT_"
+	return cli.Command{
+		Name:  "drift",
+		Usage: "Compare deployed managed policies with their expected documents",
+		Description: `Fetches the default version of each managed policy, compares it semantically with the expected
+   policy document, and re-runs the assertions against both; differences in the documents and any assertion
+   whose outcome changed are reported, and the command fails if any policy has drifted.`,
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:   "policy-arn",
+				Usage:  `The ARN of the deployed managed policy`,
+				EnvVar: prefix + "POLICY_ARN",
+			},
+			cli.StringFlag{
+				Name: "policy-json",
+				Usage: `The expected contents of the policy document; if empty, it is read from JSON on stdin
+				(under the key "policy_json")`,
+				EnvVar: prefix + "POLICY_JSON",
+			},
+			cli.StringFlag{
+				Name: "assertions",
+				Usage: `A JSON array of assertion statement objects (see the global 'assertions' option);
+				if empty, assertions are read from JSON on stdin (under the key "assertions")`,
+				EnvVar: prefix + "ASSERTIONS",
+			},
+			cli.StringFlag{
+				Name: "policies-file",
+				Usage: `A file containing a JSON array of policies to check, in place of 'policy-arn', each of the form
+				{"policy_arn": "arn:aws:iam::...", "policy_json": "...", "assertions": [...]}`,
+				EnvVar: prefix + "POLICIES_FILE",
+			},
+			cli.BoolFlag{
+				Name:   "read-stdin, i",
+				Usage:  "whether to read inputs from stdin",
+				EnvVar: prefix + "READ_STDIN",
+			},
+			cli.BoolFlag{
+				Name:   "local",
+				Usage:  "Evaluate assertions locally, rather than with the AWS policy simulator",
+				EnvVar: prefix + "LOCAL",
+			},
+		},
+		Action: func(c *cli.Context) {
+
+			if c.GlobalBool("verbose") {
+				log.SetLevel(log.DebugLevel)
+			}
+			checkTokenStdin(c, c.Bool("read-stdin"))
+
+			var targets []*drift.Target
+			var vars map[string]string
+			if policiesFile := c.String("policies-file"); len(policiesFile) > 0 {
+				file, err := os.Open(policiesFile)
+				if err != nil {
+					log.Fatal(err)
+				}
+				targets, err = drift.LoadTargets(file)
+				file.Close()
+				if err != nil {
+					log.Fatal(err)
+				}
+			} else {
+				target := &drift.Target{PolicyArn: c.String("policy-arn"), PolicyJSON: c.String("policy-json")}
+				if assertionsString := c.String("assertions"); len(assertionsString) > 0 {
+					err := json.Unmarshal([]byte(assertionsString), &target.Assertions)
+					if err != nil {
+						log.Fatalf("Failed to unmarshal assertions array; %v", err)
+					}
+				}
+				if c.Bool("read-stdin") {
+					stdinInputs := parseInput(stdin)
+					if len(stdinInputs.Assertions) > 0 {
+						target.Assertions = stdinInputs.Assertions
+					}
+					if len(stdinInputs.PolicyJSON) > 0 {
+						target.PolicyJSON = stdinInputs.PolicyJSON
+					}
+					vars = stdinInputs.Vars
+				}
+				targets = []*drift.Target{target}
+			}
+			vars = resolveVars(c, vars)
+			for _, target := range targets {
+				if err := interpolateTarget(target, vars); err != nil {
+					log.Fatal(err)
+				}
+				if len(target.PolicyArn) == 0 {
+					argError(c, "'policy-arn' is required")
+				}
+				if len(target.PolicyJSON) == 0 {
+					argError(c, "'policy-json' is required for %s", target.PolicyArn)
+				}
+			}
+
+			iamSvc := newIAM(c)
+			var evalSvc iamiface.IAMAPI = iamSvc
+			if c.Bool("local") {
+				evalSvc = nil
+				for _, target := range targets {
+					target.Assertions = policy.WithContext(target.Assertions, principalTagContext(c))
+				}
+			}
+
+			drifted := 0
+			for _, target := range targets {
+				report, err := drift.Check(iamSvc, target, evalSvc)
+				if err != nil {
+					log.Fatal(err)
+				}
+				report.Write(stdout)
+				if report.Drifted() {
+					drifted++
+				}
+			}
+			if drifted > 0 {
+				log.Fatalf("%d of %d policies have drifted", drifted, len(targets))
+			}
+		},
+	}
+}
+
+// interpolateTarget replaces the {{name}} variables in the policy ARN,
+// expected document and assertions of a drift target
+func interpolateTarget(target *drift.Target, vars map[string]string) (err error) {
+	if target.PolicyArn, err = policy.Interpolate(target.PolicyArn, vars); err != nil {
+		return err
+	}
+	if target.PolicyJSON, err = policy.Interpolate(target.PolicyJSON, vars); err != nil {
+		return err
+	}
+	return policy.InterpolateAssertions(target.Assertions, vars)
+}
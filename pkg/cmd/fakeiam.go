@@ -0,0 +1,71 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/matt-deboer/assert-aws-iam-permissions/pkg/audit"
+	"github.com/matt-deboer/assert-aws-iam-permissions/pkg/fakeiam"
+	log "github.com/sirupsen/logrus"
+	"github.com/urfave/cli"
+)
+
+func fakeIAMCommand() cli.Command {
+	prefix := "AAIP_FAKE_IAM_"
+	return cli.Command{
+		Name:  "fake-iam",
+		Usage: "Serve a stand-in for the IAM API, for testing without AWS",
+		Description: `Answers the SimulateCustomPolicy, SimulatePrincipalPolicy, GetContextKeysForCustomPolicy,
+   GetContextKeysForPrincipalPolicy, GetPolicy, GetPolicyVersion and GetAccountAuthorizationDetails operations
+   in the IAM Query protocol, so that the unmodified AWS SDK client can be pointed at it (with the global
+   'iam-endpoint' option, or the endpoint option of other tools). Simulations are evaluated by the local
+   engine, and the principals and managed policies of the account are those of the saved authorization
+   details. Request signatures aren't checked, so any credentials may be used.`,
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:   "listen",
+				Usage:  "The address on which to listen",
+				Value:  "127.0.0.1:9091",
+				EnvVar: prefix + "LISTEN",
+			},
+			cli.StringFlag{
+				Name: "authorization-details",
+				Usage: `A file containing a saved GetAccountAuthorizationDetails response (e.g. the output of
+				'aws iam get-account-authorization-details'), holding the users, groups, roles and managed policies
+				of the account; if empty, the account has none`,
+				EnvVar: prefix + "AUTHORIZATION_DETAILS",
+			},
+		},
+		Action: func(c *cli.Context) {
+
+			if c.GlobalBool("verbose") {
+				log.SetLevel(log.DebugLevel)
+			}
+
+			var details *iam.GetAccountAuthorizationDetailsOutput
+			if detailsFile := c.String("authorization-details"); len(detailsFile) > 0 {
+				file, err := os.Open(detailsFile)
+				if err != nil {
+					log.Fatal(err)
+				}
+				details, err = audit.LoadDetails(file)
+				file.Close()
+				if err != nil {
+					log.Fatal(err)
+				}
+			}
+			handler, err := fakeiam.New(details)
+			if err != nil {
+				log.Fatal(err)
+			}
+			listenAndServe(&http.Server{
+				Addr:         c.String("listen"),
+				Handler:      handler,
+				ReadTimeout:  30 * time.Second,
+				WriteTimeout: 30 * time.Second,
+			})
+		},
+	}
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/aws/aws-sdk-go/service/iam/iamiface"
+	"github.com/matt-deboer/assert-aws-iam-permissions/pkg/policy"
+	"github.com/matt-deboer/assert-aws-iam-permissions/pkg/types"
+	log "github.com/sirupsen/logrus"
+	"github.com/urfave/cli"
+)
+
+// newSimulatorIAM creates the IAM client with which assertions are evaluated
+// by the policy simulator; with the 'record' flag, the responses of the
+// simulator are recorded to a cassette directory, and with the 'replay' flag,
+// they're answered from one, without calling AWS
+func newSimulatorIAM(c *cli.Context) iamiface.IAMAPI {
+	record, replay := c.GlobalString("record"), c.GlobalString("replay")
+	if len(record) > 0 && len(replay) > 0 {
+		argError(c, "'record' cannot be combined with 'replay'")
+	}
+	if len(replay) > 0 {
+		recording, err := policy.LoadRecording(replay)
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Debugf("Replaying %d simulations from %s", len(recording.Interactions()), replay)
+		return policy.NewReplayer(recording)
+	}
+	iamSvc := newIAM(c)
+	if len(record) > 0 {
+		recorder, err := policy.NewRecorder(iamSvc, record)
+		if err != nil {
+			log.Fatal(err)
+		}
+		return recorder
+	}
+	return iamSvc
+}
+
+// credentialFlags are the global flags configuring the session and
+// credentials of AWS API calls
+func credentialFlags(prefix string) []cli.Flag {
+	return []cli.Flag{
+		cli.StringFlag{
+			Name: "profile",
+			Usage: `The shared config profile whose credentials and region are used for AWS API calls; by default,
+			that of AWS_PROFILE (or 'default')`,
+			EnvVar: prefix + "PROFILE",
+		},
+		cli.StringFlag{
+			Name:   "region",
+			Usage:  `The region of the AWS session, overriding that of the environment or profile`,
+			EnvVar: prefix + "REGION",
+		},
+		cli.StringFlag{
+			Name: "iam-endpoint",
+			Usage: `The URL to which IAM API calls are sent, in place of the IAM API; for example, that of a
+			'fake-iam' server, for testing without AWS`,
+			EnvVar: prefix + "IAM_ENDPOINT",
+		},
+		cli.StringFlag{
+			Name: "sts-endpoint",
+			Usage: `The URL to which the STS calls assuming 'assume-role-arn' are sent, such as a regional endpoint
+			(e.g. https://sts.eu-west-1.amazonaws.com)`,
+			EnvVar: prefix + "STS_ENDPOINT",
+		},
+		cli.StringFlag{
+			Name:   "assume-role-arn",
+			Usage:  `The ARN of the role to assume when making AWS API calls`,
+			EnvVar: prefix + "ASSUME_ROLE_ARN",
+		},
+		cli.StringFlag{
+			Name:   "external-id",
+			Usage:  `The external ID required by the trust policy of 'assume-role-arn'`,
+			EnvVar: prefix + "EXTERNAL_ID",
+		},
+		cli.StringFlag{
+			Name: "role-session-name",
+			Usage: `The session name of the assumed role, as seen in CloudTrail; by default, one is generated
+			(assert-aws-iam-permissions-<time>)`,
+			EnvVar: prefix + "ROLE_SESSION_NAME",
+		},
+		cli.DurationFlag{
+			Name: "role-duration",
+			Usage: `The duration of the assumed role's session (e.g. 1h), between 15m and 12h; if unset (0s), it is
+			15m, or 1h with 'web-identity-token-file'`,
+			EnvVar: prefix + "ROLE_DURATION",
+		},
+		cli.StringFlag{
+			Name: "mfa-serial",
+			Usage: `The serial number (or ARN) of the MFA device required to assume 'assume-role-arn'; its token
+			code is read from stdin, which therefore can't hold other inputs`,
+			EnvVar: prefix + "MFA_SERIAL",
+		},
+		cli.StringFlag{
+			Name: "web-identity-token-file",
+			Usage: `A file holding an OIDC token (such as that of a CI job) with which 'assume-role-arn' is assumed,
+			using AssumeRoleWithWebIdentity rather than the credentials of the environment`,
+			EnvVar: prefix + "WEB_IDENTITY_TOKEN_FILE",
+		},
+		cli.StringSliceFlag{
+			Name: "role-chain",
+			Usage: `A role assumed in a chain, each with the credentials of the one before it, of the form
+			ARN[;external-id=ID][;tag:KEY=VALUE][;transitive-tag:KEY=VALUE]...; may be repeated, in order. The
+			session tags of the last role (its own, and the transitive tags of those before it) are given to
+			every assertion evaluated locally as aws:PrincipalTag/KEY context entries`,
+			EnvVar: prefix + "ROLE_CHAIN",
+		},
+	}
+}
+
+// roleSessionNamePattern matches the session names accepted by STS
+var roleSessionNamePattern = regexp.MustCompile(`^[\w+=,.@-]{2,64}$`)
+
+// validateCredentialFlags rejects combinations of the credential flags
+// which can't be used, before any command runs
+func validateCredentialFlags(c *cli.Context) {
+	chained := len(roleChain(c)) > 0
+	if chained {
+		for _, name := range []string{"assume-role-arn", "external-id", "mfa-serial", "web-identity-token-file"} {
+			if len(c.GlobalString(name)) > 0 {
+				argError(c, "'role-chain' cannot be combined with '%s'", name)
+			}
+		}
+		if duration := c.GlobalDuration("role-duration"); duration != 0 &&
+			(duration < policy.MinRoleDuration || duration > policy.MaxChainedRoleDuration) {
+			argError(c, "'role-duration' must be between %v and %v with 'role-chain'",
+				policy.MinRoleDuration, policy.MaxChainedRoleDuration)
+		}
+	} else if len(c.GlobalString("assume-role-arn")) == 0 {
+		for _, name := range []string{"external-id", "mfa-serial", "web-identity-token-file"} {
+			if len(c.GlobalString(name)) > 0 {
+				argError(c, "'%s' requires 'assume-role-arn'", name)
+			}
+		}
+		if len(c.GlobalString("role-session-name")) > 0 {
+			argError(c, "'role-session-name' requires 'assume-role-arn' or 'role-chain'")
+		}
+		if c.GlobalDuration("role-duration") != 0 {
+			argError(c, "'role-duration' requires 'assume-role-arn' or 'role-chain'")
+		}
+		return
+	} else if duration := c.GlobalDuration("role-duration"); duration != 0 &&
+		(duration < policy.MinRoleDuration || duration > policy.MaxRoleDuration) {
+		argError(c, "'role-duration' must be between %v and %v", policy.MinRoleDuration, policy.MaxRoleDuration)
+	}
+	if name := c.GlobalString("role-session-name"); len(name) > 0 && !roleSessionNamePattern.MatchString(name) {
+		argError(c, "'role-session-name' must be 2 to 64 letters, digits or any of _+=,.@-")
+	}
+	if tokenFile := c.GlobalString("web-identity-token-file"); len(tokenFile) > 0 {
+		for _, name := range []string{"profile", "external-id", "mfa-serial"} {
+			if len(c.GlobalString(name)) > 0 {
+				argError(c, "'web-identity-token-file' cannot be combined with '%s'", name)
+			}
+		}
+		if _, err := os.Stat(tokenFile); err != nil {
+			argError(c, "Invalid 'web-identity-token-file'; %v", err)
+		}
+	}
+}
+
+// roleChain parses the roles of the 'role-chain' flag, checking that their
+// session tags can be passed along the chain
+func roleChain(c *cli.Context) []*policy.RoleHop {
+	chain := []*policy.RoleHop{}
+	for _, spec := range c.GlobalStringSlice("role-chain") {
+		hop, err := policy.ParseRoleHop(spec)
+		if err != nil {
+			argError(c, "Invalid 'role-chain'; %v", err)
+		}
+		chain = append(chain, hop)
+	}
+	if _, err := policy.PrincipalTags(chain); err != nil {
+		argError(c, "Invalid 'role-chain'; %v", err)
+	}
+	return chain
+}
+
+// principalTagContext returns the aws:PrincipalTag context entries of the
+// session tags of the 'role-chain' flag's last role, which are given to the
+// assertions evaluated locally, as they would be by the session's requests
+func principalTagContext(c *cli.Context) map[string]*types.ContextEntryValue {
+	tags, _ := policy.PrincipalTags(roleChain(c))
+	return policy.PrincipalTagContext(tags)
+}
+
+// checkTokenStdin rejects 'mfa-serial' when stdin is read for other inputs,
+// since the MFA token code is read from it
+func checkTokenStdin(c *cli.Context, readsStdin bool) {
+	if readsStdin && len(c.GlobalString("mfa-serial")) > 0 {
+		argError(c, "'mfa-serial' reads the MFA token code from stdin, so can't be combined with inputs read from stdin")
+	}
+}
+
+// tokenProvider returns a provider of MFA token codes, prompting for them on
+// stderr and reading them from stdin
+func tokenProvider(c *cli.Context) func() (string, error) {
+	stdin, _ := c.App.Metadata["stdin"].(io.Reader)
+	return func() (string, error) {
+		if serial := c.GlobalString("mfa-serial"); len(serial) > 0 {
+			fmt.Fprintf(os.Stderr, "MFA token code for %s: ", serial)
+		} else {
+			fmt.Fprint(os.Stderr, "MFA token code: ")
+		}
+		line, err := bufio.NewReader(stdin).ReadString('\n')
+		if code := strings.TrimSpace(line); len(code) > 0 {
+			return code, nil
+		}
+		return "", fmt.Errorf("Failed to read the MFA token code from stdin; %v", err)
+	}
+}
+
+// newIAM creates an IAM client from the global flags
+func newIAM(c *cli.Context) *iam.IAM {
+	iamSvc, err := policy.NewIAM(&policy.IAMOptions{
+		Profile:              c.GlobalString("profile"),
+		Region:               c.GlobalString("region"),
+		Endpoint:             c.GlobalString("iam-endpoint"),
+		STSEndpoint:          c.GlobalString("sts-endpoint"),
+		AssumeRoleARN:        c.GlobalString("assume-role-arn"),
+		ExternalID:           c.GlobalString("external-id"),
+		RoleSessionName:      c.GlobalString("role-session-name"),
+		Duration:             c.GlobalDuration("role-duration"),
+		MFASerial:            c.GlobalString("mfa-serial"),
+		TokenProvider:        tokenProvider(c),
+		WebIdentityTokenFile: c.GlobalString("web-identity-token-file"),
+		RoleChain:            roleChain(c),
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	return iamSvc
+}
@@ -1,15 +1,19 @@
 package main
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"os"
 	"strconv"
 	"strings"
 
+	"github.com/matt-deboer/assert-aws-iam-permissions/pkg/policy"
 	"github.com/matt-deboer/assert-aws-iam-permissions/pkg/types"
 	log "github.com/sirupsen/logrus"
+	"github.com/urfave/cli"
 )
 
 func parseInput(stdin io.Reader) *types.Inputs {
@@ -27,43 +31,132 @@ func parseInput(stdin io.Reader) *types.Inputs {
 
 		// try the pieces individually, in case each of the parameters is a separate (quoted) JSON document
 		inputsMap := make(map[string]interface{})
-		err2 := json.Unmarshal(data, &inputsMap)
-		if err2 != nil {
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.UseNumber()
+		if err2 := decoder.Decode(&inputsMap); err2 != nil {
 			log.Fatalf("Error unmarshaling inputs json; %v", err2)
 		}
-		if policyJSON, ok := inputsMap["policy_json"]; ok {
-			inputs.PolicyJSON = policyJSON.(string)
+		for key, value := range map[string]*string{
+			"policy_json":       &inputs.PolicyJSON,
+			"principal_arn":     &inputs.PrincipalArn,
+			"trust_policy_json": &inputs.TrustPolicyJSON,
+		} {
+			if input, ok := inputsMap[key]; ok {
+				if *value, ok = input.(string); !ok {
+					log.Fatalf("Error unmarshaling inputs.%s; expected a string, but got %v", key, input)
+				}
+			}
 		}
 
 		if assertions, ok := inputsMap["assertions"]; ok {
-			err := json.Unmarshal([]byte(assertions.(string)), &inputs.Assertions)
-			if err != nil {
+			// the assertions are either a quoted JSON array, or the array itself
+			document, isString := assertions.(string)
+			if !isString {
+				encoded, err := json.Marshal(assertions)
+				if err != nil {
+					log.Fatalf("Error unmarshaling inputs.assertions; %v", err)
+				}
+				document = string(encoded)
+			}
+			if err := json.Unmarshal([]byte(document), &inputs.Assertions); err != nil {
 				log.Fatalf("Error unmarshaling inputs.assertions; %v", err)
 			}
 		}
 
+		if vars, ok := inputsMap["vars"]; ok {
+			if inputs.Vars, err = parseVars(vars); err != nil {
+				log.Fatalf("Error unmarshaling inputs.vars; %v", err)
+			}
+		}
+
 		if maxLength, ok := inputsMap["max_length"]; ok {
-			switch maxLength.(type) {
-			case float64:
-				inputs.MaxLength = int(maxLength.(float64))
-				break
+			var convError error
+			switch maxLength := maxLength.(type) {
+			case json.Number:
+				var length int64
+				length, convError = maxLength.Int64()
+				inputs.MaxLength = int(length)
 			case string:
-				var convError error
-				inputs.MaxLength, convError = strconv.Atoi(maxLength.(string))
-				if convError != nil {
-					log.Fatalf("Error unmarshaling inputs.max_length; %v", convError)
-				}
-				break
-			case int64:
-				inputs.MaxLength = int(maxLength.(int64))
-				break
+				inputs.MaxLength, convError = strconv.Atoi(maxLength)
+			default:
+				convError = fmt.Errorf("expected a number, but got %v", maxLength)
+			}
+			if convError != nil {
+				log.Fatalf("Error unmarshaling inputs.max_length; %v", convError)
 			}
 		}
 	}
 	return &inputs
 }
 
-func serializeOutput(policyJSON string, stdout io.Writer) error {
-	_, err := stdout.Write([]byte(fmt.Sprintf(`{"policy_json": %s}`, strconv.Quote(policyJSON))))
+// parseVars converts the vars of the inputs, either an object or a quoted
+// JSON object, to strings; numbers are kept as written, so that account IDs
+// aren't put in exponent form
+func parseVars(vars interface{}) (map[string]string, error) {
+	if document, ok := vars.(string); ok {
+		decoder := json.NewDecoder(strings.NewReader(document))
+		decoder.UseNumber()
+		if err := decoder.Decode(&vars); err != nil {
+			return nil, err
+		}
+	}
+	object, ok := vars.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("expected an object, but got %v", vars)
+	}
+	parsed := make(map[string]string)
+	for key, value := range object {
+		switch value := value.(type) {
+		case string:
+			parsed[key] = value
+		case json.Number:
+			parsed[key] = value.String()
+		case bool:
+			parsed[key] = strconv.FormatBool(value)
+		default:
+			return nil, fmt.Errorf("the value of %s must be a string, number or boolean, but got %v", key, value)
+		}
+	}
+	return parsed, nil
+}
+
+// resolveVars merges the variables from the inputs, AAIP_VAR_* environment
+// variables and --var flags, with later sources taking precedence
+func resolveVars(c *cli.Context, inputVars map[string]string) map[string]string {
+	vars := make(map[string]string)
+	for key, value := range inputVars {
+		vars[key] = value
+	}
+	definitions := []string{}
+	for _, env := range os.Environ() {
+		if strings.HasPrefix(env, varEnvPrefix) {
+			definitions = append(definitions, strings.TrimPrefix(env, varEnvPrefix))
+		}
+	}
+	for _, definition := range append(definitions, c.GlobalStringSlice("var")...) {
+		key, value, err := policy.ParseVar(definition)
+		if err != nil {
+			argError(c, "%v", err)
+		}
+		vars[key] = value
+	}
+	return vars
+}
+
+// interpolateInputs replaces the {{name}} variables in the policy documents,
+// principal ARN and assertions of the inputs
+func interpolateInputs(inputs *types.Inputs, vars map[string]string) error {
+	for _, value := range []*string{&inputs.PolicyJSON, &inputs.TrustPolicyJSON, &inputs.PrincipalArn} {
+		interpolated, err := policy.Interpolate(*value, vars)
+		if err != nil {
+			return err
+		}
+		*value = interpolated
+	}
+	return policy.InterpolateAssertions(inputs.Assertions, vars)
+}
+
+func serializeOutput(key string, policyJSON string, stdout io.Writer) error {
+	_, err := stdout.Write([]byte(fmt.Sprintf(`{%s: %s}`, strconv.Quote(key), strconv.Quote(policyJSON))))
 	return err
 }
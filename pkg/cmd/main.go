@@ -6,6 +6,8 @@ import (
 	"os"
 
 	"github.com/matt-deboer/assert-aws-iam-permissions/pkg/policy"
+	"github.com/matt-deboer/assert-aws-iam-permissions/pkg/runner"
+	"github.com/matt-deboer/assert-aws-iam-permissions/pkg/suite"
 	"github.com/matt-deboer/assert-aws-iam-permissions/pkg/types"
 	"github.com/matt-deboer/assert-aws-iam-permissions/pkg/version"
 	log "github.com/sirupsen/logrus"
@@ -22,6 +24,9 @@ func argError(c *cli.Context, msg string, args ...interface{}) {
 	os.Exit(1)
 }
 
+// varEnvPrefix prefixes the environment variables defining input variables
+const varEnvPrefix = "AAIP_VAR_"
+
 func run(args []string, stdin io.Reader, stdout io.Writer) {
 	app := cli.NewApp()
 	app.Name = version.Name
@@ -55,47 +60,124 @@ func run(args []string, stdin io.Reader, stdout io.Writer) {
 					"key": {"type": "the_type","values": ["some_values"...]},
 					...
 				},
-				"resource_handling_option": "option"
+				"resource_handling_option": "option",
+				"cross_account":            true|false // derives resource_owner from the resource ARNs
+				"principals":               {"AWS|Service|Federated": ["principal"...]} // for trust policy assertions
+				"matrix":                   {"action_names": [...], "resource_arns": [...], "contexts": {"name": {context_entries}...},
+				                            "rules": [{"action_names": [...], "resource_arns": [...], "contexts": ["name"...], "expected_result": "..."}...]}
+				"tags":                     ["tag"...] // for selecting assertions with 'test --tags'
 				if empty, assertions are read from JSON on stdin (under the key "assertions")`,
 			EnvVar: prefix + "ASSERTIONS",
 		},
 		cli.StringFlag{
-			Name:   "assume-role-arn",
-			Usage:  `The ARN of the role to assume when making AWS API calls`,
-			EnvVar: prefix + "ASSUME_ROLE_ARN",
+			Name: "assertions-file",
+			Usage: `A JSON or YAML suite file, holding an array of assertions or an object with 'include' (other suite
+			files), 'defaults' (caller_arn, resource_owner, context_entries and tags inherited by every assertion),
+			'assertions' and named 'suites' (each with its own 'defaults' and 'assertions'); its assertions
+			are evaluated along with those of 'assertions'`,
+			EnvVar: prefix + "ASSERTIONS_FILE",
+		},
+		cli.StringFlag{
+			Name: "trust-policy-json",
+			Usage: `The full contents of a role trust policy (AssumeRolePolicyDocument); when set, the assertions
+			are evaluated against the trust policy, and must name the 'principals' assuming the role. If empty,
+			it may be read from JSON on stdin (under the key "trust_policy_json")`,
+			EnvVar: prefix + "TRUST_POLICY_JSON",
+		},
+		cli.StringFlag{
+			Name: "principal-arn",
+			Usage: `The ARN of an existing IAM user, group or role whose policies the assertions are evaluated
+			against (using SimulatePrincipalPolicy); when set, 'policy-json' is optional and is included
+			as an additional policy. If empty, it may be read from JSON on stdin (under the key "principal_arn")`,
+			EnvVar: prefix + "PRINCIPAL_ARN",
+		},
+		cli.StringFlag{
+			Name: "record",
+			Usage: `A cassette directory to which the responses of the policy simulator are recorded, as a JSON
+			file per simulation named by the hash of its request, for replaying with 'replay'`,
+			EnvVar: prefix + "RECORD",
+		},
+		cli.StringFlag{
+			Name: "replay",
+			Usage: `A cassette directory written with 'record', from which the responses of the policy simulator are
+			answered without calling AWS; simulations which weren't recorded fail`,
+			EnvVar: prefix + "REPLAY",
+		},
+		cli.StringSliceFlag{
+			Name: "var",
+			Usage: `A variable definition of the form key=value, interpolated wherever {{key}} appears in the policy
+			documents, resource_arns, caller_arn, resource_owner, principals and context entry values; may be repeated. Variables
+			may also be defined in a "vars" object on stdin, or by environment variables named ` + varEnvPrefix + `<key>`,
 		},
 		cli.BoolFlag{
 			Name:   "read-stdin, i",
 			Usage:  "whether to read inputs from stdin",
 			EnvVar: prefix + "READ_STDIN",
 		},
+		cli.BoolFlag{
+			Name: "terraform",
+			Usage: `Run as a terraform external data source: inputs are read from stdin, failed assertions are
+			summarized on stderr (one line each) with exit status 1, and on success the result holds string
+			keys policy_sha256, minified_length, assertion_count, statement_count and engine, along with
+			the policy document`,
+			EnvVar: prefix + "TERRAFORM",
+		},
 		cli.BoolFlag{
 			Name:   "verbose, V",
 			Usage:  "Log debugging information",
 			EnvVar: prefix + "VERBOSE",
 		},
 	}
+	app.Flags = append(app.Flags, credentialFlags(prefix)...)
+	app.Flags = append(app.Flags, reportFlags(prefix)...)
+	// the MFA token code of credentials is read from stdin
+	app.Metadata = map[string]interface{}{"stdin": stdin}
+	app.Before = func(c *cli.Context) error {
+		validateCredentialFlags(c)
+		return nil
+	}
+	app.Commands = []cli.Command{
+		auditCommand(stdin, stdout),
+		contextKeysCommand(stdin, stdout),
+		driftCommand(stdin, stdout),
+		scaffoldCommand(stdin, stdout),
+		serveCommand(),
+		fakeIAMCommand(),
+		testCommand(stdout),
+		tfPlanCommand(stdin, stdout),
+		cfnCommand(stdin, stdout),
+	}
 	app.Action = func(c *cli.Context) {
 
 		if c.Bool("verbose") {
 			log.SetLevel(log.DebugLevel)
 		}
+		if c.Bool("terraform") {
+			if len(c.String("output")) > 0 {
+				argError(c, "'terraform' cannot be combined with 'output'")
+			}
+			// errors are shown to terraform users as they are written
+			log.SetFormatter(&messageFormatter{})
+		}
+		checkTokenStdin(c, c.Bool("read-stdin") || c.Bool("terraform"))
 
 		var inputs types.Inputs
 		policyJSONString := c.String("policy-json")
 		assertionsString := c.String("assertions")
 		inputs.MaxLength = c.Int("max-length")
+		inputs.PrincipalArn = c.String("principal-arn")
+		inputs.TrustPolicyJSON = c.String("trust-policy-json")
 
 		if len(policyJSONString) > 0 {
 			inputs.PolicyJSON = policyJSONString
 		}
 		if len(assertionsString) > 0 {
-			err := json.Unmarshal([]byte(assertionsString), inputs.Assertions)
+			err := json.Unmarshal([]byte(assertionsString), &inputs.Assertions)
 			if err != nil {
 				log.Fatalf("Failed to unmarshal assertions array; %v", err)
 			}
 		}
-		if c.Bool("read-stdin") {
+		if c.Bool("read-stdin") || c.Bool("terraform") {
 			stdinInputs := parseInput(stdin)
 			if len(stdinInputs.Assertions) > 0 {
 				inputs.Assertions = stdinInputs.Assertions
@@ -106,26 +188,56 @@ func run(args []string, stdin io.Reader, stdout io.Writer) {
 			if stdinInputs.MaxLength > 0 {
 				inputs.MaxLength = stdinInputs.MaxLength
 			}
+			if len(stdinInputs.PrincipalArn) > 0 {
+				inputs.PrincipalArn = stdinInputs.PrincipalArn
+			}
+			if len(stdinInputs.TrustPolicyJSON) > 0 {
+				inputs.TrustPolicyJSON = stdinInputs.TrustPolicyJSON
+			}
+			inputs.Vars = stdinInputs.Vars
+		}
+		if assertionsFile := c.String("assertions-file"); len(assertionsFile) > 0 {
+			suites, err := suite.Load(assertionsFile)
+			if err != nil {
+				log.Fatalf("Failed to load assertions file; %v", err)
+			}
+			inputs.Assertions = append(inputs.Assertions, suite.Assertions(suites)...)
+		}
+		if err := interpolateInputs(&inputs, resolveVars(c, inputs.Vars)); err != nil {
+			log.Fatal(err)
 		}
 		if len(inputs.Assertions) == 0 {
 			argError(c, "'assertions' is required")
 		}
-		if len(inputs.PolicyJSON) == 0 {
+		if len(inputs.TrustPolicyJSON) > 0 {
+			if len(inputs.PolicyJSON) > 0 || len(inputs.PrincipalArn) > 0 {
+				argError(c, "'trust-policy-json' cannot be combined with 'policy-json' or 'principal-arn'")
+			}
+			if inputs.MaxLength > 0 {
+				err := policy.AssertPolicyLength(inputs.MaxLength, inputs.TrustPolicyJSON)
+				if err != nil {
+					writeLengthFailure(c, &inputs, nil, err, stdout)
+				}
+			}
+			inputs.Assertions = policy.WithContext(inputs.Assertions, principalTagContext(c))
+			result := runner.RunInputs(&inputs, nil)
+			writeResults(c, result, "trust_policy_json", inputs.TrustPolicyJSON, stdout)
+			return
+		}
+		if len(inputs.PolicyJSON) == 0 && len(inputs.PrincipalArn) == 0 {
 			argError(c, "'policy-json' is required")
 		}
 
+		iamSvc := newSimulatorIAM(c)
 		if inputs.MaxLength > 0 {
 			err := policy.AssertPolicyLength(inputs.MaxLength, inputs.PolicyJSON)
 			if err != nil {
-				log.Fatal(err)
+				writeLengthFailure(c, &inputs, iamSvc, err, stdout)
 			}
 		}
 
-		err := policy.AssertPermissions(inputs.Assertions, inputs.PolicyJSON, c.String("assume-role-arn"))
-		if err != nil {
-			log.Fatal(err)
-		}
-		serializeOutput(inputs.PolicyJSON, stdout)
+		result := runner.RunInputs(&inputs, iamSvc)
+		writeResults(c, result, "policy_json", inputs.PolicyJSON, stdout)
 	}
 	app.Run(args)
 }
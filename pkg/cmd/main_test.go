@@ -2,11 +2,24 @@ package main
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"strconv"
+	"strings"
 	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/aws/aws-sdk-go/service/iam/iamiface"
+	"github.com/matt-deboer/assert-aws-iam-permissions/pkg/fakeiam"
+	"github.com/matt-deboer/assert-aws-iam-permissions/pkg/policy"
+	"github.com/matt-deboer/assert-aws-iam-permissions/pkg/types"
 )
 
 const testPolicy = `
@@ -121,6 +134,85 @@ func TestAssertBasicPermissions(t *testing.T) {
 	run(args, inputs, outputs)
 }
 
+func TestAssertBasicPermissions_IAMEndpoint(t *testing.T) {
+
+	handler, err := fakeiam.New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		handler.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+	// the fake doesn't check signatures, but the client must have credentials
+	for key, value := range map[string]string{"AWS_ACCESS_KEY_ID": "AKID", "AWS_SECRET_ACCESS_KEY": "SECRET"} {
+		defer os.Setenv(key, os.Getenv(key))
+		os.Setenv(key, value)
+	}
+
+	args := []string{"assert-aws-iam-permissions", "--iam-endpoint", server.URL, "--policy-json", testPolicy, "--assertions",
+		`[{"action_names": ["s3:ListBucket"], "resource_arns": ["arn:aws:s3:::my-bucket"], "expected_result": "allowed"}]`}
+	outputs := &bytes.Buffer{}
+
+	run(args, &bytes.Buffer{}, outputs)
+
+	expected := fmt.Sprintf(`{"policy_json": %s}`, strconv.Quote(testPolicy))
+	if requests != 1 || outputs.String() != expected {
+		t.Errorf("unexpected output after %d requests: %s", requests, outputs.String())
+	}
+}
+
+func TestCredentialFlags_Invalid(t *testing.T) {
+
+	cases := []struct {
+		args     []string
+		expected string
+	}{
+		{[]string{"--external-id", "id"}, "'external-id' requires 'assume-role-arn'"},
+		{[]string{"--role-duration", "1h"}, "'role-duration' requires 'assume-role-arn' or 'role-chain'"},
+		{[]string{"--assume-role-arn", "arn:aws:iam::123456789012:role/r", "--role-duration", "13h"},
+			"'role-duration' must be between 15m0s and 12h0m0s"},
+		{[]string{"--assume-role-arn", "arn:aws:iam::123456789012:role/r", "--role-session-name", "a b"},
+			"'role-session-name' must be 2 to 64 letters, digits or any of _+=,.@-"},
+		{[]string{"--assume-role-arn", "arn:aws:iam::123456789012:role/r", "--web-identity-token-file", os.Args[0],
+			"--mfa-serial", "arn:aws:iam::123456789012:mfa/alice"}, "'web-identity-token-file' cannot be combined with 'mfa-serial'"},
+		{[]string{"--assume-role-arn", "arn:aws:iam::123456789012:role/r", "--web-identity-token-file", "/no/such/token"},
+			"Invalid 'web-identity-token-file'; stat /no/such/token: no such file or directory"},
+		{[]string{"--assume-role-arn", "arn:aws:iam::123456789012:role/r", "--mfa-serial", "arn:aws:iam::123456789012:mfa/alice",
+			"--read-stdin"}, "'mfa-serial' reads the MFA token code from stdin, so can't be combined with inputs read from stdin"},
+		{[]string{"--role-chain", "arn:aws:iam::123456789012:user/alice"},
+			"Invalid 'role-chain'; Invalid role ARN 'arn:aws:iam::123456789012:user/alice' in role chain"},
+		{[]string{"--role-chain", "arn:aws:iam::123456789012:role/a;transitive-tag:team=web",
+			"--role-chain", "arn:aws:iam::123456789012:role/b;tag:Team=db"},
+			"Invalid 'role-chain'; Session tag Team of role arn:aws:iam::123456789012:role/b conflicts with the transitive tag team"},
+		{[]string{"--role-chain", "arn:aws:iam::123456789012:role/a", "--external-id", "id"},
+			"'role-chain' cannot be combined with 'external-id'"},
+		{[]string{"--role-chain", "arn:aws:iam::123456789012:role/a", "--role-duration", "2h"},
+			"'role-duration' must be between 15m0s and 1h0m0s with 'role-chain'"},
+	}
+
+	if index, err := strconv.Atoi(os.Getenv("CREDENTIALS_CASE")); err == nil {
+		args := append([]string{"assert-aws-iam-permissions"}, cases[index].args...)
+		run(append(args, "--policy-json", testPolicy, "--assertions", "[]"), &bytes.Buffer{}, &bytes.Buffer{})
+		return
+	}
+	for i, c := range cases {
+		cmd := exec.Command(os.Args[0], "-test.run=TestCredentialFlags_Invalid$")
+		cmd.Env = append(os.Environ(), fmt.Sprintf("CREDENTIALS_CASE=%d", i))
+		stderr := &bytes.Buffer{}
+		cmd.Stderr = stderr
+		err := cmd.Run()
+		if e, ok := err.(*exec.ExitError); !ok || e.Success() {
+			t.Errorf("%v: process ran with err %v, want exit status 1", c.args, err)
+		}
+		if !strings.Contains(stderr.String(), c.expected) {
+			t.Errorf("%v: expected the error %q, but got:\n%s", c.args, c.expected, stderr.String())
+		}
+	}
+}
+
 func TestAssertBasicPermissions_QuotedPolicy(t *testing.T) {
 
 	args := []string{"assert-aws-iam-permissions", "--read-stdin"}
@@ -184,3 +276,656 @@ func TestAssertBasicPermissions_TerraformQuotedPolicyMaxLengthFailure(t *testing
 		t.Fatalf("process ran with err %v, want exit status 1", err)
 	}
 }
+
+func TestAssertTrustPolicy(t *testing.T) {
+
+	trustPolicy := `{
+		"Version": "2012-10-17",
+		"Statement": {
+			"Effect": "Allow",
+			"Principal": {"Service": "ec2.amazonaws.com"},
+			"Action": "sts:AssumeRole"
+		}
+	}`
+	args := []string{"assert-aws-iam-permissions", "--read-stdin"}
+	outputs := &bytes.Buffer{}
+	inputs := bytes.NewBufferString(fmt.Sprintf(`
+	{
+		"assertions": [
+			{
+				"principals":      {"Service": ["ec2.amazonaws.com"]},
+				"action_names":    ["sts:AssumeRole"],
+				"expected_result": "allowed"
+			}
+		],
+		"trust_policy_json": %s
+	}
+	`, strconv.Quote(trustPolicy)))
+
+	run(args, inputs, outputs)
+
+	expected := fmt.Sprintf(`{"trust_policy_json": %s}`, strconv.Quote(trustPolicy))
+	if outputs.String() != expected {
+		t.Errorf("unexpected output: %s", outputs.String())
+	}
+}
+
+func TestContextKeys_Local(t *testing.T) {
+
+	args := []string{"assert-aws-iam-permissions", "context-keys", "--local", "--read-stdin"}
+	outputs := &bytes.Buffer{}
+	inputs := bytes.NewBufferString(fmt.Sprintf(terraformQuotedInputs, 0))
+
+	run(args, inputs, outputs)
+
+	expected := "autoscaling:ResourceTag/application-group\naws:RequestTag/application-group\n" +
+		"ec2:InstanceProfile\nec2:ResourceTag/application-group\niam:RoleArn\n"
+	if outputs.String() != expected {
+		t.Errorf("unexpected output:\n%s", outputs.String())
+	}
+}
+
+func TestAssertTrustPolicy_Vars(t *testing.T) {
+
+	trustPolicy := `{
+		"Version": "2012-10-17",
+		"Statement": {
+			"Effect": "Allow",
+			"Principal": {"AWS": "arn:aws:iam::{{partner}}:root"},
+			"Action": "sts:AssumeRole",
+			"Condition": {"StringEquals": {"sts:ExternalId": "{{external_id}}"}}
+		}
+	}`
+	os.Setenv("AAIP_VAR_external_id", "from-env")
+	defer os.Unsetenv("AAIP_VAR_external_id")
+	args := []string{"assert-aws-iam-permissions", "--read-stdin", "--var", "external_id=from-flag"}
+	outputs := &bytes.Buffer{}
+	inputs := bytes.NewBufferString(fmt.Sprintf(`
+	{
+		"vars": {"partner": "210987654321", "external_id": "from-stdin"},
+		"assertions": [
+			{
+				"principals":      {"AWS": ["arn:aws:iam::{{partner}}:role/deployer"]},
+				"action_names":    ["sts:AssumeRole"],
+				"context_entries": {"sts:ExternalId": {"values": ["from-flag"]}},
+				"expected_result": "allowed"
+			}
+		],
+		"trust_policy_json": %s
+	}
+	`, strconv.Quote(trustPolicy)))
+
+	run(args, inputs, outputs)
+
+	expected := fmt.Sprintf(`{"trust_policy_json": %s}`, strconv.Quote(strings.NewReplacer(
+		"{{partner}}", "210987654321", "{{external_id}}", "from-flag").Replace(trustPolicy)))
+	if outputs.String() != expected {
+		t.Errorf("unexpected output: %s", outputs.String())
+	}
+}
+
+func TestParseInput_NumericVars(t *testing.T) {
+
+	inputs := parseInput(strings.NewReader(`{
+		"vars": {"account": 123456789012, "enabled": true},
+		"assertions": [{"action_names": ["s3:GetObject"], "expected_result": "allowed"}],
+		"max_length": 6144
+	}`))
+	if inputs.Vars["account"] != "123456789012" || inputs.Vars["enabled"] != "true" {
+		t.Errorf("unexpected vars %v", inputs.Vars)
+	}
+	if len(inputs.Assertions) != 1 || inputs.Assertions[0].ActionNames[0] != "s3:GetObject" || inputs.MaxLength != 6144 {
+		t.Errorf("unexpected inputs %v", inputs)
+	}
+
+	if vars, err := parseVars(`{"account": 123456789012}`); err != nil || vars["account"] != "123456789012" {
+		t.Errorf("unexpected vars %v; %v", vars, err)
+	}
+	if _, err := parseVars(map[string]interface{}{"accounts": []interface{}{"123456789012"}}); err == nil {
+		t.Error("expected an error for a list value")
+	}
+}
+
+func TestAssertTrustPolicy_AssertionsFile(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "assertions")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	assertionsFile := filepath.Join(dir, "assertions.yaml")
+	err = ioutil.WriteFile(assertionsFile, []byte(`
+suites:
+  ec2:
+    defaults:
+      context_entries:
+        aws:SourceAccount: {values: ["123456789012"]}
+    assertions:
+      - comment: EC2 can assume the role
+        principals: {Service: [ec2.amazonaws.com]}
+        action_names: [sts:AssumeRole]
+        expected_result: allowed
+`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	trustPolicy := `{
+		"Version": "2012-10-17",
+		"Statement": {
+			"Effect": "Allow",
+			"Principal": {"Service": "ec2.amazonaws.com"},
+			"Action": "sts:AssumeRole",
+			"Condition": {"StringEquals": {"aws:SourceAccount": "123456789012"}}
+		}
+	}`
+	args := []string{"assert-aws-iam-permissions", "--assertions-file", assertionsFile, "--trust-policy-json", trustPolicy}
+	outputs := &bytes.Buffer{}
+
+	run(args, &bytes.Buffer{}, outputs)
+
+	expected := fmt.Sprintf(`{"trust_policy_json": %s}`, strconv.Quote(trustPolicy))
+	if outputs.String() != expected {
+		t.Errorf("unexpected output: %s", outputs.String())
+	}
+}
+
+func TestTest_Local(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "policies")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err = ioutil.WriteFile(filepath.Join(dir, "route53.json"), []byte(testPolicy), 0644); err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(filepath.Join(dir, "route53.assertions.yaml"), []byte(`
+- comment: Can change record sets
+  action_names: [route53:ChangeResourceRecordSets]
+  resource_arns: ["*"]
+  expected_result: allowed
+- comment: Cannot delete zones
+  action_names: [route53:DeleteHostedZone]
+  resource_arns: ["*"]
+  expected_result: denied
+`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	args := []string{"assert-aws-iam-permissions", "test", "--local", "--run", "record sets", dir + "/..."}
+	outputs := &bytes.Buffer{}
+
+	run(args, &bytes.Buffer{}, outputs)
+
+	if !strings.HasPrefix(outputs.String(), "ok  \t"+filepath.Join(dir, "route53")+"\t") ||
+		!strings.HasSuffix(outputs.String(), "PASS\n1 passed, 0 failed, 1 skipped, 0 errored\n") {
+		t.Errorf("unexpected output:\n%s", outputs.String())
+	}
+}
+
+func TestTest_RoleChain(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "policies")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	err = ioutil.WriteFile(filepath.Join(dir, "tagged.json"), []byte(`{
+		"Version": "2012-10-17",
+		"Statement": [
+			{"Effect": "Allow", "Action": "s3:GetObject", "Resource": "*",
+				"Condition": {"StringEquals": {"aws:PrincipalTag/team": "web", "aws:PrincipalTag/stage": "prod"}}}
+		]
+	}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(filepath.Join(dir, "tagged.assertions.yaml"), []byte(`
+- comment: The chained session can read
+  action_names: [s3:GetObject]
+  resource_arns: ["*"]
+  expected_result: allowed
+- comment: Another team cannot read
+  action_names: [s3:GetObject]
+  resource_arns: ["*"]
+  context_entries:
+    aws:principaltag/team: {type: string, values: [db]}
+  expected_result: denied
+`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	args := []string{"assert-aws-iam-permissions",
+		"--role-chain", "arn:aws:iam::111111111111:role/ci;tag:pipeline=42;transitive-tag:team=web",
+		"--role-chain", "arn:aws:iam::222222222222:role/deployer;external-id=x;tag:stage=prod",
+		"test", "--local", dir + "/..."}
+	outputs := &bytes.Buffer{}
+
+	run(args, &bytes.Buffer{}, outputs)
+
+	if !strings.HasSuffix(outputs.String(), "PASS\n2 passed, 0 failed, 0 skipped, 0 errored\n") {
+		t.Errorf("unexpected output:\n%s", outputs.String())
+	}
+}
+
+// allowingSimulator answers every simulation with 'allowed'
+type allowingSimulator struct {
+	iamiface.IAMAPI
+}
+
+func (s *allowingSimulator) SimulateCustomPolicy(input *iam.SimulateCustomPolicyInput) (*iam.SimulatePolicyResponse, error) {
+	response := &iam.SimulatePolicyResponse{}
+	for _, action := range input.ActionNames {
+		for _, resource := range input.ResourceArns {
+			response.EvaluationResults = append(response.EvaluationResults, &iam.EvaluationResult{
+				EvalActionName:   action,
+				EvalResourceName: resource,
+				EvalDecision:     aws.String("allowed"),
+			})
+		}
+	}
+	return response, nil
+}
+
+func TestTest_Replay(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "policies")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err = ioutil.WriteFile(filepath.Join(dir, "route53.json"), []byte(testPolicy), 0644); err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(filepath.Join(dir, "route53.assertions.yaml"), []byte(`
+- comment: Can change record sets
+  action_names: [route53:ChangeResourceRecordSets]
+  resource_arns: ["*"]
+  expected_result: allowed
+- comment: Can delete zones
+  action_names: [route53:DeleteHostedZone]
+  resource_arns: ["*"]
+  expected_result: allowed
+`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cassette := filepath.Join(dir, "cassette")
+	recorder, err := policy.NewRecorder(&allowingSimulator{}, cassette)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertions := []*types.Assertion{{
+		ActionNames:  []string{"route53:ChangeResourceRecordSets"},
+		ResourceArns: []string{"*"},
+	}}
+	if _, err = policy.NewAWSEvaluator(recorder).Evaluate(assertions, []string{testPolicy}); err != nil {
+		t.Fatal(err)
+	}
+
+	args := []string{"assert-aws-iam-permissions", "--replay", cassette, "test", "--run", "record sets", dir + "/..."}
+	outputs := &bytes.Buffer{}
+
+	run(args, &bytes.Buffer{}, outputs)
+
+	if !strings.HasSuffix(outputs.String(), "PASS\n1 passed, 0 failed, 1 skipped, 0 errored\n") {
+		t.Errorf("unexpected output:\n%s", outputs.String())
+	}
+
+	// simulations missing from the cassette are errors
+	if os.Getenv("SHOULD_EXIT") == "1" {
+		run([]string{"assert-aws-iam-permissions", "--replay", cassette, "test", dir + "/..."}, &bytes.Buffer{}, os.Stdout)
+		return
+	}
+	cmd := exec.Command(os.Args[0], "-test.run=TestTest_Replay$")
+	cmd.Env = append(os.Environ(), "SHOULD_EXIT=1")
+	stdout := &bytes.Buffer{}
+	cmd.Stdout = stdout
+	err = cmd.Run()
+	if e, ok := err.(*exec.ExitError); !ok || e.Success() {
+		t.Fatalf("process ran with err %v, want exit status 1", err)
+	}
+	if !strings.Contains(stdout.String(), "of route53:DeleteHostedZone on *; the simulation must be recorded again") ||
+		!strings.HasSuffix(stdout.String(), "FAIL\n1 passed, 0 failed, 0 skipped, 1 errored\n") {
+		t.Errorf("unexpected output:\n%s", stdout.String())
+	}
+}
+
+func TestAssertTrustPolicy_JSONOutput(t *testing.T) {
+
+	trustPolicy := `{"Version": "2012-10-17", "Statement": {"Effect": "Allow", "Principal": {"Service": "ec2.amazonaws.com"}, "Action": "sts:AssumeRole"}}`
+	assertions := `[{"comment": "EC2 can assume the role", "principals": {"Service": ["ec2.amazonaws.com"]},
+		"action_names": ["sts:AssumeRole"], "expected_result": "allowed"}]`
+	args := []string{"assert-aws-iam-permissions", "--output", "json", "--trust-policy-json", trustPolicy, "--assertions", assertions}
+	outputs := &bytes.Buffer{}
+
+	run(args, &bytes.Buffer{}, outputs)
+
+	var results struct {
+		SchemaVersion string `json:"schema_version"`
+		Policies      []struct {
+			Name       string `json:"name"`
+			Assertions []struct {
+				Status      string `json:"status"`
+				Evaluations []struct {
+					Decision string `json:"decision"`
+				} `json:"evaluations"`
+			} `json:"assertions"`
+		} `json:"policies"`
+	}
+	if err := json.Unmarshal(outputs.Bytes(), &results); err != nil {
+		t.Fatalf("unexpected output %s; %v", outputs.String(), err)
+	}
+	if results.SchemaVersion != "1" || results.Policies[0].Name != "trust_policy_json" ||
+		results.Policies[0].Assertions[0].Status != "PASS" || results.Policies[0].Assertions[0].Evaluations[0].Decision != "allowed" {
+		t.Errorf("unexpected output: %s", outputs.String())
+	}
+}
+
+func TestAssertTrustPolicy_LengthReports(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "reports")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	markdownReport := filepath.Join(dir, "review.md")
+	if os.Getenv("SHOULD_EXIT") == "1" {
+		// this is the actual test, which should exit for the policy's length once the reports are written
+		trustPolicy := `{"Version": "2012-10-17", "Statement": {"Effect": "Allow", "Principal": {"Service": "ec2.amazonaws.com"}, "Action": "sts:AssumeRole"}}`
+		args := []string{"assert-aws-iam-permissions", "--max-length", "50", "--output", "sarif", "--trust-policy-json", trustPolicy,
+			"--assertions", `[{"principals": {"Service": ["ec2.amazonaws.com"]}, "action_names": ["sts:AssumeRole"], "expected_result": "allowed"}]`,
+			"--report-markdown", os.Getenv("MARKDOWN_REPORT")}
+		run(args, &bytes.Buffer{}, os.Stdout)
+		return
+	}
+
+	cmd := exec.Command(os.Args[0], "-test.run=TestAssertTrustPolicy_LengthReports$")
+	cmd.Env = append(os.Environ(), "SHOULD_EXIT=1", "MARKDOWN_REPORT="+markdownReport)
+	stdout := &bytes.Buffer{}
+	cmd.Stdout = stdout
+	err = cmd.Run()
+	if e, ok := err.(*exec.ExitError); !ok || e.Success() {
+		t.Fatalf("process ran with err %v, want exit status 1", err)
+	}
+	if !strings.Contains(stdout.String(), `"ruleId": "AAIP005"`) {
+		t.Errorf("expected a policy-size-limit result, but got:\n%s", stdout.String())
+	}
+	markdown, err := ioutil.ReadFile(markdownReport)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(markdown), "125 of 50 characters, excluding whitespace (100%) — **over the limit**") {
+		t.Errorf("unexpected Markdown report:\n%s", markdown)
+	}
+}
+
+func TestTest_Reports(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "policies")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err = ioutil.WriteFile(filepath.Join(dir, "route53.json"), []byte(testPolicy), 0644); err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(filepath.Join(dir, "route53.assertions.yaml"), []byte(`
+- comment: Can change record sets
+  action_names: [route53:ChangeResourceRecordSets]
+  resource_arns: ["*"]
+  expected_result: allowed
+`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	htmlReport, markdownReport := filepath.Join(dir, "report.html"), filepath.Join(dir, "report.md")
+	args := []string{"assert-aws-iam-permissions", "--max-length", "6144", "test", "--local",
+		"--report-html", htmlReport, "--report-markdown", markdownReport, dir}
+
+	run(args, &bytes.Buffer{}, &bytes.Buffer{})
+
+	html, err := ioutil.ReadFile(htmlReport)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(html), `<span class="badge PASS">PASS</span> Can change record sets (route53:ChangeResourceRecordSets)`) ||
+		!strings.Contains(string(html), " of 6144 characters") {
+		t.Errorf("unexpected HTML report:\n%s", html)
+	}
+	markdown, err := ioutil.ReadFile(markdownReport)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(markdown), "| Can change record sets | ✅ PASS | 1 / 1 |  |") {
+		t.Errorf("unexpected Markdown report:\n%s", markdown)
+	}
+}
+
+func TestAssertTrustPolicy_Terraform(t *testing.T) {
+
+	trustPolicy := `{"Version": "2012-10-17", "Statement": {"Effect": "Allow", "Principal": {"Service": "ec2.amazonaws.com"}, "Action": "sts:AssumeRole"}}`
+	assertions := `[{"comment": "EC2 can assume the role", "principals": {"Service": ["ec2.amazonaws.com"]},
+		"action_names": ["sts:AssumeRole"], "expected_result": "allowed"}]`
+	args := []string{"assert-aws-iam-permissions", "--terraform"}
+	outputs := &bytes.Buffer{}
+	inputs := bytes.NewBufferString(fmt.Sprintf(`{"trust_policy_json": %s, "assertions": %s}`,
+		strconv.Quote(trustPolicy), strconv.Quote(assertions)))
+
+	switch os.Getenv("TERRAFORM_CASE") {
+	case "failure":
+		// this is the actual test, which should exit with the failures on stderr
+		inputs = bytes.NewBufferString(fmt.Sprintf(`{"trust_policy_json": %s, "assertions": %s}`,
+			strconv.Quote(trustPolicy), strconv.Quote(strings.Replace(assertions, "ec2.amazonaws.com", "lambda.amazonaws.com", 1))))
+		run(args, inputs, outputs)
+		return
+	case "length":
+		// this is the actual test, which should exit before any assertion is evaluated
+		inputs = bytes.NewBufferString(fmt.Sprintf(`{"trust_policy_json": %s, "assertions": %s, "max_length": 50}`,
+			strconv.Quote(trustPolicy), strconv.Quote(assertions)))
+		run(args, inputs, outputs)
+		return
+	}
+
+	run(args, inputs, outputs)
+
+	var result map[string]string
+	if err := json.Unmarshal(outputs.Bytes(), &result); err != nil {
+		t.Fatalf("expected a JSON object of strings, but got %s; %v", outputs.String(), err)
+	}
+	expected := map[string]string{
+		"trust_policy_json": trustPolicy,
+		"policy_sha256":     "71614df5c7279ee179972672ef59b3d9442800879ff014edbbbb05ab2523587f",
+		"minified_length":   "125",
+		"assertion_count":   "1",
+		"statement_count":   "1",
+		"engine":            "local",
+	}
+	for key, value := range expected {
+		if result[key] != value {
+			t.Errorf("expected %s to be %s, but got %s", key, value, result[key])
+		}
+	}
+
+	for exitCase, expectedStderr := range map[string]string{
+		"failure": "1 of 1 assertions failed for trust_policy_json:\n" +
+			"FAIL   EC2 can assume the role: sts:AssumeRole on Service lambda.amazonaws.com is 'implicitDeny', expected 'allowed'\n",
+		"length": "Policy document is 75 characters over the expected limit of 50\n",
+	} {
+		cmd := exec.Command(os.Args[0], "-test.run=TestAssertTrustPolicy_Terraform$")
+		cmd.Env = append(os.Environ(), "TERRAFORM_CASE="+exitCase)
+		stderr := &bytes.Buffer{}
+		cmd.Stderr = stderr
+		err := cmd.Run()
+		if e, ok := err.(*exec.ExitError); !ok || e.Success() {
+			t.Fatalf("%s: process ran with err %v, want exit status 1", exitCase, err)
+		}
+		if stderr.String() != expectedStderr {
+			t.Errorf("%s: unexpected stderr:\n%s", exitCase, stderr.String())
+		}
+	}
+}
+
+func TestTFPlan_Local(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "tfplan")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	suites := map[string]string{
+		"route53.assertions.yaml": `
+- comment: Can change record sets
+  action_names: [route53:ChangeResourceRecordSets]
+  resource_arns: ["*"]
+  expected_result: allowed
+`,
+		"bucket.assertions.yaml": `
+- comment: The reader can read objects
+  caller_arn: arn:aws:iam::123456789012:role/reader
+  action_names: [s3:GetObject]
+  resource_arns: ["arn:aws:s3:::data/key"]
+  expected_result: allowed
+- comment: Others cannot read objects
+  caller_arn: arn:aws:iam::123456789012:role/other
+  action_names: [s3:GetObject]
+  resource_arns: ["arn:aws:s3:::data/key"]
+  expected_result: denied
+`,
+	}
+	for name, content := range suites {
+		if err = ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	bucketPolicy := `{"Statement": {"Effect": "Allow", "Principal": {"AWS": "arn:aws:iam::123456789012:role/reader"},
+		"Action": "s3:GetObject", "Resource": "arn:aws:s3:::data/*"}}`
+	plan := fmt.Sprintf(`{"planned_values": {"root_module": {"resources": [
+		{"address": "aws_iam_role_policy.dns", "mode": "managed", "type": "aws_iam_role_policy", "values": {"policy": %s}},
+		{"address": "aws_s3_bucket_policy.data", "mode": "managed", "type": "aws_s3_bucket_policy", "values": {"policy": %s}},
+		{"address": "aws_iam_policy.unmatched", "mode": "managed", "type": "aws_iam_policy", "values": {"policy": %s}}
+	]}}}`, strconv.Quote(testPolicy), strconv.Quote(bucketPolicy), strconv.Quote(testPolicy))
+
+	args := []string{"assert-aws-iam-permissions", "tf-plan", "--local",
+		"--suite", "aws_iam_role_policy.*=" + filepath.Join(dir, "route53.assertions.yaml"),
+		"--suite", "aws_s3_bucket_policy.data=" + filepath.Join(dir, "bucket.assertions.yaml")}
+	outputs := &bytes.Buffer{}
+
+	run(args, bytes.NewBufferString(plan), outputs)
+
+	expected := "ok  \taws_iam_role_policy.dns\t"
+	if !strings.HasPrefix(outputs.String(), expected) || !strings.Contains(outputs.String(), "\nok  \taws_s3_bucket_policy.data\t") ||
+		!strings.HasSuffix(outputs.String(), "PASS\n3 passed, 0 failed, 0 skipped, 0 errored\n") {
+		t.Errorf("unexpected output:\n%s", outputs.String())
+	}
+
+	// policies not known until apply error the suites matching them
+	if os.Getenv("SHOULD_EXIT") == "1" {
+		unknown := strings.Replace(plan, `]}}}`, `,
+		{"address": "aws_iam_role_policy.computed", "mode": "managed", "type": "aws_iam_role_policy", "values": {}},
+		{"address": "aws_iam_role.deployer", "mode": "managed", "type": "aws_iam_role", "values": {"inline_policy": [{"name": "deploy"}]}}
+	]}}, "resource_changes": [
+		{"address": "aws_iam_role_policy.computed", "change": {"actions": ["create"], "after_unknown": {"policy": true}}},
+		{"address": "aws_iam_role.deployer", "change": {"actions": ["create"], "after_unknown": {"inline_policy": [{"policy": true}]}}}
+	]}`, 1)
+		args = append(args, "--suite", "aws_iam_role.*="+filepath.Join(dir, "route53.assertions.yaml"))
+		run(args, bytes.NewBufferString(unknown), os.Stdout)
+		return
+	}
+	cmd := exec.Command(os.Args[0], "-test.run=TestTFPlan_Local$")
+	cmd.Env = append(os.Environ(), "SHOULD_EXIT=1")
+	stdout := &bytes.Buffer{}
+	cmd.Stdout = stdout
+	err = cmd.Run()
+	if e, ok := err.(*exec.ExitError); !ok || e.Success() {
+		t.Fatalf("process ran with err %v, want exit status 1", err)
+	}
+	if !strings.Contains(stdout.String(), "aws_iam_role_policy.computed: The policy is not known until apply, so can't be evaluated") ||
+		!strings.Contains(stdout.String(), `aws_iam_role.deployer.inline_policy["deploy"]: The policy is not known until apply`) ||
+		!strings.HasSuffix(stdout.String(), "FAIL\n3 passed, 0 failed, 0 skipped, 2 errored\n") {
+		t.Errorf("unexpected output:\n%s", stdout.String())
+	}
+}
+
+func TestCFN_Local(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "cfn")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		"bucket.assertions.yaml": `
+- comment: The reader can read objects
+  caller_arn: arn:aws:iam::123456789012:role/reader
+  action_names: [s3:GetObject]
+  resource_arns: ["arn:aws:s3:::data-prod/key"]
+  expected_result: allowed
+`,
+		"reader.assertions.yaml": `
+- comment: Can read objects of the bucket
+  action_names: [s3:GetObject]
+  resource_arns: ["arn:aws:s3:::data-prod/key"]
+  expected_result: allowed
+- comment: Cannot read objects of other buckets
+  action_names: [s3:GetObject]
+  resource_arns: ["arn:aws:s3:::data-test/key"]
+  expected_result: denied
+`,
+		"parameters.json": `[{"ParameterKey": "Stage", "ParameterValue": "prod"},
+			{"ParameterKey": "AWS::AccountId", "ParameterValue": "123456789012"}]`,
+	}
+	for name, content := range files {
+		if err = ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	template := `
+Parameters:
+  Stage:
+    Type: String
+Resources:
+  Bucket:
+    Type: AWS::S3::Bucket
+    Properties:
+      BucketName: !Sub data-${Stage}
+  BucketPolicy:
+    Type: AWS::S3::BucketPolicy
+    Properties:
+      Bucket: !Ref Bucket
+      PolicyDocument:
+        Statement:
+          - Effect: Allow
+            Principal:
+              AWS: !Sub arn:${AWS::Partition}:iam::${AWS::AccountId}:role/reader
+            Action: s3:GetObject
+            Resource: !Join ["", ["arn:aws:s3:::data-", !Ref Stage, "/*"]]
+  ReaderPolicy:
+    Type: AWS::IAM::ManagedPolicy
+    Properties:
+      PolicyDocument:
+        Version: 2012-10-17
+        Statement:
+          - Effect: Allow
+            Action: s3:GetObject
+            Resource: !Sub arn:aws:s3:::data-${Stage}/*
+`
+	args := []string{"assert-aws-iam-permissions", "cfn", "--local",
+		"--parameters", filepath.Join(dir, "parameters.json"),
+		"--suite", "BucketPolicy=" + filepath.Join(dir, "bucket.assertions.yaml"),
+		"--suite", "Reader*=" + filepath.Join(dir, "reader.assertions.yaml")}
+	outputs := &bytes.Buffer{}
+
+	run(args, bytes.NewBufferString(template), outputs)
+
+	expected := "ok  \tBucketPolicy\t"
+	if !strings.HasPrefix(outputs.String(), expected) || !strings.Contains(outputs.String(), "\nok  \tReaderPolicy\t") ||
+		!strings.HasSuffix(outputs.String(), "PASS\n3 passed, 0 failed, 0 skipped, 0 errored\n") {
+		t.Errorf("unexpected output:\n%s", outputs.String())
+	}
+}
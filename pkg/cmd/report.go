@@ -0,0 +1,156 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/service/iam/iamiface"
+	"github.com/matt-deboer/assert-aws-iam-permissions/pkg/report"
+	"github.com/matt-deboer/assert-aws-iam-permissions/pkg/runner"
+	"github.com/matt-deboer/assert-aws-iam-permissions/pkg/types"
+	log "github.com/sirupsen/logrus"
+	"github.com/urfave/cli"
+)
+
+func reportFlags(prefix string) []cli.Flag {
+	return []cli.Flag{
+		cli.StringFlag{
+			Name: "output",
+			Usage: `The output format, in place of the usual output: 'json' writes a document of the results of every
+			assertion, described by docs/results.schema.json, and 'sarif' writes failed assertions and policy
+			findings as a SARIF 2.1.0 log, for code scanning tools`,
+			EnvVar: prefix + "OUTPUT",
+		},
+		cli.StringFlag{
+			Name: "report-junit",
+			Usage: `A file to which a JUnit XML report of the results is written, with a testsuite per policy
+			and a testcase per evaluated action and resource of each assertion`,
+			EnvVar: prefix + "REPORT_JUNIT",
+		},
+		cli.StringFlag{
+			Name: "report-html",
+			Usage: `A file to which a self-contained HTML report of the results is written, for reviewers: each
+			policy pretty-printed with its statements annotated by the assertions which matched them, tables
+			of the assertions and evaluated actions and resources, and the policy's length against max-length`,
+			EnvVar: prefix + "REPORT_HTML",
+		},
+		cli.StringFlag{
+			Name:   "report-markdown",
+			Usage:  `A file to which a Markdown report of the results is written, with the content of the HTML report`,
+			EnvVar: prefix + "REPORT_MARKDOWN",
+		},
+	}
+}
+
+// outputFormat returns the format selected by the output flag, or "" for
+// the usual output
+func outputFormat(c *cli.Context) string {
+	switch format := c.String("output"); format {
+	case "", "json", "sarif":
+		return format
+	default:
+		argError(c, "Unknown output format '%s'; expected json or sarif", format)
+		return ""
+	}
+}
+
+// writeOutput writes the results in the format selected by the output flag
+func writeOutput(c *cli.Context, w io.Writer, results []*runner.TargetResult) {
+	var err error
+	switch outputFormat(c) {
+	case "json":
+		err = report.WriteJSON(w, results)
+	case "sarif":
+		err = report.WriteSARIF(w, results)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// writeReports writes the reports requested by the report flags
+func writeReports(c *cli.Context, results []*runner.TargetResult) {
+	if path := c.String("report-junit"); len(path) > 0 {
+		if err := writeFile(path, func(file *os.File) error { return report.WriteJUnit(file, results) }); err != nil {
+			log.Fatalf("Failed to write JUnit report; %v", err)
+		}
+	}
+	if path := c.String("report-html"); len(path) > 0 {
+		if err := writeFile(path, func(file *os.File) error { return report.WriteHTML(file, results) }); err != nil {
+			log.Fatalf("Failed to write HTML report; %v", err)
+		}
+	}
+	if path := c.String("report-markdown"); len(path) > 0 {
+		if err := writeFile(path, func(file *os.File) error { return report.WriteMarkdown(file, results) }); err != nil {
+			log.Fatalf("Failed to write Markdown report; %v", err)
+		}
+	}
+}
+
+func writeFile(path string, write func(file *os.File) error) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err = write(file); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// writeResults writes the reports and output of the main command's result,
+// failing if any assertion failed; the usual output is the document under key
+func writeResults(c *cli.Context, result *runner.TargetResult, key, policyJSON string, stdout io.Writer) {
+	results := []*runner.TargetResult{result}
+	writeReports(c, results)
+	if c.Bool("terraform") {
+		writeTerraformResult(result, key, stdout, os.Stderr)
+		return
+	}
+	writeOutput(c, stdout, results)
+	if err := resultError(result); err != nil {
+		log.Fatal(err)
+	}
+	if len(outputFormat(c)) == 0 {
+		serializeOutput(key, policyJSON, stdout)
+	}
+}
+
+// writeLengthFailure fails the main command for inputs whose policy is longer
+// than their max length, without evaluating their assertions; the reports and
+// output are written first, so that they hold the size finding
+func writeLengthFailure(c *cli.Context, inputs *types.Inputs, iamSvc iamiface.IAMAPI, err error, stdout io.Writer) {
+	unevaluated := *inputs
+	unevaluated.Assertions = nil
+	result := runner.RunInputs(&unevaluated, iamSvc)
+	result.Err = err
+	results := []*runner.TargetResult{result}
+	writeReports(c, results)
+	if !c.Bool("terraform") {
+		writeOutput(c, stdout, results)
+	}
+	log.Fatal(err)
+}
+
+// resultError returns the first evaluation error of the result, or else the
+// joined messages of all failed assertions
+func resultError(result *runner.TargetResult) error {
+	messages := []string{}
+	for _, assertion := range result.Assertions {
+		if assertion.Err != nil {
+			return assertion.Err
+		}
+		for _, evaluated := range assertion.Results {
+			if !evaluated.Passed {
+				messages = append(messages, evaluated.Message())
+			}
+		}
+	}
+	if len(messages) > 0 {
+		return fmt.Errorf("%s", strings.Join(messages, ","))
+	}
+	return nil
+}
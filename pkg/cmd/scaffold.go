@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+
+	"github.com/matt-deboer/assert-aws-iam-permissions/pkg/policy"
+	log "github.com/sirupsen/logrus"
+	"github.com/urfave/cli"
+)
+
+func scaffoldCommand(stdin io.Reader, stdout io.Writer) cli.Command {
+	prefix := "AAIP_SCAFFOLD_"
+	return cli.Command{
+		Name:  "scaffold",
+		Usage: "Generate a starter assertion suite from an existing policy",
+		Description: `Writes a JSON array of assertions for the policy document: an 'allowed' assertion per Allow
+   statement, using a representative action and a sample ARN matching each Resource pattern, and 'denied'
+   assertions for near-miss actions and resources just outside each pattern. Context entries are filled in
+   to satisfy each statement's conditions.`,
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name: "policy-json",
+				Usage: `The full contents of the IAM policy document; if empty, it is read from JSON on stdin
+				(under the key "policy_json")`,
+				EnvVar: prefix + "POLICY_JSON",
+			},
+			cli.BoolFlag{
+				Name:   "read-stdin, i",
+				Usage:  "whether to read inputs from stdin",
+				EnvVar: prefix + "READ_STDIN",
+			},
+			cli.StringFlag{
+				Name:   "output, o",
+				Usage:  `A file to which the assertions are written; if empty, they are written to stdout`,
+				EnvVar: prefix + "OUTPUT",
+			},
+		},
+		Action: func(c *cli.Context) {
+
+			if c.GlobalBool("verbose") {
+				log.SetLevel(log.DebugLevel)
+			}
+
+			policyJSON := c.String("policy-json")
+			if c.Bool("read-stdin") {
+				if stdinInputs := parseInput(stdin); len(stdinInputs.PolicyJSON) > 0 {
+					policyJSON = stdinInputs.PolicyJSON
+				}
+			}
+			if len(policyJSON) == 0 {
+				argError(c, "'policy-json' is required")
+			}
+
+			assertions, err := policy.Scaffold(policyJSON)
+			if err != nil {
+				log.Fatal(err)
+			}
+			data, err := json.MarshalIndent(assertions, "", "  ")
+			if err != nil {
+				log.Fatal(err)
+			}
+			data = append(data, '\n')
+			if output := c.String("output"); len(output) > 0 {
+				err = ioutil.WriteFile(output, data, 0644)
+			} else {
+				_, err = stdout.Write(data)
+			}
+			if err != nil {
+				log.Fatal(err)
+			}
+		},
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/iam/iamiface"
+	"github.com/matt-deboer/assert-aws-iam-permissions/pkg/server"
+	log "github.com/sirupsen/logrus"
+	"github.com/urfave/cli"
+)
+
+func serveCommand() cli.Command {
+	prefix := "AAIP_SERVE_"
+	return cli.Command{
+		Name:  "serve",
+		Usage: "Serve the evaluation of assertions over HTTP",
+		Description: `Serves the assertion API: 'POST /v1/assert' evaluates the assertions of a JSON document of the inputs
+   read from stdin by the main command (assertions, policy_json, principal_arn, trust_policy_json, max_length
+   and vars), responding with the results document described by docs/results.schema.json; 'POST /v1/validate'
+   checks the same inputs without evaluating them, responding with their errors, the policy's length and its
+   lint findings; 'GET /healthz' and 'GET /version' report the server's health and version, and 'GET /metrics'
+   exposes its metrics to Prometheus. Every request is evaluated with one IAM client, created at startup
+   (assuming the global 'assume-role-arn', if set).`,
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:   "listen",
+				Usage:  "The address on which to listen",
+				Value:  ":9090",
+				EnvVar: prefix + "LISTEN",
+			},
+			cli.BoolFlag{
+				Name: "local",
+				Usage: `Evaluate the assertions with the local engine, rather than the policy simulator, needing no
+				AWS credentials; 'principal_arn' inputs can't be evaluated locally`,
+				EnvVar: prefix + "LOCAL",
+			},
+			cli.IntFlag{
+				Name: "cache-size",
+				Usage: `The number of the most recent responses of the policy simulator to cache, answering the same
+				simulations of later requests; 0 disables the cache`,
+				Value:  1024,
+				EnvVar: prefix + "CACHE_SIZE",
+			},
+		},
+		Action: func(c *cli.Context) {
+
+			if c.GlobalBool("verbose") {
+				log.SetLevel(log.DebugLevel)
+			}
+
+			var iamSvc iamiface.IAMAPI
+			if !c.Bool("local") {
+				iamSvc = newSimulatorIAM(c)
+			}
+			handler := server.New(iamSvc, c.Int("cache-size"))
+			handler.Context = principalTagContext(c)
+			httpServer := &http.Server{
+				Addr:         c.String("listen"),
+				Handler:      handler,
+				ReadTimeout:  30 * time.Second,
+				WriteTimeout: 5 * time.Minute,
+			}
+
+			listenAndServe(httpServer)
+		},
+	}
+}
+
+// listenAndServe serves until interrupted, completing the requests in flight
+// before returning
+func listenAndServe(httpServer *http.Server) {
+	shutdown := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	signal.Notify(shutdown, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-shutdown
+		log.Info("Shutting down")
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if err := httpServer.Shutdown(ctx); err != nil {
+			log.Warnf("Failed to shut down gracefully; %v", err)
+		}
+		close(done)
+	}()
+
+	log.Infof("Listening on %s", httpServer.Addr)
+	if err := httpServer.ListenAndServe(); err != http.ErrServerClosed {
+		log.Fatal(err)
+	}
+	<-done
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/matt-deboer/assert-aws-iam-permissions/pkg/policy"
+	"github.com/matt-deboer/assert-aws-iam-permissions/pkg/runner"
+	log "github.com/sirupsen/logrus"
+)
+
+// messageFormatter formats log entries as their bare message, since terraform
+// shows the stderr of a failed external program verbatim
+type messageFormatter struct{}
+
+func (f *messageFormatter) Format(entry *log.Entry) ([]byte, error) {
+	return []byte(strings.TrimRight(entry.Message, "\n") + "\n"), nil
+}
+
+// writeTerraformResult implements the protocol of terraform's external data
+// source: on success, a JSON object of strings is written to stdout; on
+// failure, a summary of every failure is written to stderr, and the process
+// exits with status 1
+func writeTerraformResult(result *runner.TargetResult, key string, stdout, stderr io.Writer) {
+	if failures := terraformFailures(result); len(failures) > 0 {
+		fmt.Fprintln(stderr, strings.Join(failures, "\n"))
+		os.Exit(1)
+	}
+	data, err := json.Marshal(terraformOutput(result, key))
+	if err != nil {
+		log.Fatal(err)
+	}
+	stdout.Write(data)
+}
+
+// terraformFailures summarizes the failures of the result, with a line per
+// failed or errored assertion, preceded by a heading
+func terraformFailures(result *runner.TargetResult) []string {
+	lines := []string{}
+	failed := 0
+	for _, assertion := range result.Assertions {
+		switch assertion.Status {
+		case runner.Error:
+			lines = append(lines, fmt.Sprintf("ERROR  %s: %v", assertion.Name(), assertion.Err))
+		case runner.Fail:
+			evaluations := []string{}
+			for _, evaluated := range assertion.Results {
+				if evaluated.Passed {
+					continue
+				}
+				cell := ""
+				if len(evaluated.Assertion.MatrixCell) > 0 {
+					cell = evaluated.Assertion.MatrixCell + " "
+				}
+				evaluations = append(evaluations, fmt.Sprintf("%s%s on %s is '%s', expected '%s'",
+					cell, evaluated.Action, evaluated.Resource, evaluated.Decision, evaluated.Assertion.ExpectedResult))
+			}
+			lines = append(lines, fmt.Sprintf("FAIL   %s: %s", assertion.Name(), strings.Join(evaluations, "; ")))
+		default:
+			continue
+		}
+		failed++
+	}
+	if len(lines) == 0 {
+		return nil
+	}
+	return append([]string{fmt.Sprintf("%d of %d assertions failed for %s:", failed, len(result.Assertions), result.Target.Name)}, lines...)
+}
+
+// terraformOutput is the result of the data source: the policy document under
+// key, and attributes of the policy and its evaluation, all as strings since
+// terraform accepts nothing else
+func terraformOutput(result *runner.TargetResult, key string) map[string]string {
+	// the digest of the compacted document is unaffected by formatting
+	compacted := &bytes.Buffer{}
+	if err := json.Compact(compacted, []byte(result.PolicyJSON)); err != nil {
+		compacted.Reset()
+		compacted.WriteString(result.PolicyJSON)
+	}
+	digest := sha256.Sum256(compacted.Bytes())
+	statements := 0
+	if doc, err := policy.ParseDocument(result.PolicyJSON); err == nil {
+		statements = len(doc.Statement)
+	}
+	return map[string]string{
+		key:               result.PolicyJSON,
+		"policy_sha256":   hex.EncodeToString(digest[:]),
+		"minified_length": strconv.Itoa(policy.PolicyLength(result.PolicyJSON)),
+		"assertion_count": strconv.Itoa(len(result.Assertions)),
+		"statement_count": strconv.Itoa(statements),
+		"engine":          result.Engine,
+	}
+}
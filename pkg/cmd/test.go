@@ -0,0 +1,114 @@
+package main
+
+import (
+	"io"
+	"os"
+	"regexp"
+
+	"github.com/matt-deboer/assert-aws-iam-permissions/pkg/runner"
+	log "github.com/sirupsen/logrus"
+	"github.com/urfave/cli"
+)
+
+func testCommand(stdout io.Writer) cli.Command {
+	prefix := "AAIP_TEST_"
+	return cli.Command{
+		Name:      "test",
+		Usage:     "Run the assertion suites of a tree of policies",
+		ArgsUsage: "[dir | dir/... | suite-file]...",
+		Description: `Discovers assertion suite files, named <name>.assertions.yaml (or .yml or .json), and evaluates
+   each against the policy next to it, named <name>.json or <name>.policy.json; policies named
+   <name>.trust.json are evaluated as role trust policies. A directory followed by '/...' includes its
+   subdirectories. Prints the failures of each policy and a summary of passed, failed, skipped and
+   errored assertions, failing if any assertion failed or could not be evaluated. Policies longer than the
+   global 'max-length' option are errored.`,
+		Flags: runFlags(prefix),
+		Action: func(c *cli.Context) {
+
+			if c.GlobalBool("verbose") {
+				log.SetLevel(log.DebugLevel)
+			}
+
+			options := runOptions(c)
+			targets, err := runner.Discover(c.Args())
+			if err != nil {
+				log.Fatal(err)
+			}
+			if len(targets) == 0 {
+				argError(c, "No assertion suite files found")
+			}
+			if !c.Bool("local") {
+				options.IAM = newSimulatorIAM(c)
+			}
+
+			writeRun(c, stdout, runner.Run(targets, options))
+		},
+	}
+}
+
+// runFlags are the flags of the commands running assertion suites
+func runFlags(prefix string) []cli.Flag {
+	return append([]cli.Flag{
+		cli.StringFlag{
+			Name:   "run",
+			Usage:  `Run only the assertions whose comments match this regular expression`,
+			EnvVar: prefix + "RUN",
+		},
+		cli.StringFlag{
+			Name: "tags",
+			Usage: `A comma-separated list of tags; only assertions having any of the tags are run, and
+			assertions having a tag prefixed by '!' (e.g. "prod,!slow") are skipped`,
+			EnvVar: prefix + "TAGS",
+		},
+		cli.BoolFlag{
+			Name:   "fail-fast",
+			Usage:  "Stop at the first failed or errored assertion, rather than running every suite",
+			EnvVar: prefix + "FAIL_FAST",
+		},
+		cli.BoolFlag{
+			Name:   "v",
+			Usage:  "List every assertion, rather than only those which failed",
+			EnvVar: prefix + "V",
+		},
+		cli.BoolFlag{
+			Name:   "local",
+			Usage:  "Evaluate assertions locally, rather than with the AWS policy simulator",
+			EnvVar: prefix + "LOCAL",
+		},
+	}, reportFlags(prefix)...)
+}
+
+// runOptions builds the options of a run from the flags of runFlags
+func runOptions(c *cli.Context) *runner.Options {
+	options := &runner.Options{
+		FailFast:  c.Bool("fail-fast"),
+		Vars:      resolveVars(c, nil),
+		MaxLength: c.GlobalInt("max-length"),
+		Context:   principalTagContext(c),
+	}
+	if run := c.String("run"); len(run) > 0 {
+		pattern, err := regexp.Compile(run)
+		if err != nil {
+			argError(c, "Invalid 'run' expression; %v", err)
+		}
+		options.Run = pattern
+	}
+	if tags := c.String("tags"); len(tags) > 0 {
+		options.Tags = runner.ParseTagFilter(tags)
+	}
+	return options
+}
+
+// writeRun writes the output and reports of a run, exiting with status 1 if
+// any assertion failed or errored
+func writeRun(c *cli.Context, stdout io.Writer, results []*runner.TargetResult) {
+	if len(outputFormat(c)) > 0 {
+		writeOutput(c, stdout, results)
+	} else {
+		runner.Write(stdout, results, c.Bool("v"))
+	}
+	writeReports(c, results)
+	if !runner.Summarize(results).Ok() {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/matt-deboer/assert-aws-iam-permissions/pkg/runner"
+	"github.com/matt-deboer/assert-aws-iam-permissions/pkg/tfplan"
+	log "github.com/sirupsen/logrus"
+	"github.com/urfave/cli"
+)
+
+func tfPlanCommand(stdin io.Reader, stdout io.Writer) cli.Command {
+	prefix := "AAIP_TF_PLAN_"
+	return cli.Command{
+		Name:      "tf-plan",
+		Usage:     "Run assertion suites against the policies of a terraform plan",
+		ArgsUsage: "[plan.json | -]",
+		Description: `Reads the output of 'terraform show -json' (of a plan, or of a state) from the named file or stdin,
+   and extracts the policy documents of its resources: identity policies (aws_iam_policy, aws_iam_role_policy,
+   aws_iam_user_policy, aws_iam_group_policy and the inline policies of aws_iam_role), role trust policies
+   (assume_role_policy) and resource policies (aws_s3_bucket_policy, aws_sqs_queue_policy, aws_sns_topic_policy,
+   aws_kms_key, aws_ecr_repository_policy, aws_secretsmanager_secret_policy and others). Each policy is
+   evaluated against the suite files of the 'suite' rules matching it, with the output, reports and exit status
+   of the 'test' command. Resource policies are evaluated on their own, as the resource_policy of each
+   assertion, for a 'caller_arn' in the resource's account. Policies not known until apply can't be evaluated,
+   so error the suites matching them.`,
+		Flags: append([]cli.Flag{
+			cli.StringSliceFlag{
+				Name: "suite",
+				Usage: `A rule of the form PATTERN=FILE, evaluating the assertion suite FILE against the policies of the
+				resources matching PATTERN: an address in which '*' matches any characters (e.g.
+				"module.app.aws_iam_role_policy.*"), or a tag of the form tag:Key=Value; may be repeated`,
+				EnvVar: prefix + "SUITE",
+			},
+			cli.BoolFlag{
+				Name: "require-suite",
+				Usage: `Fail for policies matched by no 'suite' rule, rather than warning of them; policies not known
+				until apply fail the run whenever a rule matches them, with or without this flag`,
+				EnvVar: prefix + "REQUIRE_SUITE",
+			},
+		}, runFlags(prefix)...),
+		Action: func(c *cli.Context) {
+
+			if c.GlobalBool("verbose") {
+				log.SetLevel(log.DebugLevel)
+			}
+			checkTokenStdin(c, !c.Bool("local") && (len(c.Args().First()) == 0 || c.Args().First() == "-"))
+
+			rules := suiteRules(c)
+			options := runOptions(c)
+
+			var data []byte
+			var err error
+			if path := c.Args().First(); len(path) > 0 && path != "-" {
+				data, err = ioutil.ReadFile(path)
+			} else {
+				data, err = ioutil.ReadAll(stdin)
+			}
+			if err != nil {
+				log.Fatalf("Failed to read terraform plan; %v", err)
+			}
+			policies, err := tfplan.Extract(data)
+			if err != nil {
+				log.Fatal(err)
+			}
+
+			extracted := []*extractedPolicy{}
+			for _, p := range policies {
+				policy := &extractedPolicy{Address: p.Address, Kind: p.Kind, Document: p.Document, Tags: p.Tags}
+				if p.Unknown {
+					policy.Err = fmt.Errorf("The policy is not known until apply, so can't be evaluated")
+				}
+				extracted = append(extracted, policy)
+			}
+			writeRun(c, stdout, runPolicies(c, rules, extracted, options))
+		},
+	}
+}
+
+// extractedPolicy is a policy document extracted from the resources of a
+// terraform plan or CloudFormation template
+type extractedPolicy struct {
+	Address  string
+	Kind     string
+	Document string
+	Tags     map[string]string
+	// Err is set when the document could not be extracted
+	Err error
+}
+
+// suiteRules parses the 'suite' rules of a command
+func suiteRules(c *cli.Context) []*tfplan.Rule {
+	rules := []*tfplan.Rule{}
+	for _, definition := range c.StringSlice("suite") {
+		rule, err := tfplan.ParseRule(definition)
+		if err != nil {
+			argError(c, "%v", err)
+		}
+		rules = append(rules, rule)
+	}
+	if len(rules) == 0 {
+		argError(c, "At least one 'suite' rule is required")
+	}
+	return rules
+}
+
+// runPolicies evaluates each policy against the suites of the rules matching
+// it; policies matched by no rule are warned of, or errored with the
+// 'require-suite' flag
+func runPolicies(c *cli.Context, rules []*tfplan.Rule, policies []*extractedPolicy, options *runner.Options) []*runner.TargetResult {
+	targets := []*runner.Target{}
+	errored := []*runner.TargetResult{}
+	for _, p := range policies {
+		files := tfplan.Match(rules, p.Address, p.Tags)
+		if len(files) == 0 {
+			if !c.Bool("require-suite") {
+				log.Warnf("No assertion suite matches %s", p.Address)
+				continue
+			}
+			errored = append(errored, &runner.TargetResult{
+				Target:     &runner.Target{Name: p.Address, PolicyJSON: p.Document},
+				PolicyJSON: p.Document,
+				Err:        fmt.Errorf("No assertion suite matches %s", p.Address),
+			})
+		}
+		for _, file := range files {
+			target := &runner.Target{
+				Name:           p.Address,
+				PolicyJSON:     p.Document,
+				AssertionsFile: file,
+				Trust:          p.Kind == tfplan.Trust,
+				Resource:       p.Kind == tfplan.Resource,
+			}
+			if p.Err != nil {
+				errored = append(errored, &runner.TargetResult{Target: target, Err: fmt.Errorf("%s: %v", p.Address, p.Err)})
+				continue
+			}
+			targets = append(targets, target)
+		}
+	}
+	log.Debugf("Found %d policies, and %d suites to run", len(policies), len(targets))
+	if !c.Bool("local") {
+		options.IAM = newSimulatorIAM(c)
+	}
+
+	results := append(errored, runner.Run(targets, options)...)
+	if len(results) == 0 {
+		log.Warn("No policies matched the suite rules")
+	}
+	return results
+}
@@ -0,0 +1,271 @@
+package drift
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// the statement elements which may be written as a single string or an array
+var listElements = map[string]bool{
+	"Action":      true,
+	"NotAction":   true,
+	"Resource":    true,
+	"NotResource": true,
+}
+
+// Diff compares two policy documents semantically, returning a line per
+// difference; whitespace, key order, the order of values and statements,
+// and single values written without an array are not differences
+func Diff(expectedJSON, deployedJSON string) ([]string, error) {
+	expected, err := normalize(expectedJSON)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse expected policy document; %v", err)
+	}
+	deployed, err := normalize(deployedJSON)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse deployed policy document; %v", err)
+	}
+	differences := []string{}
+	diffDocuments(expected, deployed, &differences)
+	return differences, nil
+}
+
+// normalize parses a policy document, converting the elements which accept
+// either form to arrays, and a lone statement object to a statement array
+func normalize(policyJSON string) (map[string]interface{}, error) {
+	var doc map[string]interface{}
+	if err := json.Unmarshal([]byte(policyJSON), &doc); err != nil {
+		return nil, err
+	}
+	statements, ok := doc["Statement"].([]interface{})
+	if statement, isObject := doc["Statement"].(map[string]interface{}); isObject {
+		statements, ok = []interface{}{statement}, true
+	}
+	if !ok {
+		return doc, nil
+	}
+	for _, s := range statements {
+		statement, isObject := s.(map[string]interface{})
+		if !isObject {
+			continue
+		}
+		for key, value := range statement {
+			switch {
+			case listElements[key]:
+				statement[key] = toList(value)
+			case key == "Principal" || key == "NotPrincipal":
+				if principals, isObject := value.(map[string]interface{}); isObject {
+					for principalType, ids := range principals {
+						principals[principalType] = toList(ids)
+					}
+				}
+			case key == "Condition":
+				if operators, isObject := value.(map[string]interface{}); isObject {
+					for _, conditions := range operators {
+						if keys, isObject := conditions.(map[string]interface{}); isObject {
+							for conditionKey, values := range keys {
+								keys[conditionKey] = toList(values)
+							}
+						}
+					}
+				}
+			}
+		}
+	}
+	doc["Statement"] = statements
+	return doc, nil
+}
+
+func toList(value interface{}) interface{} {
+	if _, isString := value.(string); isString {
+		return []interface{}{value}
+	}
+	return value
+}
+
+func diffDocuments(expected, deployed map[string]interface{}, differences *[]string) {
+	for _, key := range unionKeys(expected, deployed) {
+		if key == "Statement" {
+			expectedStatements, _ := expected[key].([]interface{})
+			deployedStatements, _ := deployed[key].([]interface{})
+			diffStatements(expectedStatements, deployedStatements, differences)
+			continue
+		}
+		diffValues(key, expected[key], deployed[key], differences)
+	}
+}
+
+// diffStatements pairs statements by Sid; statements without a Sid are
+// paired with an identical statement where there is one, and otherwise in
+// the order they appear
+func diffStatements(expected, deployed []interface{}, differences *[]string) {
+	bySid := map[string]interface{}{}
+	unnamed := []interface{}{}
+	for _, statement := range deployed {
+		if sid := sidOf(statement); len(sid) > 0 {
+			bySid[sid] = statement
+		} else {
+			unnamed = append(unnamed, statement)
+		}
+	}
+
+	unmatched := []interface{}{}
+	for _, statement := range expected {
+		sid := sidOf(statement)
+		if len(sid) == 0 {
+			if i := indexOf(unnamed, statement); i >= 0 {
+				unnamed = append(unnamed[:i], unnamed[i+1:]...)
+			} else {
+				unmatched = append(unmatched, statement)
+			}
+			continue
+		}
+		path := fmt.Sprintf("Statement[%s]", sid)
+		if counterpart, ok := bySid[sid]; ok {
+			diffValues(path, statement, counterpart, differences)
+			delete(bySid, sid)
+		} else {
+			*differences = append(*differences, fmt.Sprintf("- %s: %s", path, canonical(statement)))
+		}
+	}
+	for i, statement := range unmatched {
+		path := fmt.Sprintf("Statement[%d]", indexOf(expected, statement))
+		if i < len(unnamed) {
+			diffValues(path, statement, unnamed[i], differences)
+		} else {
+			*differences = append(*differences, fmt.Sprintf("- %s: %s", path, canonical(statement)))
+		}
+	}
+	for i := len(unmatched); i < len(unnamed); i++ {
+		*differences = append(*differences, fmt.Sprintf("+ Statement[%d]: %s", indexOf(deployed, unnamed[i]), canonical(unnamed[i])))
+	}
+	for _, statement := range deployed {
+		if sid := sidOf(statement); len(sid) > 0 {
+			if _, added := bySid[sid]; added {
+				*differences = append(*differences, fmt.Sprintf("+ Statement[%s]: %s", sid, canonical(statement)))
+			}
+		}
+	}
+}
+
+// diffValues compares two elements; objects are compared key by key, and
+// arrays of strings as unordered sets
+func diffValues(path string, expected, deployed interface{}, differences *[]string) {
+	switch {
+	case expected == nil:
+		*differences = append(*differences, fmt.Sprintf("+ %s: %s", path, canonical(deployed)))
+		return
+	case deployed == nil:
+		*differences = append(*differences, fmt.Sprintf("- %s: %s", path, canonical(expected)))
+		return
+	}
+	expectedMap, expectedIsMap := expected.(map[string]interface{})
+	deployedMap, deployedIsMap := deployed.(map[string]interface{})
+	if expectedIsMap && deployedIsMap {
+		for _, key := range unionKeys(expectedMap, deployedMap) {
+			diffValues(path+"."+key, expectedMap[key], deployedMap[key], differences)
+		}
+		return
+	}
+	expectedSet, expectedIsSet := stringSet(expected)
+	deployedSet, deployedIsSet := stringSet(deployed)
+	if expectedIsSet && deployedIsSet {
+		for _, value := range sortedKeys(expectedSet) {
+			if !deployedSet[value] {
+				*differences = append(*differences, fmt.Sprintf("- %s: %q", path, value))
+			}
+		}
+		for _, value := range sortedKeys(deployedSet) {
+			if !expectedSet[value] {
+				*differences = append(*differences, fmt.Sprintf("+ %s: %q", path, value))
+			}
+		}
+		return
+	}
+	if canonical(expected) != canonical(deployed) {
+		*differences = append(*differences, fmt.Sprintf("~ %s: %s -> %s", path, canonical(expected), canonical(deployed)))
+	}
+}
+
+func stringSet(value interface{}) (map[string]bool, bool) {
+	values, ok := value.([]interface{})
+	if !ok {
+		return nil, false
+	}
+	set := map[string]bool{}
+	for _, v := range values {
+		s, isString := v.(string)
+		if !isString {
+			return nil, false
+		}
+		set[s] = true
+	}
+	return set, true
+}
+
+func sidOf(statement interface{}) string {
+	if s, ok := statement.(map[string]interface{}); ok {
+		sid, _ := s["Sid"].(string)
+		return sid
+	}
+	return ""
+}
+
+func indexOf(statements []interface{}, statement interface{}) int {
+	target := canonical(statement)
+	for i, s := range statements {
+		if canonical(s) == target {
+			return i
+		}
+	}
+	return -1
+}
+
+// canonical serializes a value with sorted keys and sorted string arrays,
+// so that semantically equal values serialize identically
+func canonical(value interface{}) string {
+	data, _ := json.Marshal(sortSets(value))
+	return string(data)
+}
+
+func sortSets(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		sorted := map[string]interface{}{}
+		for key, child := range v {
+			sorted[key] = sortSets(child)
+		}
+		return sorted
+	case []interface{}:
+		if set, ok := stringSet(v); ok {
+			return sortedKeys(set)
+		}
+		sorted := []interface{}{}
+		for _, child := range v {
+			sorted = append(sorted, sortSets(child))
+		}
+		return sorted
+	}
+	return value
+}
+
+func unionKeys(a, b map[string]interface{}) []string {
+	keys := map[string]bool{}
+	for key := range a {
+		keys[key] = true
+	}
+	for key := range b {
+		keys[key] = true
+	}
+	return sortedKeys(keys)
+}
+
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,143 @@
+// Package drift compares deployed managed policies with their expected documents
+package drift // import "github.com/matt-deboer/assert-aws-iam-permissions/pkg/drift"
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/aws/aws-sdk-go/service/iam/iamiface"
+	"github.com/matt-deboer/assert-aws-iam-permissions/pkg/policy"
+	"github.com/matt-deboer/assert-aws-iam-permissions/pkg/types"
+)
+
+// Target is a deployed managed policy, along with its expected document and
+// the assertions made about it
+type Target struct {
+	PolicyArn  string             `json:"policy_arn"`
+	PolicyJSON string             `json:"policy_json"`
+	Assertions []*types.Assertion `json:"assertions"`
+}
+
+// Change is an assertion result which differs between the expected and
+// the deployed policy documents
+type Change struct {
+	Expected *policy.Result
+	Deployed *policy.Result
+}
+
+// Report describes the drift of a deployed policy from its expected document
+type Report struct {
+	Target    *Target
+	VersionID string
+	// Differences holds a line per semantic difference between the documents
+	Differences []string
+	// Changes holds the assertion results which changed
+	Changes []*Change
+}
+
+// Drifted reports whether the deployed policy differs from the expected one
+func (r *Report) Drifted() bool {
+	return len(r.Differences) > 0 || len(r.Changes) > 0
+}
+
+// LoadTargets reads a JSON array of targets
+func LoadTargets(r io.Reader) ([]*Target, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	var targets []*Target
+	if err = json.Unmarshal(data, &targets); err != nil {
+		return nil, fmt.Errorf("Failed to parse drift targets; %v", err)
+	}
+	return targets, nil
+}
+
+// FetchDefaultVersion retrieves the document of the default version of a
+// managed policy, returning the version ID along with the document JSON
+func FetchDefaultVersion(iamSvc iamiface.IAMAPI, policyArn string) (string, string, error) {
+	policyOutput, err := iamSvc.GetPolicy(&iam.GetPolicyInput{PolicyArn: aws.String(policyArn)})
+	if err != nil {
+		return "", "", fmt.Errorf("Failed to get policy %s; %v", policyArn, err)
+	}
+	versionID := policyOutput.Policy.DefaultVersionId
+	versionOutput, err := iamSvc.GetPolicyVersion(&iam.GetPolicyVersionInput{
+		PolicyArn: aws.String(policyArn),
+		VersionId: versionID,
+	})
+	if err != nil {
+		return "", "", fmt.Errorf("Failed to get version %s of policy %s; %v", aws.StringValue(versionID), policyArn, err)
+	}
+	document, err := url.PathUnescape(aws.StringValue(versionOutput.PolicyVersion.Document))
+	if err != nil {
+		return "", "", fmt.Errorf("Failed to decode version %s of policy %s; %v", aws.StringValue(versionID), policyArn, err)
+	}
+	return aws.StringValue(versionID), document, nil
+}
+
+// Check fetches the deployed version of the target policy, compares it with
+// the expected document, and re-runs the target's assertions against both;
+// assertions are evaluated by the policy simulator when evalSvc is provided
+// and by the local engine otherwise
+func Check(iamSvc iamiface.IAMAPI, target *Target, evalSvc iamiface.IAMAPI) (*Report, error) {
+	versionID, deployedJSON, err := FetchDefaultVersion(iamSvc, target.PolicyArn)
+	if err != nil {
+		return nil, err
+	}
+	report := &Report{Target: target, VersionID: versionID}
+	if report.Differences, err = Diff(target.PolicyJSON, deployedJSON); err != nil {
+		return nil, fmt.Errorf("%s: %v", target.PolicyArn, err)
+	}
+	if len(target.Assertions) == 0 {
+		return report, nil
+	}
+
+	expected, err := policy.EvaluatePolicies(evalSvc, target.Assertions, []string{target.PolicyJSON})
+	if err != nil {
+		return nil, fmt.Errorf("Failed to evaluate the expected document of %s; %v", target.PolicyArn, err)
+	}
+	deployed, err := policy.EvaluatePolicies(evalSvc, target.Assertions, []string{deployedJSON})
+	if err != nil {
+		return nil, fmt.Errorf("Failed to evaluate the deployed document of %s; %v", target.PolicyArn, err)
+	}
+	// both evaluations expand the same assertions, so their results align
+	for i := range expected {
+		if i < len(deployed) && (expected[i].Decision != deployed[i].Decision || expected[i].Passed != deployed[i].Passed) {
+			report.Changes = append(report.Changes, &Change{Expected: expected[i], Deployed: deployed[i]})
+		}
+	}
+	return report, nil
+}
+
+// Message describes the changed outcome of an assertion
+func (c *Change) Message() string {
+	status := "now passes"
+	if !c.Deployed.Passed {
+		status = "now fails"
+	}
+	return fmt.Sprintf("[ASSERTION OUTCOME CHANGED] %s ( for %s [ %s ]: expected '%s', got '%s' from policy_json but '%s' from the deployed version; %s )",
+		c.Expected.Assertion.Comment, c.Expected.Action, c.Expected.Resource, c.Expected.Assertion.ExpectedResult,
+		c.Expected.Decision, c.Deployed.Decision, status)
+}
+
+// Write prints the report: a status line for the policy, followed by the
+// document differences and changed assertion outcomes
+func (r *Report) Write(w io.Writer) {
+	status := "in sync"
+	if r.Drifted() {
+		status = "DRIFTED"
+	}
+	fmt.Fprintf(w, "%s (%s): %s\n", r.Target.PolicyArn, r.VersionID, status)
+	if len(r.Differences) > 0 {
+		fmt.Fprintf(w, "    %s\n", strings.Join(r.Differences, "\n    "))
+	}
+	for _, change := range r.Changes {
+		fmt.Fprintf(w, "    %s\n", change.Message())
+	}
+}
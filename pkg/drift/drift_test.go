@@ -0,0 +1,151 @@
+package drift
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/matt-deboer/assert-aws-iam-permissions/pkg/fakeiam"
+	"github.com/matt-deboer/assert-aws-iam-permissions/pkg/types"
+)
+
+// newFakeIAM starts a fake IAM server for an account holding the provided
+// documents as the default version (v2) of each managed policy
+func newFakeIAM(t *testing.T, deployed map[string]string) (*httptest.Server, *iam.IAM) {
+	details := &iam.GetAccountAuthorizationDetailsOutput{}
+	for policyArn, document := range deployed {
+		details.Policies = append(details.Policies, &iam.ManagedPolicyDetail{
+			Arn:              aws.String(policyArn),
+			PolicyName:       aws.String(policyArn[strings.LastIndex(policyArn, "/")+1:]),
+			DefaultVersionId: aws.String("v2"),
+			PolicyVersionList: []*iam.PolicyVersion{
+				{VersionId: aws.String("v2"), IsDefaultVersion: aws.Bool(true), Document: aws.String(document)},
+			},
+		})
+	}
+	handler, err := fakeiam.New(details)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(handler)
+
+	sess := session.Must(session.NewSession(&aws.Config{
+		Region:      aws.String("us-east-1"),
+		Endpoint:    aws.String(server.URL),
+		Credentials: credentials.NewStaticCredentials("AKID", "SECRET", ""),
+	}))
+	return server, iam.New(sess)
+}
+
+const expectedPolicy = `{
+	"Version": "2012-10-17",
+	"Statement": [
+		{"Sid": "Read", "Effect": "Allow", "Action": ["s3:GetObject", "s3:ListBucket"], "Resource": "arn:aws:s3:::bucket/*"},
+		{"Effect": "Deny", "Action": "s3:DeleteObject", "Resource": "*"}
+	]
+}`
+
+func TestDiff(t *testing.T) {
+	// reordered, reformatted and with single values written as arrays
+	equivalent := `{"Statement": [{"Action": ["s3:DeleteObject"], "Effect": "Deny", "Resource": ["*"]},
+		{"Resource": ["arn:aws:s3:::bucket/*"], "Sid": "Read", "Effect": "Allow", "Action": ["s3:ListBucket", "s3:GetObject"]}],
+		"Version": "2012-10-17"}`
+	differences, err := Diff(expectedPolicy, equivalent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(differences) > 0 {
+		t.Errorf("expected no differences, but got %v", differences)
+	}
+
+	edited := `{"Version": "2012-10-17", "Statement": [
+		{"Sid": "Read", "Effect": "Allow", "Action": ["s3:GetObject", "s3:PutObject"], "Resource": "arn:aws:s3:::bucket/*"},
+		{"Sid": "Console", "Effect": "Allow", "Action": "iam:*", "Resource": "*"}
+	]}`
+	differences, err = Diff(expectedPolicy, edited)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		`- Statement[Read].Action: "s3:ListBucket"`,
+		`+ Statement[Read].Action: "s3:PutObject"`,
+		`- Statement[1]: {"Action":["s3:DeleteObject"],"Effect":"Deny","Resource":["*"]}`,
+		`+ Statement[Console]: {"Action":["iam:*"],"Effect":"Allow","Resource":["*"],"Sid":"Console"}`,
+	}
+	if strings.Join(differences, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("expected differences:\n%s\nbut got:\n%s", strings.Join(expected, "\n"), strings.Join(differences, "\n"))
+	}
+}
+
+func TestCheck(t *testing.T) {
+	server, iamSvc := newFakeIAM(t, map[string]string{
+		"arn:aws:iam::123456789012:policy/in-sync": `{"Version":"2012-10-17","Statement":[` +
+			`{"Effect":"Deny","Action":"s3:DeleteObject","Resource":"*"},` +
+			`{"Sid":"Read","Effect":"Allow","Action":["s3:ListBucket","s3:GetObject"],"Resource":"arn:aws:s3:::bucket/*"}]}`,
+		"arn:aws:iam::123456789012:policy/edited": `{"Version":"2012-10-17","Statement":[` +
+			`{"Sid":"Read","Effect":"Allow","Action":["s3:GetObject","s3:ListBucket","s3:DeleteObject"],"Resource":"arn:aws:s3:::bucket/*"}]}`,
+	})
+	defer server.Close()
+
+	assertions := []*types.Assertion{
+		&types.Assertion{
+			Comment:        "objects can be read",
+			ActionNames:    []string{"s3:GetObject"},
+			ResourceArns:   []string{"arn:aws:s3:::bucket/key"},
+			ExpectedResult: "allowed",
+		},
+		&types.Assertion{
+			Comment:        "objects can't be deleted",
+			ActionNames:    []string{"s3:DeleteObject"},
+			ResourceArns:   []string{"arn:aws:s3:::bucket/key"},
+			ExpectedResult: "denied",
+		},
+	}
+
+	report, err := Check(iamSvc, &Target{
+		PolicyArn:  "arn:aws:iam::123456789012:policy/in-sync",
+		PolicyJSON: expectedPolicy,
+		Assertions: assertions,
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Drifted() || report.VersionID != "v2" {
+		t.Errorf("expected version v2 to be in sync, but got %s with %v", report.VersionID, report.Differences)
+	}
+
+	report, err = Check(iamSvc, &Target{
+		PolicyArn:  "arn:aws:iam::123456789012:policy/edited",
+		PolicyJSON: expectedPolicy,
+		Assertions: assertions,
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.Drifted() || len(report.Differences) != 2 {
+		t.Errorf("expected 2 differences, but got %v", report.Differences)
+	}
+	if len(report.Changes) != 1 {
+		t.Fatalf("expected 1 changed outcome, but got %d", len(report.Changes))
+	}
+	message := "[ASSERTION OUTCOME CHANGED] objects can't be deleted ( for s3:DeleteObject [ arn:aws:s3:::bucket/key ]: " +
+		"expected 'denied', got 'explicitDeny' from policy_json but 'allowed' from the deployed version; now fails )"
+	if report.Changes[0].Message() != message {
+		t.Errorf("expected message:\n%s\nbut got:\n%s", message, report.Changes[0].Message())
+	}
+	output := &bytes.Buffer{}
+	report.Write(output)
+	if !strings.HasPrefix(output.String(), "arn:aws:iam::123456789012:policy/edited (v2): DRIFTED\n") {
+		t.Errorf("unexpected report:\n%s", output.String())
+	}
+
+	_, err = Check(iamSvc, &Target{PolicyArn: "arn:aws:iam::123456789012:policy/missing", PolicyJSON: expectedPolicy}, nil)
+	if err == nil || !strings.Contains(err.Error(), "NoSuchEntity") {
+		t.Errorf("expected a NoSuchEntity error, but got %v", err)
+	}
+}
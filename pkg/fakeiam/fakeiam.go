@@ -0,0 +1,341 @@
+// Package fakeiam serves a stand-in for the IAM API, answering the requests
+// of the unmodified SDK client in the IAM Query protocol, for testing without
+// AWS; simulations are evaluated by the local engine, and the users, groups,
+// roles and managed policies of the account are those of a saved
+// GetAccountAuthorizationDetails response
+package fakeiam // import "github.com/matt-deboer/assert-aws-iam-permissions/pkg/fakeiam"
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync/atomic"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awsutil"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/matt-deboer/assert-aws-iam-permissions/pkg/audit"
+	"github.com/matt-deboer/assert-aws-iam-permissions/pkg/policy"
+	log "github.com/sirupsen/logrus"
+)
+
+// namespace is the XML namespace of the responses of the IAM API
+const namespace = "https://iam.amazonaws.com/doc/2010-05-08/"
+
+// awsManagedPolicyPrefix prefixes the ARNs of the managed policies of AWS
+const awsManagedPolicyPrefix = "arn:aws:iam::aws:policy/"
+
+// Server answers the IAM API's SimulateCustomPolicy, SimulatePrincipalPolicy,
+// GetContextKeysForCustomPolicy, GetContextKeysForPrincipalPolicy, GetPolicy,
+// GetPolicyVersion and GetAccountAuthorizationDetails operations; request
+// signatures aren't checked, so any credentials may be used
+type Server struct {
+	details    *iam.GetAccountAuthorizationDetailsOutput
+	principals map[string]*audit.Principal
+	requests   uint64
+}
+
+// New creates a server for an account holding the authorization details,
+// which may be nil for an account without principals or managed policies;
+// policy documents may be given in either form accepted by audit.LoadDetails.
+// The details are copied, so the caller's are left as they were.
+func New(details *iam.GetAccountAuthorizationDetailsOutput) (*Server, error) {
+	if details == nil {
+		details = &iam.GetAccountAuthorizationDetailsOutput{}
+	}
+	details = awsutil.CopyOf(details).(*iam.GetAccountAuthorizationDetailsOutput)
+	resolved, err := audit.ResolvePrincipals(details)
+	if err != nil {
+		return nil, err
+	}
+	principals := map[string]*audit.Principal{}
+	for _, principal := range resolved {
+		principals[principal.Arn] = principal
+	}
+	encodeDocuments(details)
+	details.IsTruncated = aws.Bool(false)
+	return &Server{details: details, principals: principals}, nil
+}
+
+// encodeDocuments URL-encodes the policy documents of the authorization
+// details, as they're returned by the IAM API
+func encodeDocuments(details *iam.GetAccountAuthorizationDetailsOutput) {
+	encode := func(document *string) *string {
+		if document == nil || !strings.HasPrefix(strings.TrimSpace(*document), "{") {
+			return document
+		}
+		return aws.String(url.PathEscape(*document))
+	}
+	encodeInline := func(policies []*iam.PolicyDetail) {
+		for _, p := range policies {
+			p.PolicyDocument = encode(p.PolicyDocument)
+		}
+	}
+	for _, user := range details.UserDetailList {
+		encodeInline(user.UserPolicyList)
+	}
+	for _, group := range details.GroupDetailList {
+		encodeInline(group.GroupPolicyList)
+	}
+	for _, role := range details.RoleDetailList {
+		encodeInline(role.RolePolicyList)
+		role.AssumeRolePolicyDocument = encode(role.AssumeRolePolicyDocument)
+	}
+	for _, p := range details.Policies {
+		for _, version := range p.PolicyVersionList {
+			version.Document = encode(version.Document)
+		}
+	}
+}
+
+// apiError is an error response of the IAM API
+type apiError struct {
+	Status  int
+	Code    string
+	Message string
+}
+
+func (e *apiError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Code, e.Message)
+}
+
+func noSuchEntity(format string, args ...interface{}) *apiError {
+	return &apiError{Status: http.StatusNotFound, Code: "NoSuchEntity", Message: fmt.Sprintf(format, args...)}
+}
+
+func invalidInput(format string, args ...interface{}) *apiError {
+	return &apiError{Status: http.StatusBadRequest, Code: "InvalidInput", Message: fmt.Sprintf(format, args...)}
+}
+
+// operations returns the handler of each operation, each taking a pointer to
+// the SDK's input type and returning a pointer to its output type
+func (s *Server) operations() map[string]interface{} {
+	return map[string]interface{}{
+		"SimulateCustomPolicy":             s.simulateCustomPolicy,
+		"SimulatePrincipalPolicy":          s.simulatePrincipalPolicy,
+		"GetContextKeysForCustomPolicy":    s.getContextKeysForCustomPolicy,
+		"GetContextKeysForPrincipalPolicy": s.getContextKeysForPrincipalPolicy,
+		"GetPolicy":                        s.getPolicy,
+		"GetPolicyVersion":                 s.getPolicyVersion,
+		"GetAccountAuthorizationDetails":   s.getAccountAuthorizationDetails,
+	}
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	requestID := fmt.Sprintf("00000000-0000-0000-0000-%012d", atomic.AddUint64(&s.requests, 1))
+	if err := r.ParseForm(); err != nil {
+		writeError(w, requestID, invalidInput("Failed to parse the request; %v", err))
+		return
+	}
+	action := r.Form.Get("Action")
+	log.Debugf("%s %s", requestID, action)
+	operation, ok := s.operations()[action]
+	if !ok {
+		writeError(w, requestID, &apiError{Status: http.StatusBadRequest, Code: "InvalidAction",
+			Message: fmt.Sprintf("Could not find operation %s", action)})
+		return
+	}
+
+	handler := reflect.ValueOf(operation)
+	input := reflect.New(handler.Type().In(0).Elem())
+	if err := decodeQuery(r.Form, "", input); err != nil {
+		writeError(w, requestID, invalidInput("%v", err))
+		return
+	}
+	results := handler.Call([]reflect.Value{input})
+	if err, _ := results[1].Interface().(error); err != nil {
+		writeError(w, requestID, err)
+		return
+	}
+
+	buf := &bytes.Buffer{}
+	e := xml.NewEncoder(buf)
+	response := xml.StartElement{
+		Name: xml.Name{Local: action + "Response"},
+		Attr: []xml.Attr{{Name: xml.Name{Local: "xmlns"}, Value: namespace}},
+	}
+	err := e.EncodeToken(response)
+	if err == nil {
+		err = encodeXML(e, action+"Result", results[0], "")
+	}
+	if err == nil {
+		err = e.EncodeElement(struct {
+			RequestID string `xml:"RequestId"`
+		}{requestID}, xml.StartElement{Name: xml.Name{Local: "ResponseMetadata"}})
+	}
+	if err == nil {
+		err = e.EncodeToken(response.End())
+	}
+	if err == nil {
+		err = e.Flush()
+	}
+	if err != nil {
+		writeError(w, requestID, &apiError{Status: http.StatusInternalServerError, Code: "ServiceFailure", Message: err.Error()})
+		return
+	}
+	w.Header().Set("Content-Type", "text/xml")
+	w.Write(buf.Bytes())
+}
+
+func writeError(w http.ResponseWriter, requestID string, err error) {
+	e, ok := err.(*apiError)
+	if !ok {
+		e = &apiError{Status: http.StatusBadRequest, Code: "MalformedPolicyDocument", Message: err.Error()}
+	}
+	log.Debugf("%s %v", requestID, e)
+	errorType := "Sender"
+	if e.Status >= 500 {
+		errorType = "Receiver"
+	}
+	w.Header().Set("Content-Type", "text/xml")
+	w.WriteHeader(e.Status)
+	xml.NewEncoder(w).Encode(struct {
+		XMLName xml.Name `xml:"ErrorResponse"`
+		Xmlns   string   `xml:"xmlns,attr"`
+		Type    string   `xml:"Error>Type"`
+		Code    string   `xml:"Error>Code"`
+		Message string   `xml:"Error>Message"`
+		ID      string   `xml:"RequestId"`
+	}{Xmlns: namespace, Type: errorType, Code: e.Code, Message: e.Message, ID: requestID})
+}
+
+func (s *Server) principal(arn *string) (*audit.Principal, error) {
+	principal, ok := s.principals[aws.StringValue(arn)]
+	if !ok {
+		return nil, noSuchEntity("The principal %s was not found", aws.StringValue(arn))
+	}
+	return principal, nil
+}
+
+func (s *Server) simulateCustomPolicy(input *iam.SimulateCustomPolicyInput) (*iam.SimulatePolicyResponse, error) {
+	return policy.SimulateLocally(input)
+}
+
+// simulatePrincipalPolicy simulates the policies of the principal, following
+// those of the input, whose statements are reported as PolicyInputList.N;
+// those of the principal are reported by the names of their policies
+func (s *Server) simulatePrincipalPolicy(input *iam.SimulatePrincipalPolicyInput) (*iam.SimulatePolicyResponse, error) {
+	principal, err := s.principal(input.PolicySourceArn)
+	if err != nil {
+		return nil, err
+	}
+	callerArn := input.CallerArn
+	if callerArn == nil && principal.Type == audit.User {
+		callerArn = input.PolicySourceArn
+	}
+	response, err := policy.SimulateLocally(&iam.SimulateCustomPolicyInput{
+		PolicyInputList: append(append([]*string{}, input.PolicyInputList...), aws.StringSlice(principal.Policies)...),
+		ActionNames:     input.ActionNames,
+		ResourceArns:    input.ResourceArns,
+		CallerArn:       callerArn,
+		ContextEntries:  input.ContextEntries,
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, result := range response.EvaluationResults {
+		for _, statement := range result.MatchedStatements {
+			var index int
+			fmt.Sscanf(aws.StringValue(statement.SourcePolicyId), "PolicyInputList.%d", &index)
+			if index > len(input.PolicyInputList) {
+				name := principal.PolicyNames[index-len(input.PolicyInputList)-1]
+				statement.SourcePolicyId = aws.String(name[strings.LastIndex(name, "/")+1:])
+			}
+		}
+	}
+	return response, nil
+}
+
+func (s *Server) getContextKeysForCustomPolicy(input *iam.GetContextKeysForCustomPolicyInput) (*iam.GetContextKeysForPolicyResponse, error) {
+	keys, err := policy.PolicyContextKeys(nil, aws.StringValueSlice(input.PolicyInputList))
+	if err != nil {
+		return nil, err
+	}
+	return &iam.GetContextKeysForPolicyResponse{ContextKeyNames: aws.StringSlice(keys)}, nil
+}
+
+func (s *Server) getContextKeysForPrincipalPolicy(input *iam.GetContextKeysForPrincipalPolicyInput) (*iam.GetContextKeysForPolicyResponse, error) {
+	principal, err := s.principal(input.PolicySourceArn)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := policy.PolicyContextKeys(nil, append(principal.Policies, aws.StringValueSlice(input.PolicyInputList)...))
+	if err != nil {
+		return nil, err
+	}
+	return &iam.GetContextKeysForPolicyResponse{ContextKeyNames: aws.StringSlice(keys)}, nil
+}
+
+func (s *Server) managedPolicy(arn *string) (*iam.ManagedPolicyDetail, error) {
+	for _, p := range s.details.Policies {
+		if aws.StringValue(p.Arn) == aws.StringValue(arn) {
+			return p, nil
+		}
+	}
+	return nil, noSuchEntity("Policy %s was not found.", aws.StringValue(arn))
+}
+
+func (s *Server) getPolicy(input *iam.GetPolicyInput) (*iam.GetPolicyOutput, error) {
+	p, err := s.managedPolicy(input.PolicyArn)
+	if err != nil {
+		return nil, err
+	}
+	return &iam.GetPolicyOutput{Policy: &iam.Policy{
+		Arn:              p.Arn,
+		AttachmentCount:  p.AttachmentCount,
+		CreateDate:       p.CreateDate,
+		DefaultVersionId: p.DefaultVersionId,
+		Description:      p.Description,
+		IsAttachable:     p.IsAttachable,
+		Path:             p.Path,
+		PolicyId:         p.PolicyId,
+		PolicyName:       p.PolicyName,
+		UpdateDate:       p.UpdateDate,
+	}}, nil
+}
+
+func (s *Server) getPolicyVersion(input *iam.GetPolicyVersionInput) (*iam.GetPolicyVersionOutput, error) {
+	p, err := s.managedPolicy(input.PolicyArn)
+	if err != nil {
+		return nil, err
+	}
+	for _, version := range p.PolicyVersionList {
+		if aws.StringValue(version.VersionId) == aws.StringValue(input.VersionId) {
+			return &iam.GetPolicyVersionOutput{PolicyVersion: version}, nil
+		}
+	}
+	return nil, noSuchEntity("Policy %s version %s does not exist or is not attachable.",
+		aws.StringValue(input.PolicyArn), aws.StringValue(input.VersionId))
+}
+
+// getAccountAuthorizationDetails returns the details of the entity types of
+// the filter (or of every type), in a single page
+func (s *Server) getAccountAuthorizationDetails(input *iam.GetAccountAuthorizationDetailsInput) (*iam.GetAccountAuthorizationDetailsOutput, error) {
+	if len(input.Filter) == 0 {
+		return s.details, nil
+	}
+	output := &iam.GetAccountAuthorizationDetailsOutput{IsTruncated: aws.Bool(false)}
+	for _, filter := range aws.StringValueSlice(input.Filter) {
+		switch filter {
+		case iam.EntityTypeUser:
+			output.UserDetailList = s.details.UserDetailList
+		case iam.EntityTypeGroup:
+			output.GroupDetailList = s.details.GroupDetailList
+		case iam.EntityTypeRole:
+			output.RoleDetailList = s.details.RoleDetailList
+		case iam.EntityTypeLocalManagedPolicy, iam.EntityTypeAwsmanagedPolicy:
+			for _, p := range s.details.Policies {
+				if strings.HasPrefix(aws.StringValue(p.Arn), awsManagedPolicyPrefix) == (filter == iam.EntityTypeAwsmanagedPolicy) {
+					output.Policies = append(output.Policies, p)
+				}
+			}
+		default:
+			return nil, invalidInput("Invalid entity type %s", filter)
+		}
+	}
+	return output, nil
+}
@@ -0,0 +1,233 @@
+package fakeiam
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/matt-deboer/assert-aws-iam-permissions/pkg/audit"
+	"github.com/matt-deboer/assert-aws-iam-permissions/pkg/drift"
+)
+
+const readPolicy = `{
+	"Version": "2012-10-17",
+	"Statement": [
+		{"Sid": "Read", "Effect": "Allow", "Action": "s3:GetObject", "Resource": "arn:aws:s3:::bucket/*",
+			"Condition": {"Bool": {"aws:SecureTransport": "true"}}}
+	]
+}`
+
+const testDetails = `
+{
+	"UserDetailList": [
+		{
+			"UserName": "alice",
+			"Arn": "arn:aws:iam::123456789012:user/alice",
+			"GroupList": ["readers"],
+			"UserPolicyList": [],
+			"AttachedManagedPolicies": []
+		}
+	],
+	"GroupDetailList": [
+		{
+			"GroupName": "readers",
+			"Arn": "arn:aws:iam::123456789012:group/readers",
+			"GroupPolicyList": [],
+			"AttachedManagedPolicies": [
+				{"PolicyName": "reader", "PolicyArn": "arn:aws:iam::123456789012:policy/reader"}
+			]
+		}
+	],
+	"RoleDetailList": [],
+	"Policies": [
+		{
+			"PolicyName": "reader",
+			"Arn": "arn:aws:iam::123456789012:policy/reader",
+			"DefaultVersionId": "v2",
+			"CreateDate": "2019-01-02T03:04:05Z",
+			"PolicyVersionList": [
+				{"VersionId": "v1", "IsDefaultVersion": false, "Document": {"Version": "2012-10-17", "Statement": []}},
+				{"VersionId": "v2", "IsDefaultVersion": true, "Document": ` + readPolicy + `}
+			]
+		}
+	]
+}
+`
+
+// newClient starts a fake IAM server, returning it with an SDK client
+func newClient(t *testing.T) (*httptest.Server, *iam.IAM) {
+	details, err := audit.LoadDetails(strings.NewReader(testDetails))
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler, err := New(details)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(handler)
+	sess := session.Must(session.NewSession(&aws.Config{
+		Region:      aws.String("us-east-1"),
+		Endpoint:    aws.String(server.URL),
+		Credentials: credentials.NewStaticCredentials("AKID", "SECRET", ""),
+	}))
+	return server, iam.New(sess)
+}
+
+func TestSimulateCustomPolicy(t *testing.T) {
+
+	server, client := newClient(t)
+	defer server.Close()
+
+	response, err := client.SimulateCustomPolicy(&iam.SimulateCustomPolicyInput{
+		PolicyInputList: aws.StringSlice([]string{readPolicy}),
+		ActionNames:     aws.StringSlice([]string{"s3:GetObject", "s3:PutObject"}),
+		ResourceArns:    aws.StringSlice([]string{"arn:aws:s3:::bucket/key"}),
+		ContextEntries: []*iam.ContextEntry{{
+			ContextKeyName:   aws.String("aws:SecureTransport"),
+			ContextKeyType:   aws.String("boolean"),
+			ContextKeyValues: aws.StringSlice([]string{"true"}),
+		}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(response.EvaluationResults) != 2 {
+		t.Fatalf("expected 2 evaluation results, but got %v", response)
+	}
+	get, put := response.EvaluationResults[0], response.EvaluationResults[1]
+	if aws.StringValue(get.EvalDecision) != "allowed" || aws.StringValue(put.EvalDecision) != "implicitDeny" ||
+		aws.StringValue(get.EvalResourceName) != "arn:aws:s3:::bucket/key" || len(get.MatchedStatements) != 1 ||
+		aws.StringValue(get.MatchedStatements[0].SourcePolicyId) != "PolicyInputList.1" ||
+		aws.Int64Value(get.MatchedStatements[0].StartPosition.Line) != 4 {
+		t.Errorf("unexpected response %v", response)
+	}
+
+	_, err = client.SimulateCustomPolicy(&iam.SimulateCustomPolicyInput{
+		PolicyInputList: aws.StringSlice([]string{"{"}),
+		ActionNames:     aws.StringSlice([]string{"s3:GetObject"}),
+	})
+	if e, ok := err.(awserr.Error); !ok || e.Code() != "MalformedPolicyDocument" {
+		t.Errorf("expected a MalformedPolicyDocument error, but got %v", err)
+	}
+}
+
+func TestSimulatePrincipalPolicy(t *testing.T) {
+
+	server, client := newClient(t)
+	defer server.Close()
+
+	response, err := client.SimulatePrincipalPolicy(&iam.SimulatePrincipalPolicyInput{
+		PolicySourceArn: aws.String("arn:aws:iam::123456789012:user/alice"),
+		ActionNames:     aws.StringSlice([]string{"s3:GetObject"}),
+		ResourceArns:    aws.StringSlice([]string{"arn:aws:s3:::bucket/key"}),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := response.EvaluationResults[0]
+	if aws.StringValue(result.EvalDecision) != "implicitDeny" ||
+		strings.Join(aws.StringValueSlice(result.MissingContextValues), ",") != "aws:SecureTransport" {
+		t.Errorf("unexpected response %v", response)
+	}
+
+	keys, err := client.GetContextKeysForPrincipalPolicy(&iam.GetContextKeysForPrincipalPolicyInput{
+		PolicySourceArn: aws.String("arn:aws:iam::123456789012:user/alice"),
+		PolicyInputList: aws.StringSlice([]string{`{"Statement": {"Effect": "Allow", "Action": "*", "Resource": "*",
+			"Condition": {"StringEquals": {"aws:RequestedRegion": "us-east-1"}}}}`}),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(aws.StringValueSlice(keys.ContextKeyNames), ",") != "aws:RequestedRegion,aws:SecureTransport" {
+		t.Errorf("unexpected context keys %v", keys)
+	}
+
+	_, err = client.SimulatePrincipalPolicy(&iam.SimulatePrincipalPolicyInput{
+		PolicySourceArn: aws.String("arn:aws:iam::123456789012:user/mallory"),
+		ActionNames:     aws.StringSlice([]string{"s3:GetObject"}),
+	})
+	if e, ok := err.(awserr.Error); !ok || e.Code() != iam.ErrCodeNoSuchEntityException {
+		t.Errorf("expected a NoSuchEntity error, but got %v", err)
+	}
+}
+
+func TestGetPolicy(t *testing.T) {
+
+	server, client := newClient(t)
+	defer server.Close()
+
+	policy, err := client.GetPolicy(&iam.GetPolicyInput{PolicyArn: aws.String("arn:aws:iam::123456789012:policy/reader")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if aws.StringValue(policy.Policy.PolicyName) != "reader" ||
+		!aws.TimeValue(policy.Policy.CreateDate).Equal(time.Date(2019, 1, 2, 3, 4, 5, 0, time.UTC)) {
+		t.Errorf("unexpected policy %v", policy)
+	}
+
+	versionID, document, err := drift.FetchDefaultVersion(client, "arn:aws:iam::123456789012:policy/reader")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if versionID != "v2" || !strings.Contains(document, `"Sid":"Read"`) {
+		t.Errorf("unexpected version %s: %s", versionID, document)
+	}
+
+	_, err = client.GetPolicyVersion(&iam.GetPolicyVersionInput{
+		PolicyArn: aws.String("arn:aws:iam::123456789012:policy/reader"),
+		VersionId: aws.String("v3"),
+	})
+	if e, ok := err.(awserr.Error); !ok || e.Code() != iam.ErrCodeNoSuchEntityException {
+		t.Errorf("expected a NoSuchEntity error, but got %v", err)
+	}
+}
+
+func TestGetAccountAuthorizationDetails(t *testing.T) {
+
+	server, client := newClient(t)
+	defer server.Close()
+
+	details, err := audit.FetchDetails(client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	principals, err := audit.ResolvePrincipals(details)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(principals) != 2 || principals[1].Arn != "arn:aws:iam::123456789012:user/alice" ||
+		len(principals[1].Policies) != 1 || !strings.Contains(principals[1].Policies[0], `"Sid":"Read"`) {
+		t.Errorf("unexpected principals %v", principals)
+	}
+
+	filtered, err := client.GetAccountAuthorizationDetails(&iam.GetAccountAuthorizationDetailsInput{
+		Filter: aws.StringSlice([]string{iam.EntityTypeGroup, iam.EntityTypeAwsmanagedPolicy}),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(filtered.GroupDetailList) != 1 || len(filtered.UserDetailList) != 0 || len(filtered.Policies) != 0 {
+		t.Errorf("unexpected details %v", filtered)
+	}
+}
+
+func TestNew_CopiesDetails(t *testing.T) {
+
+	details, err := audit.LoadDetails(strings.NewReader(testDetails))
+	if err != nil {
+		t.Fatal(err)
+	}
+	document := aws.StringValue(details.Policies[0].PolicyVersionList[1].Document)
+	if _, err = New(details); err != nil {
+		t.Fatal(err)
+	}
+	if aws.StringValue(details.Policies[0].PolicyVersionList[1].Document) != document || details.IsTruncated != nil {
+		t.Errorf("expected the details not to be modified, but got %v", details)
+	}
+}
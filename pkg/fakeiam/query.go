@@ -0,0 +1,177 @@
+package fakeiam
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/url"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// iso8601 is the format of the timestamps of the IAM API
+const iso8601 = "2006-01-02T15:04:05Z"
+
+// memberName returns the name of a field of an SDK type in requests and
+// responses, as given by its locationName tag
+func memberName(field reflect.StructField) string {
+	if name := field.Tag.Get("locationName"); len(name) > 0 {
+		return name
+	}
+	return field.Name
+}
+
+// decodeQuery fills the fields of an SDK input struct from the parameters of
+// a Query request, in which nested members are named by their path, as in
+// ContextEntries.member.1.ContextKeyName
+func decodeQuery(form url.Values, prefix string, value reflect.Value) error {
+	value = reflect.Indirect(value)
+	t := value.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if len(field.PkgPath) > 0 {
+			continue
+		}
+		if err := decodeValue(form, prefix+memberName(field), value.Field(i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func decodeValue(form url.Values, name string, value reflect.Value) error {
+	switch value.Kind() {
+	case reflect.Slice:
+		for n := 1; hasParameter(form, fmt.Sprintf("%s.member.%d", name, n)); n++ {
+			item := reflect.New(value.Type().Elem().Elem())
+			if err := decodeValue(form, fmt.Sprintf("%s.member.%d", name, n), item); err != nil {
+				return err
+			}
+			value.Set(reflect.Append(value, item))
+		}
+		return nil
+	case reflect.Ptr:
+		if !hasParameter(form, name) {
+			return nil
+		}
+		if value.IsNil() {
+			value.Set(reflect.New(value.Type().Elem()))
+		}
+		return decodeValue(form, name, value.Elem())
+	case reflect.Struct:
+		return decodeQuery(form, name+".", value)
+	case reflect.String:
+		value.SetString(form.Get(name))
+	case reflect.Int64:
+		n, err := strconv.ParseInt(form.Get(name), 10, 64)
+		if err != nil {
+			return fmt.Errorf("Invalid value for %s; %v", name, err)
+		}
+		value.SetInt(n)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(form.Get(name))
+		if err != nil {
+			return fmt.Errorf("Invalid value for %s; %v", name, err)
+		}
+		value.SetBool(b)
+	default:
+		return fmt.Errorf("Parameter %s is not supported", name)
+	}
+	return nil
+}
+
+// hasParameter reports whether the form holds the named parameter, or any
+// parameter nested within it
+func hasParameter(form url.Values, name string) bool {
+	if _, ok := form[name]; ok {
+		return true
+	}
+	for key := range form {
+		if strings.HasPrefix(key, name+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// encodeXML writes an SDK output value as the named element of a Query
+// response, with list items as 'member' elements and map items as 'entry'
+// elements; nil values are omitted
+func encodeXML(e *xml.Encoder, name string, value reflect.Value, tag reflect.StructTag) error {
+	start := xml.StartElement{Name: xml.Name{Local: name}}
+	switch value.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if value.IsNil() {
+			return nil
+		}
+		return encodeXML(e, name, value.Elem(), tag)
+	case reflect.Struct:
+		if t, ok := value.Interface().(time.Time); ok {
+			return e.EncodeElement(t.UTC().Format(iso8601), start)
+		}
+		if err := e.EncodeToken(start); err != nil {
+			return err
+		}
+		t := value.Type()
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if len(field.PkgPath) > 0 {
+				continue
+			}
+			if err := encodeXML(e, memberName(field), value.Field(i), field.Tag); err != nil {
+				return err
+			}
+		}
+		return e.EncodeToken(start.End())
+	case reflect.Slice:
+		if value.IsNil() {
+			return nil
+		}
+		item := tag.Get("locationNameList")
+		if len(item) == 0 {
+			item = "member"
+		}
+		if err := e.EncodeToken(start); err != nil {
+			return err
+		}
+		for i := 0; i < value.Len(); i++ {
+			if err := encodeXML(e, item, value.Index(i), ""); err != nil {
+				return err
+			}
+		}
+		return e.EncodeToken(start.End())
+	case reflect.Map:
+		if value.IsNil() {
+			return nil
+		}
+		keys := []string{}
+		for _, key := range value.MapKeys() {
+			keys = append(keys, key.String())
+		}
+		sort.Strings(keys)
+		if err := e.EncodeToken(start); err != nil {
+			return err
+		}
+		for _, key := range keys {
+			entry := xml.StartElement{Name: xml.Name{Local: "entry"}}
+			if err := e.EncodeToken(entry); err != nil {
+				return err
+			}
+			if err := e.EncodeElement(key, xml.StartElement{Name: xml.Name{Local: "key"}}); err != nil {
+				return err
+			}
+			if err := encodeXML(e, "value", value.MapIndex(reflect.ValueOf(key)), ""); err != nil {
+				return err
+			}
+			if err := e.EncodeToken(entry.End()); err != nil {
+				return err
+			}
+		}
+		return e.EncodeToken(start.End())
+	case reflect.String, reflect.Int64, reflect.Bool:
+		return e.EncodeElement(value.Interface(), start)
+	}
+	return fmt.Errorf("Member %s of type %s is not supported", name, value.Type())
+}
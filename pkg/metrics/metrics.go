@@ -0,0 +1,195 @@
+// Package metrics keeps counters and histograms, exposed in the Prometheus
+// text format
+package metrics // import "github.com/matt-deboer/assert-aws-iam-permissions/pkg/metrics"
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// contentType is the content type of the Prometheus text format
+const contentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// Registry holds the metrics written by Write, in the order they were created
+type Registry struct {
+	mu      sync.Mutex
+	metrics []*metric
+}
+
+// NewRegistry creates an empty registry
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// metric is a counter or histogram, with a series per combination of the
+// values of its labels
+type metric struct {
+	name    string
+	help    string
+	kind    string
+	labels  []string
+	buckets []float64
+	series  map[string]*series
+}
+
+type series struct {
+	labelValues []string
+	value       float64
+	// counts are the observations of a histogram up to each of its buckets,
+	// which are made cumulative when written
+	counts []uint64
+	count  uint64
+}
+
+// Counter is a metric which only increases
+type Counter struct {
+	registry *Registry
+	metric   *metric
+}
+
+// Histogram counts observations by bucket, along with their sum
+type Histogram struct {
+	registry *Registry
+	metric   *metric
+}
+
+func (r *Registry) register(m *metric) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	m.series = map[string]*series{}
+	r.metrics = append(r.metrics, m)
+}
+
+// NewCounter creates a counter with the given labels
+func (r *Registry) NewCounter(name, help string, labels ...string) *Counter {
+	m := &metric{name: name, help: help, kind: "counter", labels: labels}
+	r.register(m)
+	return &Counter{registry: r, metric: m}
+}
+
+// NewHistogram creates a histogram with the given labels, counting
+// observations up to each of the upper bounds of buckets, in increasing order
+func (r *Registry) NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	m := &metric{name: name, help: help, kind: "histogram", labels: labels, buckets: buckets}
+	r.register(m)
+	return &Histogram{registry: r, metric: m}
+}
+
+// seriesOf returns the series of the label values, creating it if need be;
+// the registry must be locked
+func (m *metric) seriesOf(labelValues []string) *series {
+	if len(labelValues) != len(m.labels) {
+		panic(fmt.Sprintf("%s has labels %v, but got values %v", m.name, m.labels, labelValues))
+	}
+	key := strings.Join(labelValues, "\xff")
+	s, ok := m.series[key]
+	if !ok {
+		s = &series{labelValues: labelValues, counts: make([]uint64, len(m.buckets))}
+		m.series[key] = s
+	}
+	return s
+}
+
+// Inc adds one to the series of the label values
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add adds a non-negative value to the series of the label values
+func (c *Counter) Add(value float64, labelValues ...string) {
+	c.registry.mu.Lock()
+	defer c.registry.mu.Unlock()
+	c.metric.seriesOf(labelValues).value += value
+}
+
+// Observe counts an observation in the series of the label values
+func (h *Histogram) Observe(value float64, labelValues ...string) {
+	h.registry.mu.Lock()
+	defer h.registry.mu.Unlock()
+	s := h.metric.seriesOf(labelValues)
+	for i, bound := range h.metric.buckets {
+		if value <= bound {
+			s.counts[i]++
+			break
+		}
+	}
+	s.count++
+	s.value += value
+}
+
+// Write writes every series of the metrics in the Prometheus text format
+func (r *Registry) Write(w io.Writer) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	out := bufio.NewWriter(w)
+	for _, m := range r.metrics {
+		fmt.Fprintf(out, "# HELP %s %s\n", m.name, escape(m.help, false))
+		fmt.Fprintf(out, "# TYPE %s %s\n", m.name, m.kind)
+		keys := []string{}
+		for key := range m.series {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			s := m.series[key]
+			if m.kind == "counter" {
+				fmt.Fprintf(out, "%s%s %s\n", m.name, m.labelPairs(s, ""), formatValue(s.value))
+				continue
+			}
+			var cumulative uint64
+			for i, bound := range m.buckets {
+				cumulative += s.counts[i]
+				fmt.Fprintf(out, "%s_bucket%s %d\n", m.name, m.labelPairs(s, formatValue(bound)), cumulative)
+			}
+			fmt.Fprintf(out, "%s_bucket%s %d\n", m.name, m.labelPairs(s, "+Inf"), s.count)
+			fmt.Fprintf(out, "%s_sum%s %s\n", m.name, m.labelPairs(s, ""), formatValue(s.value))
+			fmt.Fprintf(out, "%s_count%s %d\n", m.name, m.labelPairs(s, ""), s.count)
+		}
+	}
+	return out.Flush()
+}
+
+// ServeHTTP writes the metrics, for Prometheus to scrape
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", contentType)
+	r.Write(w)
+}
+
+// labelPairs formats the labels of a series, along with the 'le' label of
+// a histogram bucket when le is set
+func (m *metric) labelPairs(s *series, le string) string {
+	pairs := []string{}
+	for i, label := range m.labels {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, label, escape(s.labelValues[i], true)))
+	}
+	if len(le) > 0 {
+		pairs = append(pairs, fmt.Sprintf(`le="%s"`, le))
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func escape(s string, quoted bool) string {
+	s = strings.Replace(s, `\`, `\\`, -1)
+	s = strings.Replace(s, "\n", `\n`, -1)
+	if quoted {
+		s = strings.Replace(s, `"`, `\"`, -1)
+	}
+	return s
+}
+
+func formatValue(value float64) string {
+	if math.IsInf(value, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
@@ -0,0 +1,39 @@
+package metrics
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestWrite(t *testing.T) {
+
+	r := NewRegistry()
+	requests := r.NewCounter("requests_total", "Requests, by path", "path")
+	latency := r.NewHistogram("latency_seconds", "The latency of requests", []float64{0.1, 1})
+	requests.Inc("/a")
+	requests.Add(2, `/b"\`)
+	requests.Inc("/a")
+	latency.Observe(0.05)
+	latency.Observe(0.5)
+	latency.Observe(3)
+
+	var out bytes.Buffer
+	if err := r.Write(&out); err != nil {
+		t.Fatal(err)
+	}
+	expected := `# HELP requests_total Requests, by path
+# TYPE requests_total counter
+requests_total{path="/a"} 2
+requests_total{path="/b\"\\"} 2
+# HELP latency_seconds The latency of requests
+# TYPE latency_seconds histogram
+latency_seconds_bucket{le="0.1"} 1
+latency_seconds_bucket{le="1"} 2
+latency_seconds_bucket{le="+Inf"} 3
+latency_seconds_sum 3.55
+latency_seconds_count 3
+`
+	if out.String() != expected {
+		t.Errorf("expected:\n%s\nbut got:\n%s", expected, out.String())
+	}
+}
@@ -6,23 +6,106 @@ import (
 	"strings"
 
 	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
-	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/aws/aws-sdk-go/service/iam/iamiface"
 	"github.com/matt-deboer/assert-aws-iam-permissions/pkg/types"
+	log "github.com/sirupsen/logrus"
 )
 
+// simulateFunc runs the policy simulation for a single assertion
+type simulateFunc func(input *iam.SimulateCustomPolicyInput) (*iam.SimulatePolicyResponse, error)
+
+// Result is the outcome of a single evaluated action/resource pair of an assertion
+type Result struct {
+	Assertion *types.Assertion
+	Action    string
+	Resource  string
+	// Decision is the final evaluation decision (allowed, explicitDeny or implicitDeny)
+	Decision string
+	// Passed reports whether Decision satisfies the assertion's expected result
+	Passed bool
+	// MatchedStatements labels the policy statements which determined the decision
+	MatchedStatements []string
+	// MissingContextValues lists context keys referenced by the policies but
+	// absent from the assertion's context entries
+	MissingContextValues []string
+	// Details describes how the decision was reached: which side granted or
+	// blocked access, and the decisions of both sides when a resource policy
+	// or another account is involved
+	Details string
+}
+
+// Message describes the result in the form used for assertion failures
+func (r *Result) Message() string {
+	details := ""
+	if len(r.Details) > 0 {
+		details = "; " + r.Details
+	}
+	comment := r.Assertion.Comment
+	if len(r.Assertion.MatrixCell) > 0 {
+		comment += " " + r.Assertion.MatrixCell
+	}
+	return fmt.Sprintf("[POLICY ASSERTION FAILED] %s ( for %s [ %s ]: expected '%s', but got '%s'%s )",
+		comment, r.Action, r.Resource, r.Assertion.ExpectedResult, r.Decision, details)
+}
+
 // AssertPermissions evaluates the provided set of assertions against the
-// provided policy document
-func AssertPermissions(assertions []*types.Assertion, policyJSON string, assumeRoleARN string) error {
+// provided policy document with the evaluator, returning a result for each
+// evaluated action and resource; see Results.Passed
+func AssertPermissions(evaluator Evaluator, assertions []*types.Assertion, policyJSON string) (Results, error) {
+	return evaluator.Evaluate(assertions, []string{policyJSON})
+}
+
+// AssertPrincipalPermissions evaluates the provided set of assertions against
+// the policies of an existing IAM user, group or role; when policyJSON is not
+// empty, it is included in the simulation as an additional policy
+func AssertPrincipalPermissions(iamSvc iamiface.IAMAPI, principalARN string, assertions []*types.Assertion, policyJSON string) error {
+	return failures(EvaluatePrincipalPolicies(iamSvc, principalARN, assertions, policyJSON))
+}
+
+// EvaluatePrincipalPolicies evaluates the provided set of assertions against
+// the policies of an existing IAM user, group or role, returning a result for
+// each action and resource
+func EvaluatePrincipalPolicies(iamSvc iamiface.IAMAPI, principalARN string, assertions []*types.Assertion, policyJSON string) ([]*Result, error) {
+	return NewAWSEvaluator(iamSvc).EvaluatePrincipal(principalARN, assertions, policyJSON)
+}
+
+// EvaluatePolicies evaluates the provided set of assertions against the
+// combination of the provided policy documents, using the policy simulator
+// when iamSvc is provided, and the local engine when it is nil
+func EvaluatePolicies(iamSvc iamiface.IAMAPI, assertions []*types.Assertion, policies []string) ([]*Result, error) {
+	return NewEvaluator(iamSvc).Evaluate(assertions, policies)
+}
+
+// failures joins the messages of all failed results into a single error
+func failures(results []*Result, err error) error {
+	if err != nil {
+		return err
+	}
+	return Results(results).Err()
+}
 
-	iamSvc := initIAM(assumeRoleARN)
+func evaluateSimulated(assertions []*types.Assertion, policies []string, simulate simulateFunc) ([]*Result, error) {
 
-	errors := 0
-	messages := []string{}
+	var policyInputList []*string
+	if len(policies) > 0 {
+		policyInputList = aws.StringSlice(policies)
+	}
+	assertions, err := ExpandMatrix(assertions)
+	if err != nil {
+		return nil, err
+	}
+
+	results := []*Result{}
 
 	for _, assertion := range assertions {
 
+		resourceOwner, err := resolveResourceOwner(assertion)
+		if err != nil {
+			return nil, err
+		}
+		crossAccount := isCrossAccount(assertion.CallerArn, resourceOwner)
+
 		contextEntries := []*iam.ContextEntry{}
 		for k, v := range assertion.ContextEntries {
 			contextKeyType := "string"
@@ -36,42 +119,97 @@ func AssertPermissions(assertions []*types.Assertion, policyJSON string, assumeR
 			})
 		}
 
-		resp, err := iamSvc.SimulateCustomPolicy(&iam.SimulateCustomPolicyInput{
+		input := &iam.SimulateCustomPolicyInput{
 			ActionNames:     aws.StringSlice(assertion.ActionNames),
 			ResourceArns:    aws.StringSlice(assertion.ResourceArns),
 			CallerArn:       convertStringArg(assertion.CallerArn),
-			PolicyInputList: aws.StringSlice([]string{policyJSON}),
-			ResourceOwner:   convertStringArg(assertion.ResourceOwner),
+			PolicyInputList: policyInputList,
+			ResourceOwner:   convertStringArg(resourceOwner),
 			ResourcePolicy:  convertStringArg(assertion.ResourcePolicy),
 			ContextEntries:  contextEntries,
-		})
+		}
+
+		// the simulator folds the resource policy into a single decision, so
+		// the resource policy is evaluated separately in order to report which
+		// side granted or blocked access; the simulator sees only the identity policy
+		var resourcePolicy *Document
+		attributeSides := len(assertion.ResourcePolicy) > 0 || crossAccount
+		if attributeSides {
+			if len(assertion.CallerArn) == 0 {
+				return nil, fmt.Errorf("'caller_arn' is required to evaluate resource policies and cross-account access for '%s'",
+					assertion.Comment)
+			}
+			if len(assertion.ResourcePolicy) > 0 {
+				resourcePolicy, err = ParseDocument(assertion.ResourcePolicy)
+				if err != nil {
+					return nil, err
+				}
+			}
+			input.ResourcePolicy = nil
+			input.ResourceOwner = nil
+		}
+
+		resp, err := simulate(input)
 
 		if err != nil {
-			return err
+			return nil, err
 		}
 
-		for _, result := range resp.EvaluationResults {
-			evalDecision := aws.StringValue(result.EvalDecision)
-			unexpectedResult := assertion.ExpectedResult != evalDecision
-			if assertion.ExpectedResult == "deny" || assertion.ExpectedResult == "denied" {
-				unexpectedResult = !strings.HasSuffix(evalDecision, "Deny")
+		for _, evaluation := range resp.EvaluationResults {
+			result := &Result{
+				Assertion:            assertion,
+				Action:               aws.StringValue(evaluation.EvalActionName),
+				Resource:             aws.StringValue(evaluation.EvalResourceName),
+				Decision:             aws.StringValue(evaluation.EvalDecision),
+				MatchedStatements:    labelStatements(evaluation.MatchedStatements, policies),
+				MissingContextValues: aws.StringValueSlice(evaluation.MissingContextValues),
 			}
-
-			if unexpectedResult {
-				errors++
-				msg := fmt.Sprintf("[POLICY ASSERTION FAILED] %s ( for %s [ %s ]: expected '%s', but got '%s' )",
-					assertion.Comment, aws.StringValue(result.EvalActionName),
-					aws.StringValue(result.EvalResourceName), assertion.ExpectedResult,
-					aws.StringValue(result.EvalDecision))
-				messages = append(messages, msg)
+			if attributeSides {
+				resourceDecision := ImplicitDeny
+				if resourcePolicy != nil {
+					resourceEvaluation, err := resourcePolicy.Evaluate(&Request{
+						Action:    result.Action,
+						Resource:  result.Resource,
+						Principal: assertion.CallerArn,
+						Context:   NewContext(assertion.ContextEntries),
+					})
+					if err != nil {
+						return nil, err
+					}
+					resourceDecision = resourceEvaluation.Decision
+					for _, label := range resourceEvaluation.MatchedStatements {
+						result.MatchedStatements = append(result.MatchedStatements, "ResourcePolicy:"+label)
+					}
+				}
+				result.Details = describeDecision(result.Decision, resourceDecision, crossAccount)
+				result.Decision = combineDecisions(result.Decision, resourceDecision, crossAccount)
+			} else {
+				result.Details = describeIdentityDecision(result.Decision)
 			}
+			result.Passed = !isUnexpectedResult(assertion.ExpectedResult, result.Decision)
+			logResult(result)
+			results = append(results, result)
 		}
 	}
 
-	if errors > 0 {
-		return fmt.Errorf(strings.Join(messages, ","))
+	return results, nil
+}
+
+func logResult(result *Result) {
+	details := ""
+	if len(result.Details) > 0 {
+		details = "; " + result.Details
+	}
+	log.Debugf("%s [ %s ]: %s%s", result.Action, result.Resource, result.Decision, details)
+}
+
+// isUnexpectedResult compares an evaluation decision with the expected
+// result; 'deny' or 'denied' are satisfied by either type of deny
+func isUnexpectedResult(expectedResult, evalDecision string) bool {
+	if expectedResult == "deny" || expectedResult == "denied" {
+		return !strings.HasSuffix(evalDecision, "Deny")
 	}
-	return nil
+	return expectedResult != evalDecision
 }
 
 func convertStringArg(arg string) *string {
@@ -83,26 +221,26 @@ func convertStringArg(arg string) *string {
 }
 
 // AssertPolicyLength evaluates the length of the policy document (excluding whitespace) against
-// the expected maximum length
+// the expected maximum length, returning a *LengthError when it is exceeded
 func AssertPolicyLength(maxLength int, policyJSON string) error {
-	length := len(regexp.MustCompile(`\s+`).ReplaceAllString(policyJSON, ""))
+	length := PolicyLength(policyJSON)
 	if length > maxLength {
-		return fmt.Errorf("Policy document is %d characters over the expected limit of %d", (length - maxLength), maxLength)
+		return &LengthError{Length: length, MaxLength: maxLength}
 	}
 	return nil
 }
 
-func initIAM(assumeRoleARN string) *iam.IAM {
-	sess := session.Must(session.NewSessionWithOptions(session.Options{
-		SharedConfigState: session.SharedConfigEnable,
-	}))
-
-	var iamSvc *iam.IAM
-	if len(assumeRoleARN) > 0 {
-		creds := stscreds.NewCredentials(sess, assumeRoleARN)
-		iamSvc = iam.New(sess, &aws.Config{Credentials: creds})
-	} else {
-		iamSvc = iam.New(sess)
-	}
-	return iamSvc
+// PolicyLength returns the length of the policy document, excluding whitespace
+func PolicyLength(policyJSON string) int {
+	return len(regexp.MustCompile(`\s+`).ReplaceAllString(policyJSON, ""))
+}
+
+// LengthError reports a policy document longer than its expected maximum length
+type LengthError struct {
+	Length    int
+	MaxLength int
+}
+
+func (e *LengthError) Error() string {
+	return fmt.Sprintf("Policy document is %d characters over the expected limit of %d", (e.Length - e.MaxLength), e.MaxLength)
 }
@@ -0,0 +1,157 @@
+package policy_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/matt-deboer/assert-aws-iam-permissions/pkg/fakeiam"
+	"github.com/matt-deboer/assert-aws-iam-permissions/pkg/policy"
+	"github.com/matt-deboer/assert-aws-iam-permissions/pkg/types"
+)
+
+// newFakeIAM starts a fake IAM server for an account holding the
+// authorization details, passing the Authorization header of each request to
+// signed, when given; the tests of this package are external to it, since
+// the fake server itself evaluates policies with this package
+func newFakeIAM(t *testing.T, details *iam.GetAccountAuthorizationDetailsOutput, signed func(authorization string)) *httptest.Server {
+	handler, err := fakeiam.New(details)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if signed != nil {
+			signed(r.Header.Get("Authorization"))
+		}
+		handler.ServeHTTP(w, r)
+	}))
+}
+
+// newIAMClient returns an SDK client of the IAM server, with static credentials
+func newIAMClient(server *httptest.Server) *iam.IAM {
+	sess := session.Must(session.NewSession(&aws.Config{
+		Region:      aws.String("us-east-1"),
+		Endpoint:    aws.String(server.URL),
+		Credentials: credentials.NewStaticCredentials("AKID", "SECRET", ""),
+	}))
+	return iam.New(sess)
+}
+
+// testDetails returns the authorization details of an account whose deployer
+// role is attached the reader policy, holding testAttachedPolicy
+func testDetails() *iam.GetAccountAuthorizationDetailsOutput {
+	return &iam.GetAccountAuthorizationDetailsOutput{
+		RoleDetailList: []*iam.RoleDetail{{
+			RoleName: aws.String("deployer"),
+			Arn:      aws.String(testRoleArn),
+			AttachedManagedPolicies: []*iam.AttachedPolicy{
+				{PolicyName: aws.String("reader"), PolicyArn: aws.String(testPolicyArn)},
+			},
+		}},
+		Policies: []*iam.ManagedPolicyDetail{{
+			PolicyName:       aws.String("reader"),
+			Arn:              aws.String(testPolicyArn),
+			DefaultVersionId: aws.String("v1"),
+			PolicyVersionList: []*iam.PolicyVersion{
+				{VersionId: aws.String("v1"), IsDefaultVersion: aws.Bool(true), Document: aws.String(testAttachedPolicy)},
+			},
+		}},
+	}
+}
+
+const testRoleArn = "arn:aws:iam::123456789012:role/deployer"
+
+const testPolicyArn = "arn:aws:iam::123456789012:policy/reader"
+
+const testAttachedPolicy = `
+{
+	"Version": "2012-10-17",
+	"Statement": [
+		{
+			"Effect": "Allow",
+			"Action": ["s3:GetObject", "s3:ListBucket"],
+			"Resource": "*"
+		}
+	]
+}
+`
+
+const testDenyDeletePolicy = `
+{
+	"Version": "2012-10-17",
+	"Statement": [
+		{
+			"Effect": "Deny",
+			"Action": "s3:DeleteObject",
+			"Resource": "*"
+		}
+	]
+}
+`
+
+func TestAssertPrincipalPermissions(t *testing.T) {
+	server := newFakeIAM(t, testDetails(), nil)
+	defer server.Close()
+	iamSvc := newIAMClient(server)
+
+	assertions := []*types.Assertion{
+		&types.Assertion{
+			ActionNames:    []string{"s3:GetObject", "s3:ListBucket"},
+			ResourceArns:   []string{"arn:aws:s3:::my-bucket"},
+			ExpectedResult: "allowed",
+		},
+		&types.Assertion{
+			ActionNames:    []string{"s3:PutObject"},
+			ExpectedResult: "denied",
+		},
+	}
+
+	if err := policy.AssertPrincipalPermissions(iamSvc, testRoleArn, assertions, ""); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestAssertPrincipalPermissions_AdditionalPolicy(t *testing.T) {
+	server := newFakeIAM(t, testDetails(), nil)
+	defer server.Close()
+	iamSvc := newIAMClient(server)
+
+	assertions := []*types.Assertion{
+		&types.Assertion{
+			Comment:        "the deployer can delete objects",
+			ActionNames:    []string{"s3:DeleteObject"},
+			ResourceArns:   []string{"arn:aws:s3:::my-bucket/key"},
+			ExpectedResult: "allowed",
+		},
+	}
+
+	err := policy.AssertPrincipalPermissions(iamSvc, testRoleArn, assertions, testDenyDeletePolicy)
+	if err == nil {
+		t.Fatal("expected the additional policy to deny s3:DeleteObject")
+	}
+	expected := "[POLICY ASSERTION FAILED] the deployer can delete objects ( for s3:DeleteObject " +
+		"[ arn:aws:s3:::my-bucket/key ]: expected 'allowed', but got 'explicitDeny'; " +
+		"identity policy: explicitDeny; explicitly denied by the identity policy )"
+	if err.Error() != expected {
+		t.Errorf("unexpected failure message:\n%s", err.Error())
+	}
+}
+
+func TestAssertPrincipalPermissions_UnknownPrincipal(t *testing.T) {
+	server := newFakeIAM(t, nil, nil)
+	defer server.Close()
+	iamSvc := newIAMClient(server)
+
+	assertions := []*types.Assertion{
+		&types.Assertion{ActionNames: []string{"s3:GetObject"}, ExpectedResult: "allowed"},
+	}
+	err := policy.AssertPrincipalPermissions(iamSvc, testRoleArn, assertions, "")
+	if err == nil || !strings.Contains(err.Error(), "NoSuchEntity") {
+		t.Errorf("expected a NoSuchEntity error, but got %v", err)
+	}
+}
@@ -62,9 +62,12 @@ func TestAssertBasicPermissions(t *testing.T) {
 		},
 	}
 
-	valid, err := AssertPermissions(assertions, testPolicy)
-	if !valid {
-		t.Error(err)
+	results, err := AssertPermissions(NewLocalEvaluator(), assertions, testPolicy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !results.Passed() {
+		t.Error(results.Err())
 	}
 }
 
@@ -78,9 +81,12 @@ func TestAssertWildcardPermissions(t *testing.T) {
 		},
 	}
 
-	valid, err := AssertPermissions(assertions, testPolicy)
-	if !valid {
-		t.Error(err)
+	results, err := AssertPermissions(NewLocalEvaluator(), assertions, testPolicy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !results.Passed() {
+		t.Error(results.Err())
 	}
 }
 
@@ -144,9 +150,11 @@ func TestAssertWithContextEntries(t *testing.T) {
 		},
 	}
 
-	valid, err := AssertPermissions(assertions, testPolicyWithContext)
-	if !valid {
-		t.Error(err)
+	results, err := AssertPermissions(NewLocalEvaluator(), assertions, testPolicyWithContext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !results.Passed() {
+		t.Error(results.Err())
 	}
-
 }
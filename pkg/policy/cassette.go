@@ -0,0 +1,139 @@
+package policy
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/aws/aws-sdk-go/service/iam/iamiface"
+)
+
+// cassetteSuffix is the suffix of the files of a cassette: a directory
+// holding a file per recorded simulation, named by the key of its input
+const cassetteSuffix = ".json"
+
+// cassette is the content of a file of a cassette
+type cassette struct {
+	Key string `json:"key"`
+	*Interaction
+}
+
+// LoadRecording reads the interactions of a cassette directory, as written
+// by a Recorder
+func LoadRecording(dir string) (*Recording, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read cassette; %v", err)
+	}
+	recording := NewRecording()
+	for _, file := range files {
+		if file.IsDir() || !strings.HasSuffix(file.Name(), cassetteSuffix) {
+			continue
+		}
+		path := filepath.Join(dir, file.Name())
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		c := &cassette{Interaction: &Interaction{}}
+		if err = json.Unmarshal(data, c); err != nil || len(c.Key) == 0 || c.Input == nil || c.Response == nil {
+			return nil, fmt.Errorf("Invalid cassette file %s; expected the key, input and response of a simulation", path)
+		}
+		recording.interactions[c.Key] = c.Interaction
+	}
+	return recording, nil
+}
+
+// writeCassette writes an interaction to its file of the cassette directory,
+// as indented JSON without null values, so that changes to the simulations
+// of a suite can be reviewed in a diff
+func writeCassette(dir, key string, interaction *Interaction) error {
+	data, err := json.Marshal(&cassette{Key: key, Interaction: interaction})
+	if err != nil {
+		return err
+	}
+	var value interface{}
+	if err = json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	if data, err = json.MarshalIndent(withoutNulls(value), "", "  "); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(dir, key+cassetteSuffix), append(data, '\n'), 0644)
+}
+
+func withoutNulls(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			if item == nil {
+				delete(v, key)
+			} else {
+				v[key] = withoutNulls(item)
+			}
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = withoutNulls(item)
+		}
+	}
+	return value
+}
+
+// Recorder wraps an IAM client, recording each response of SimulateCustomPolicy
+// to a cassette directory as it is received
+type Recorder struct {
+	iamiface.IAMAPI
+	Dir       string
+	Recording *Recording
+}
+
+// NewRecorder creates a recorder of the simulations of iamSvc, writing them
+// to dir, which is created if need be
+func NewRecorder(iamSvc iamiface.IAMAPI, dir string) (*Recorder, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("Failed to create cassette; %v", err)
+	}
+	return &Recorder{IAMAPI: iamSvc, Dir: dir, Recording: NewRecording()}, nil
+}
+
+// SimulateCustomPolicy calls the simulator, recording its response
+func (r *Recorder) SimulateCustomPolicy(input *iam.SimulateCustomPolicyInput) (*iam.SimulatePolicyResponse, error) {
+	response, err := r.IAMAPI.SimulateCustomPolicy(input)
+	if err != nil {
+		return nil, err
+	}
+	key, interaction := r.Recording.Record(input, response)
+	if err = writeCassette(r.Dir, key, interaction); err != nil {
+		return nil, fmt.Errorf("Failed to record simulation %s; %v", key, err)
+	}
+	return response, nil
+}
+
+// Replayer stands in for an IAM client, answering SimulateCustomPolicy with
+// the responses of a recording; simulations which weren't recorded fail with
+// a *NotRecordedError, and other operations aren't supported
+type Replayer struct {
+	iamiface.IAMAPI
+	Recording *Recording
+}
+
+// NewReplayer creates a stand-in IAM client replaying the recording
+func NewReplayer(recording *Recording) *Replayer {
+	return &Replayer{Recording: recording}
+}
+
+// SimulateCustomPolicy returns the recorded response to the input
+func (r *Replayer) SimulateCustomPolicy(input *iam.SimulateCustomPolicyInput) (*iam.SimulatePolicyResponse, error) {
+	return r.Recording.SimulateCustomPolicy(input)
+}
+
+// SimulatePrincipalPolicy fails, since the policies of principals may change
+// after they're recorded
+func (r *Replayer) SimulatePrincipalPolicy(input *iam.SimulatePrincipalPolicyInput) (*iam.SimulatePolicyResponse, error) {
+	return nil, fmt.Errorf("The simulations of principals' policies can't be replayed")
+}
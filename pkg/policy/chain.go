@@ -0,0 +1,221 @@
+package policy
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/private/protocol/query/queryutil"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/matt-deboer/assert-aws-iam-permissions/pkg/types"
+)
+
+// MaxChainedRoleDuration is the longest session of a role assumed with the
+// credentials of another role's session
+const MaxChainedRoleDuration = time.Hour
+
+// principalTagPrefix prefixes the context keys of the tags of the principal
+const principalTagPrefix = "aws:PrincipalTag/"
+
+var roleARNPattern = regexp.MustCompile(`^arn:aws[a-z-]*:iam::\d{12}:role/.+$`)
+
+// RoleHop is a role assumed in a chain, with the session tags of its session;
+// the transitive tags are passed on to the sessions of the roles it assumes
+type RoleHop struct {
+	RoleARN           string
+	ExternalID        string
+	Tags              map[string]string
+	TransitiveTagKeys []string
+}
+
+// ParseRoleHop parses a role of a chain, of the form
+// ARN[;external-id=ID][;tag:KEY=VALUE][;transitive-tag:KEY=VALUE]...
+func ParseRoleHop(spec string) (*RoleHop, error) {
+	parts := strings.Split(spec, ";")
+	hop := &RoleHop{RoleARN: strings.TrimSpace(parts[0]), Tags: map[string]string{}}
+	if !roleARNPattern.MatchString(hop.RoleARN) {
+		return nil, fmt.Errorf("Invalid role ARN '%s' in role chain", hop.RoleARN)
+	}
+	for _, part := range parts[1:] {
+		option := strings.SplitN(strings.TrimSpace(part), "=", 2)
+		if len(option) != 2 {
+			return nil, fmt.Errorf("Invalid option '%s' of role %s; expected 'name=value'", part, hop.RoleARN)
+		}
+		name, value := option[0], option[1]
+		switch {
+		case name == "external-id":
+			hop.ExternalID = value
+		case strings.HasPrefix(name, "tag:") || strings.HasPrefix(name, "transitive-tag:"):
+			key := name[strings.Index(name, ":")+1:]
+			if len(key) == 0 {
+				return nil, fmt.Errorf("Invalid option '%s' of role %s; session tags must have a key", part, hop.RoleARN)
+			}
+			if _, exists := hop.Tags[key]; exists {
+				return nil, fmt.Errorf("Session tag %s of role %s is repeated", key, hop.RoleARN)
+			}
+			hop.Tags[key] = value
+			if strings.HasPrefix(name, "transitive-tag:") {
+				hop.TransitiveTagKeys = append(hop.TransitiveTagKeys, key)
+			}
+		default:
+			return nil, fmt.Errorf("Unknown option '%s' of role %s; expected external-id, tag:KEY or transitive-tag:KEY",
+				name, hop.RoleARN)
+		}
+	}
+	return hop, nil
+}
+
+// PrincipalTags returns the session tags of the last role of a chain: its
+// own, and the transitive tags of the roles before it, which can't be set
+// again by later roles. The tags of the roles themselves aren't included.
+func PrincipalTags(chain []*RoleHop) (map[string]string, error) {
+	tags := map[string]string{}
+	transitive := map[string]string{}
+	for i, hop := range chain {
+		for key := range hop.Tags {
+			if earlier, ok := transitive[strings.ToLower(key)]; ok {
+				return nil, fmt.Errorf("Session tag %s of role %s conflicts with the transitive tag %s of an earlier role",
+					key, hop.RoleARN, earlier)
+			}
+		}
+		if i == len(chain)-1 {
+			for key, value := range hop.Tags {
+				tags[key] = value
+			}
+			break
+		}
+		for _, key := range hop.TransitiveTagKeys {
+			transitive[strings.ToLower(key)] = key
+			tags[key] = hop.Tags[key]
+		}
+	}
+	return tags, nil
+}
+
+// PrincipalTagContext returns the context entries of the aws:PrincipalTag
+// keys of the tags
+func PrincipalTagContext(tags map[string]string) map[string]*types.ContextEntryValue {
+	entries := map[string]*types.ContextEntryValue{}
+	for key, value := range tags {
+		entries[principalTagPrefix+key] = &types.ContextEntryValue{Type: "string", Values: []string{value}}
+	}
+	return entries
+}
+
+// WithContext returns copies of the assertions to which the context entries
+// are added, except those whose keys (compared case-insensitively, as by
+// IAM) an assertion sets itself
+func WithContext(assertions []*types.Assertion, entries map[string]*types.ContextEntryValue) []*types.Assertion {
+	if len(entries) == 0 {
+		return assertions
+	}
+	copies := make([]*types.Assertion, len(assertions))
+	for i, assertion := range assertions {
+		copied := *assertion
+		copied.ContextEntries = map[string]*types.ContextEntryValue{}
+		set := map[string]bool{}
+		for key, entry := range assertion.ContextEntries {
+			copied.ContextEntries[key] = entry
+			set[strings.ToLower(key)] = true
+		}
+		for key, entry := range entries {
+			if !set[strings.ToLower(key)] {
+				copied.ContextEntries[key] = entry
+			}
+		}
+		copies[i] = &copied
+	}
+	return copies
+}
+
+// chainCredentials returns the credentials of the last role of the options'
+// chain, each role being assumed with the credentials of the one before it
+// (the first, with those of the session); the credentials of each role are
+// refreshed as they expire
+func chainCredentials(sess *session.Session, options *IAMOptions) *credentials.Credentials {
+	creds := sess.Config.Credentials
+	sessionName := roleSessionName(options)
+	for _, hop := range options.RoleChain {
+		client := newSTS(sess, options)
+		client.Config.Credentials = creds
+		creds = credentials.NewCredentials(&roleHopProvider{
+			Client:          client,
+			Hop:             hop,
+			RoleSessionName: sessionName,
+			Duration:        options.Duration,
+		})
+	}
+	return creds
+}
+
+// roleHopProvider assumes a role of a chain, with its session tags
+type roleHopProvider struct {
+	credentials.Expiry
+
+	Client          *sts.STS
+	Hop             *RoleHop
+	RoleSessionName string
+	Duration        time.Duration
+}
+
+func (p *roleHopProvider) Retrieve() (credentials.Value, error) {
+	input := &sts.AssumeRoleInput{
+		RoleArn:         aws.String(p.Hop.RoleARN),
+		RoleSessionName: aws.String(p.RoleSessionName),
+	}
+	if len(p.Hop.ExternalID) > 0 {
+		input.ExternalId = aws.String(p.Hop.ExternalID)
+	}
+	if p.Duration > 0 {
+		input.DurationSeconds = aws.Int64(int64(p.Duration / time.Second))
+	}
+	req, output := p.Client.AssumeRoleRequest(input)
+	// the session tags of AssumeRole are newer than the SDK's model of STS,
+	// so are added to the request's parameters once they're built
+	req.Handlers.Build.PushBack(p.addSessionTags)
+	if err := req.Send(); err != nil {
+		return credentials.Value{}, fmt.Errorf("Failed to assume role %s of role chain; %v", p.Hop.RoleARN, err)
+	}
+	p.SetExpiration(aws.TimeValue(output.Credentials.Expiration), time.Minute)
+	return credentials.Value{
+		AccessKeyID:     aws.StringValue(output.Credentials.AccessKeyId),
+		SecretAccessKey: aws.StringValue(output.Credentials.SecretAccessKey),
+		SessionToken:    aws.StringValue(output.Credentials.SessionToken),
+		ProviderName:    "RoleChainProvider",
+	}, nil
+}
+
+func (p *roleHopProvider) addSessionTags(r *request.Request) {
+	if r.Error != nil {
+		return
+	}
+	body := url.Values{
+		"Action":  {r.Operation.Name},
+		"Version": {r.ClientInfo.APIVersion},
+	}
+	if err := queryutil.Parse(body, r.Params, false); err != nil {
+		r.Error = awserr.New("SerializationError", "failed encoding Query request", err)
+		return
+	}
+	keys := []string{}
+	for key := range p.Hop.Tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for i, key := range keys {
+		body.Set(fmt.Sprintf("Tags.member.%d.Key", i+1), key)
+		body.Set(fmt.Sprintf("Tags.member.%d.Value", i+1), p.Hop.Tags[key])
+	}
+	for i, key := range p.Hop.TransitiveTagKeys {
+		body.Set(fmt.Sprintf("TransitiveTagKeys.member.%d", i+1), key)
+	}
+	r.SetBufferBody([]byte(body.Encode()))
+}
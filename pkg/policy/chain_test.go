@@ -0,0 +1,145 @@
+package policy_test
+
+import (
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/matt-deboer/assert-aws-iam-permissions/pkg/policy"
+	"github.com/matt-deboer/assert-aws-iam-permissions/pkg/types"
+)
+
+func TestParseRoleHop(t *testing.T) {
+
+	hop, err := policy.ParseRoleHop("arn:aws:iam::123456789012:role/ci; external-id=a=b;tag:pipeline=42;transitive-tag:team=web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := &policy.RoleHop{
+		RoleARN:           "arn:aws:iam::123456789012:role/ci",
+		ExternalID:        "a=b",
+		Tags:              map[string]string{"pipeline": "42", "team": "web"},
+		TransitiveTagKeys: []string{"team"},
+	}
+	if !reflect.DeepEqual(hop, expected) {
+		t.Errorf("expected %v, but got %v", expected, hop)
+	}
+
+	for spec, message := range map[string]string{
+		"arn:aws:iam::123456789012:user/alice":                    "Invalid role ARN",
+		"arn:aws:iam::123456789012:role/ci;external-id":           "Invalid option 'external-id'",
+		"arn:aws:iam::123456789012:role/ci;tag:=x":                "session tags must have a key",
+		"arn:aws:iam::123456789012:role/ci;tag:a=1;tag:a=2":       "Session tag a of role arn:aws:iam::123456789012:role/ci is repeated",
+		"arn:aws:iam::123456789012:role/ci;session-name=pipeline": "Unknown option 'session-name'",
+	} {
+		if _, err := policy.ParseRoleHop(spec); err == nil || !strings.Contains(err.Error(), message) {
+			t.Errorf("%s: expected the error %q, but got %v", spec, message, err)
+		}
+	}
+}
+
+func TestPrincipalTags(t *testing.T) {
+
+	chain := []*policy.RoleHop{
+		{RoleARN: "arn:aws:iam::123456789012:role/a", Tags: map[string]string{"team": "web", "pipeline": "42"},
+			TransitiveTagKeys: []string{"team"}},
+		{RoleARN: "arn:aws:iam::123456789012:role/b", Tags: map[string]string{"project": "x", "cost": "1"},
+			TransitiveTagKeys: []string{"project"}},
+		{RoleARN: "arn:aws:iam::123456789012:role/c", Tags: map[string]string{"stage": "prod"}},
+	}
+	tags, err := policy.PrincipalTags(chain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{"team": "web", "project": "x", "stage": "prod"}
+	if !reflect.DeepEqual(tags, expected) {
+		t.Errorf("expected %v, but got %v", expected, tags)
+	}
+
+	chain[2].Tags["Team"] = "db"
+	if _, err = policy.PrincipalTags(chain); err == nil || !strings.Contains(err.Error(), "conflicts with the transitive tag team") {
+		t.Errorf("expected a conflicting tag, but got %v", err)
+	}
+}
+
+func TestWithContext(t *testing.T) {
+
+	assertions := []*types.Assertion{
+		{Comment: "a"},
+		{Comment: "b", ContextEntries: map[string]*types.ContextEntryValue{
+			"aws:principaltag/team": {Type: "string", Values: []string{"db"}},
+		}},
+	}
+	tagged := policy.WithContext(assertions, policy.PrincipalTagContext(map[string]string{"team": "web", "stage": "prod"}))
+
+	if len(assertions[0].ContextEntries) != 0 || len(assertions[1].ContextEntries) != 1 {
+		t.Errorf("expected the assertions not to be modified, but got %v, %v", assertions[0], assertions[1])
+	}
+	if entry := tagged[0].ContextEntries["aws:PrincipalTag/team"]; entry == nil || entry.Values[0] != "web" ||
+		len(tagged[0].ContextEntries) != 2 {
+		t.Errorf("unexpected context %v", tagged[0].ContextEntries)
+	}
+	if _, ok := tagged[1].ContextEntries["aws:PrincipalTag/team"]; ok || len(tagged[1].ContextEntries) != 2 {
+		t.Errorf("expected the assertion's own tag to be kept, but got %v", tagged[1].ContextEntries)
+	}
+}
+
+func TestNewIAM_RoleChain(t *testing.T) {
+
+	defer setEnv(map[string]string{"AWS_ACCESS_KEY_ID": "AKID", "AWS_SECRET_ACCESS_KEY": "SECRET", "AWS_PROFILE": ""})()
+
+	assumed := []url.Values{}
+	signers := []string{}
+	stsServer := newStandInSTS(t, func(form url.Values, authorization string) {
+		assumed = append(assumed, form)
+		signers = append(signers, authorization)
+	})
+	defer stsServer.Close()
+	var signedBy string
+	iamServer := newFakeIAM(t, testDetails(), func(authorization string) { signedBy = authorization })
+	defer iamServer.Close()
+
+	iamSvc, err := policy.NewIAM(&policy.IAMOptions{
+		Endpoint:        iamServer.URL,
+		STSEndpoint:     stsServer.URL,
+		RoleSessionName: "ci-audit",
+		RoleChain: []*policy.RoleHop{
+			{RoleARN: "arn:aws:iam::111111111111:role/ci", Tags: map[string]string{"team": "web", "pipeline": "42"},
+				TransitiveTagKeys: []string{"team"}},
+			{RoleARN: "arn:aws:iam::222222222222:role/deployer", ExternalID: "the-external-id", Tags: map[string]string{}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = iamSvc.GetPolicy(&iam.GetPolicyInput{PolicyArn: aws.String(testPolicyArn)}); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(assumed) != 2 {
+		t.Fatalf("expected 2 roles to be assumed, but got %v", assumed)
+	}
+	expected := []map[string]string{
+		{"Action": "AssumeRole", "RoleArn": "arn:aws:iam::111111111111:role/ci", "RoleSessionName": "ci-audit",
+			"Tags.member.1.Key": "pipeline", "Tags.member.1.Value": "42",
+			"Tags.member.2.Key": "team", "Tags.member.2.Value": "web", "TransitiveTagKeys.member.1": "team"},
+		{"Action": "AssumeRole", "RoleArn": "arn:aws:iam::222222222222:role/deployer", "RoleSessionName": "ci-audit",
+			"ExternalId": "the-external-id", "Tags.member.1.Key": ""},
+	}
+	for i, params := range expected {
+		for key, value := range params {
+			if assumed[i].Get(key) != value {
+				t.Errorf("role %d: expected %s to be %q, but got %q", i, key, value, assumed[i].Get(key))
+			}
+		}
+	}
+	if !strings.Contains(signers[0], "Credential=AKID/") || !strings.Contains(signers[1], "Credential=ASIAROLE/") {
+		t.Errorf("expected each role to be assumed with the credentials of the one before it, but got %v", signers)
+	}
+	if !strings.Contains(signedBy, "Credential=ASIAROLE/") {
+		t.Errorf("expected the IAM request to be signed by the last role's credentials, but got %s", signedBy)
+	}
+}
@@ -0,0 +1,225 @@
+package policy
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type conditionOperator struct {
+	// compare reports whether a request value satisfies a policy value
+	compare func(requestValue, policyValue string) (bool, error)
+	// negated operators (StringNotEquals etc.) are satisfied when no
+	// policy value matches
+	negated bool
+}
+
+var conditionOperators = map[string]*conditionOperator{
+	"StringEquals":              {compare: stringEquals},
+	"StringNotEquals":           {compare: stringEquals, negated: true},
+	"StringEqualsIgnoreCase":    {compare: stringEqualsIgnoreCase},
+	"StringNotEqualsIgnoreCase": {compare: stringEqualsIgnoreCase, negated: true},
+	"StringLike":                {compare: stringLike},
+	"StringNotLike":             {compare: stringLike, negated: true},
+	"NumericEquals":             {compare: numeric(func(r, p float64) bool { return r == p })},
+	"NumericNotEquals":          {compare: numeric(func(r, p float64) bool { return r == p }), negated: true},
+	"NumericLessThan":           {compare: numeric(func(r, p float64) bool { return r < p })},
+	"NumericLessThanEquals":     {compare: numeric(func(r, p float64) bool { return r <= p })},
+	"NumericGreaterThan":        {compare: numeric(func(r, p float64) bool { return r > p })},
+	"NumericGreaterThanEquals":  {compare: numeric(func(r, p float64) bool { return r >= p })},
+	"DateEquals":                {compare: date(func(r, p time.Time) bool { return r.Equal(p) })},
+	"DateNotEquals":             {compare: date(func(r, p time.Time) bool { return r.Equal(p) }), negated: true},
+	"DateLessThan":              {compare: date(func(r, p time.Time) bool { return r.Before(p) })},
+	"DateLessThanEquals":        {compare: date(func(r, p time.Time) bool { return !r.After(p) })},
+	"DateGreaterThan":           {compare: date(func(r, p time.Time) bool { return r.After(p) })},
+	"DateGreaterThanEquals":     {compare: date(func(r, p time.Time) bool { return !r.Before(p) })},
+	"Bool":                      {compare: boolEquals},
+	"BinaryEquals":              {compare: binaryEquals},
+	"IpAddress":                 {compare: ipAddress},
+	"NotIpAddress":              {compare: ipAddress, negated: true},
+	"ArnEquals":                 {compare: arnLike},
+	"ArnNotEquals":              {compare: arnLike, negated: true},
+	"ArnLike":                   {compare: arnLike},
+	"ArnNotLike":                {compare: arnLike, negated: true},
+}
+
+// evaluateConditions reports whether every condition in the block is
+// satisfied by the request context; context keys are expected in lower case
+func evaluateConditions(conditions map[string]map[string]Value, context map[string][]string) (bool, error) {
+	for operatorName, keys := range conditions {
+		for key, policyValues := range keys {
+			satisfied, err := evaluateCondition(operatorName, key, policyValues, context)
+			if err != nil {
+				return false, err
+			}
+			if !satisfied {
+				return false, nil
+			}
+		}
+	}
+	return true, nil
+}
+
+func evaluateCondition(operatorName, key string, policyValues []string, context map[string][]string) (bool, error) {
+	requestValues, present := context[strings.ToLower(key)]
+	present = present && len(requestValues) > 0
+
+	baseName := operatorName
+	forAll := strings.HasPrefix(baseName, "ForAllValues:")
+	baseName = strings.TrimPrefix(strings.TrimPrefix(baseName, "ForAllValues:"), "ForAnyValue:")
+
+	if baseName == "Null" {
+		if len(policyValues) != 1 {
+			return false, fmt.Errorf("Null condition on '%s' must have a single value", key)
+		}
+		expectAbsent, err := strconv.ParseBool(policyValues[0])
+		if err != nil {
+			return false, fmt.Errorf("Null condition on '%s' has invalid value '%s'", key, policyValues[0])
+		}
+		return expectAbsent != present, nil
+	}
+
+	ifExists := strings.HasSuffix(baseName, "IfExists")
+	baseName = strings.TrimSuffix(baseName, "IfExists")
+	operator, ok := conditionOperators[baseName]
+	if !ok {
+		return false, fmt.Errorf("Unsupported condition operator '%s'", operatorName)
+	}
+
+	if !present {
+		// a missing key satisfies IfExists operators, ForAllValues (which is
+		// vacuously true for an empty set) and the negated operators
+		return ifExists || forAll || operator.negated, nil
+	}
+
+	// matches reports whether a single request value matches any policy value
+	matches := func(requestValue string) (bool, error) {
+		for _, policyValue := range substituteAll(policyValues, context) {
+			matched, err := operator.compare(requestValue, policyValue)
+			if err != nil {
+				return false, fmt.Errorf("Condition %s on '%s': %v", operatorName, key, err)
+			}
+			if matched {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+
+	if forAll {
+		for _, requestValue := range requestValues {
+			matched, err := matches(requestValue)
+			if err != nil {
+				return false, err
+			}
+			if matched == operator.negated {
+				return false, nil
+			}
+		}
+		return true, nil
+	}
+
+	// single-valued and ForAnyValue conditions are satisfied when any
+	// request value satisfies the operator
+	for _, requestValue := range requestValues {
+		matched, err := matches(requestValue)
+		if err != nil {
+			return false, err
+		}
+		if matched != operator.negated {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func stringEquals(requestValue, policyValue string) (bool, error) {
+	return requestValue == policyValue, nil
+}
+
+func stringEqualsIgnoreCase(requestValue, policyValue string) (bool, error) {
+	return strings.EqualFold(requestValue, policyValue), nil
+}
+
+func stringLike(requestValue, policyValue string) (bool, error) {
+	return matchWildcard(policyValue, requestValue, false), nil
+}
+
+func arnLike(requestValue, policyValue string) (bool, error) {
+	return matchARN(policyValue, requestValue), nil
+}
+
+func numeric(compare func(r, p float64) bool) func(string, string) (bool, error) {
+	return func(requestValue, policyValue string) (bool, error) {
+		r, err := strconv.ParseFloat(requestValue, 64)
+		if err != nil {
+			return false, fmt.Errorf("'%s' is not a number", requestValue)
+		}
+		p, err := strconv.ParseFloat(policyValue, 64)
+		if err != nil {
+			return false, fmt.Errorf("'%s' is not a number", policyValue)
+		}
+		return compare(r, p), nil
+	}
+}
+
+func parseDate(value string) (time.Time, error) {
+	if epoch, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(epoch, 0), nil
+	}
+	for _, layout := range []string{time.RFC3339, "2006-01-02T15:04:05Z", "2006-01-02"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("'%s' is not a date", value)
+}
+
+func date(compare func(r, p time.Time) bool) func(string, string) (bool, error) {
+	return func(requestValue, policyValue string) (bool, error) {
+		r, err := parseDate(requestValue)
+		if err != nil {
+			return false, err
+		}
+		p, err := parseDate(policyValue)
+		if err != nil {
+			return false, err
+		}
+		return compare(r, p), nil
+	}
+}
+
+func boolEquals(requestValue, policyValue string) (bool, error) {
+	return strings.EqualFold(requestValue, policyValue), nil
+}
+
+func binaryEquals(requestValue, policyValue string) (bool, error) {
+	p, err := base64.StdEncoding.DecodeString(policyValue)
+	if err != nil {
+		return false, fmt.Errorf("'%s' is not base-64 encoded", policyValue)
+	}
+	r, err := base64.StdEncoding.DecodeString(requestValue)
+	if err != nil {
+		r = []byte(requestValue)
+	}
+	return bytes.Equal(r, p), nil
+}
+
+func ipAddress(requestValue, policyValue string) (bool, error) {
+	ip := net.ParseIP(requestValue)
+	if ip == nil {
+		return false, fmt.Errorf("'%s' is not an IP address", requestValue)
+	}
+	if !strings.Contains(policyValue, "/") {
+		return ip.Equal(net.ParseIP(policyValue)), nil
+	}
+	_, network, err := net.ParseCIDR(policyValue)
+	if err != nil {
+		return false, fmt.Errorf("'%s' is not a CIDR block", policyValue)
+	}
+	return network.Contains(ip), nil
+}
@@ -0,0 +1,205 @@
+package policy
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/aws/aws-sdk-go/service/iam/iamiface"
+	"github.com/matt-deboer/assert-aws-iam-permissions/pkg/types"
+)
+
+// ContextKeys returns the context keys the document reads, both as condition
+// keys and as policy variables, sorted and without (case-insensitive) duplicates
+func (d *Document) ContextKeys() []string {
+	keys := []string{}
+	for _, statement := range d.Statement {
+		keys = statement.appendContextKeys(keys)
+	}
+	return sortKeys(keys)
+}
+
+func (s *Statement) appendContextKeys(keys []string) []string {
+	for _, conditions := range s.Condition {
+		for key, values := range conditions {
+			keys = appendUnique(keys, key)
+			keys = appendVariables(keys, values)
+		}
+	}
+	keys = appendVariables(keys, s.Resource)
+	return appendVariables(keys, s.NotResource)
+}
+
+// appendVariables adds the keys of the policy variables within values,
+// skipping the escape variables ${*}, ${?} and ${$}
+func appendVariables(keys []string, values []string) []string {
+	for _, value := range values {
+		for _, match := range policyVariablePattern.FindAllStringSubmatch(value, -1) {
+			// variables may carry a default value, as in ${aws:username, 'none'}
+			name := strings.TrimSpace(strings.SplitN(match[1], ",", 2)[0])
+			switch name {
+			case "*", "?", "$":
+				continue
+			}
+			keys = appendUnique(keys, name)
+		}
+	}
+	return keys
+}
+
+func sortKeys(keys []string) []string {
+	sort.Slice(keys, func(i, j int) bool {
+		return strings.ToLower(keys[i]) < strings.ToLower(keys[j])
+	})
+	return keys
+}
+
+// PolicyContextKeys lists the context keys read by the policies, using
+// GetContextKeysForCustomPolicy when iamSvc is provided, and extracting
+// them locally otherwise
+func PolicyContextKeys(iamSvc iamiface.IAMAPI, policies []string) ([]string, error) {
+	if iamSvc != nil {
+		output, err := iamSvc.GetContextKeysForCustomPolicy(&iam.GetContextKeysForCustomPolicyInput{
+			PolicyInputList: aws.StringSlice(policies),
+		})
+		if err != nil {
+			return nil, err
+		}
+		keys := []string{}
+		for _, key := range aws.StringValueSlice(output.ContextKeyNames) {
+			keys = appendUnique(keys, key)
+		}
+		return sortKeys(keys), nil
+	}
+	keys := []string{}
+	for _, policyJSON := range policies {
+		doc, err := ParseDocument(policyJSON)
+		if err != nil {
+			return nil, err
+		}
+		for _, key := range doc.ContextKeys() {
+			keys = appendUnique(keys, key)
+		}
+	}
+	return sortKeys(keys), nil
+}
+
+// LintAssertions checks the context entries of each assertion against the
+// policies (and the assertion's resource policy), warning when an assertion
+// supplies none of the condition keys of a statement applying to one of its
+// actions, and when it supplies keys which no policy reads; the cells of
+// matrix assertions are checked one by one, with the context of each
+func LintAssertions(assertions []*types.Assertion, policies []string) ([]string, error) {
+	docs := []*Document{}
+	for _, policyJSON := range policies {
+		doc, err := ParseDocument(policyJSON)
+		if err != nil {
+			return nil, err
+		}
+		docs = append(docs, doc)
+	}
+
+	warnings := []string{}
+	for i, assertion := range assertions {
+		label := assertion.Comment
+		if len(label) == 0 {
+			label = fmt.Sprintf("Assertion[%d]", i)
+		}
+		cells, err := ExpandMatrix([]*types.Assertion{assertion})
+		if err != nil {
+			return nil, err
+		}
+		for _, cell := range cells {
+			cellLabel := label
+			if len(cell.MatrixCell) > 0 {
+				cellLabel += " " + cell.MatrixCell
+			}
+			cellWarnings, err := lintAssertion(cellLabel, cell, docs)
+			if err != nil {
+				return nil, err
+			}
+			warnings = append(warnings, cellWarnings...)
+		}
+	}
+	return warnings, nil
+}
+
+func lintAssertion(label string, assertion *types.Assertion, docs []*Document) ([]string, error) {
+	if len(assertion.ResourcePolicy) > 0 {
+		doc, err := ParseDocument(assertion.ResourcePolicy)
+		if err != nil {
+			return nil, fmt.Errorf("%s: resource policy: %v", label, err)
+		}
+		docs = append(append([]*Document{}, docs...), doc)
+	}
+	context := NewContext(assertion.ContextEntries)
+
+	warnings := []string{}
+	read := []string{}
+	for _, doc := range docs {
+		for j, statement := range doc.Statement {
+			read = statement.appendContextKeys(read)
+			if len(statement.Condition) == 0 {
+				continue
+			}
+			conditionKeys := sortKeys(statement.appendContextKeys([]string{}))
+			if suppliesAny(context, conditionKeys) {
+				continue
+			}
+			for _, action := range assertion.ActionNames {
+				if statement.appliesTo(action, assertion.ResourceArns) {
+					warnings = append(warnings, fmt.Sprintf("%s: statement %s applies to %s under conditions on %s, but context_entries supplies none of them",
+						label, statement.Label(j), action, strings.Join(conditionKeys, ", ")))
+					break
+				}
+			}
+		}
+	}
+
+	for _, key := range sortedEntryKeys(assertion.ContextEntries) {
+		if len(appendUnique(read, key)) > len(read) {
+			warnings = append(warnings, fmt.Sprintf("%s: context key %s is never read by the policy", label, key))
+		}
+	}
+	return warnings, nil
+}
+
+// appliesTo reports whether the statement's action and resource elements
+// match the action on any of the resources; with no resources, only the
+// action is considered
+func (s *Statement) appliesTo(action string, resources []string) bool {
+	if (len(s.Action) > 0 && !matchAny(s.Action, action, true)) ||
+		(len(s.NotAction) > 0 && matchAny(s.NotAction, action, true)) {
+		return false
+	}
+	if len(resources) == 0 {
+		return true
+	}
+	for _, resource := range resources {
+		if (len(s.Resource) == 0 || matchAny(s.Resource, resource, false) || policyVariablePattern.MatchString(strings.Join(s.Resource, ""))) &&
+			(len(s.NotResource) == 0 || !matchAny(s.NotResource, resource, false)) {
+			return true
+		}
+	}
+	return false
+}
+
+func suppliesAny(context map[string][]string, keys []string) bool {
+	for _, key := range keys {
+		if _, ok := context[strings.ToLower(key)]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+func sortedEntryKeys(entries map[string]*types.ContextEntryValue) []string {
+	keys := make([]string, 0, len(entries))
+	for key := range entries {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,133 @@
+package policy
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/matt-deboer/assert-aws-iam-permissions/pkg/types"
+)
+
+const testConditionedPolicy = `
+{
+	"Version": "2012-10-17",
+	"Statement": [
+		{
+			"Sid": "HomeDirectory",
+			"Effect": "Allow",
+			"Action": "s3:*",
+			"Resource": "arn:aws:s3:::home/${aws:username}/*"
+		},
+		{
+			"Sid": "RequireEncryption",
+			"Effect": "Deny",
+			"Action": "s3:PutObject",
+			"Resource": "*",
+			"Condition": {
+				"StringNotEquals": {"s3:x-amz-server-side-encryption": "aws:kms"},
+				"Null": {"s3:x-amz-server-side-encryption": "false"}
+			}
+		},
+		{
+			"Effect": "Allow",
+			"Action": "ec2:*",
+			"Resource": "*",
+			"Condition": {"IpAddress": {"aws:SourceIp": "10.0.0.0/8"}}
+		}
+	]
+}
+`
+
+func TestContextKeys(t *testing.T) {
+	keys, err := PolicyContextKeys(nil, []string{testConditionedPolicy})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "aws:SourceIp,aws:username,s3:x-amz-server-side-encryption"
+	if strings.Join(keys, ",") != expected {
+		t.Errorf("expected keys %s, but got %s", expected, strings.Join(keys, ","))
+	}
+}
+
+func TestLintAssertions(t *testing.T) {
+	assertions := []*types.Assertion{
+		&types.Assertion{
+			Comment:        "unencrypted uploads are denied",
+			ActionNames:    []string{"s3:PutObject"},
+			ResourceArns:   []string{"arn:aws:s3:::home/alice/key"},
+			ExpectedResult: "denied",
+			ContextEntries: map[string]*types.ContextEntryValue{
+				"aws:username": &types.ContextEntryValue{Values: []string{"alice"}},
+			},
+		},
+		&types.Assertion{
+			ActionNames:    []string{"ec2:RunInstances"},
+			ExpectedResult: "allowed",
+			ContextEntries: map[string]*types.ContextEntryValue{
+				"aws:SourecIp": &types.ContextEntryValue{Values: []string{"10.0.0.1"}},
+			},
+		},
+		&types.Assertion{
+			Comment:        "reads are allowed",
+			ActionNames:    []string{"s3:GetObject"},
+			ResourceArns:   []string{"arn:aws:s3:::home/alice/key"},
+			ExpectedResult: "allowed",
+			ContextEntries: map[string]*types.ContextEntryValue{
+				"AWS:UserName": &types.ContextEntryValue{Values: []string{"alice"}},
+			},
+		},
+	}
+	warnings, err := LintAssertions(assertions, []string{testConditionedPolicy})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"unencrypted uploads are denied: statement RequireEncryption applies to s3:PutObject under conditions on " +
+			"s3:x-amz-server-side-encryption, but context_entries supplies none of them",
+		"Assertion[1]: statement Statement[2] applies to ec2:RunInstances under conditions on aws:SourceIp, " +
+			"but context_entries supplies none of them",
+		"Assertion[1]: context key aws:SourecIp is never read by the policy",
+	}
+	if strings.Join(warnings, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("expected warnings:\n%s\nbut got:\n%s", strings.Join(expected, "\n"), strings.Join(warnings, "\n"))
+	}
+}
+
+func TestLintAssertions_Matrix(t *testing.T) {
+	assertions := []*types.Assertion{
+		&types.Assertion{
+			Comment: "uploads",
+			Matrix: &types.Matrix{
+				ActionNames:  []string{"s3:PutObject"},
+				ResourceArns: []string{"arn:aws:s3:::home/alice/key"},
+				Contexts: map[string]map[string]*types.ContextEntryValue{
+					"encrypted": {
+						"aws:username":                    &types.ContextEntryValue{Values: []string{"alice"}},
+						"s3:x-amz-server-side-encryption": &types.ContextEntryValue{Values: []string{"aws:kms"}},
+					},
+					"unencrypted": {
+						"aws:username": &types.ContextEntryValue{Values: []string{"alice"}},
+						"aws:SourecIp": &types.ContextEntryValue{Values: []string{"10.0.0.1"}},
+					},
+				},
+				Rules: []*types.MatrixRule{
+					{Contexts: []string{"encrypted"}, ExpectedResult: "allowed"},
+					{Contexts: []string{"unencrypted"}, ExpectedResult: "denied"},
+				},
+			},
+		},
+	}
+	warnings, err := LintAssertions(assertions, []string{testConditionedPolicy})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"uploads matrix[action=s3:PutObject, resource=arn:aws:s3:::home/alice/key, context=unencrypted]: statement " +
+			"RequireEncryption applies to s3:PutObject under conditions on s3:x-amz-server-side-encryption, but " +
+			"context_entries supplies none of them",
+		"uploads matrix[action=s3:PutObject, resource=arn:aws:s3:::home/alice/key, context=unencrypted]: context key " +
+			"aws:SourecIp is never read by the policy",
+	}
+	if strings.Join(warnings, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("expected warnings:\n%s\nbut got:\n%s", strings.Join(expected, "\n"), strings.Join(warnings, "\n"))
+	}
+}
@@ -0,0 +1,182 @@
+package policy
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/aws/aws-sdk-go/service/sts/stsiface"
+)
+
+// The durations allowed for the sessions of assumed roles
+const (
+	MinRoleDuration = 15 * time.Minute
+	MaxRoleDuration = 12 * time.Hour
+)
+
+// globalRegion is the region in which the requests of the global IAM service
+// (and STS, by default) are signed
+const globalRegion = "us-east-1"
+
+// IAMOptions configure the session and credentials of an IAM client; when
+// AssumeRoleARN is set, the role is assumed with the credentials of the
+// session, or with the web identity token of WebIdentityTokenFile; when
+// RoleChain is set, each of its roles is assumed in turn
+type IAMOptions struct {
+	// Profile names the shared config profile of the session; by default,
+	// that of AWS_PROFILE (or 'default')
+	Profile string
+	Region  string
+	// Endpoint is the URL to which IAM API calls are sent, in place of the
+	// IAM API (such as that of a stand-in server)
+	Endpoint    string
+	STSEndpoint string
+
+	AssumeRoleARN   string
+	ExternalID      string
+	RoleSessionName string
+	// Duration is the duration of the role's session; by default, that of
+	// the SDK (15 minutes)
+	Duration time.Duration
+	// MFASerial is the serial number (or ARN) of the MFA device whose token
+	// code is required to assume the role, as returned by TokenProvider;
+	// TokenProvider also supplies the token codes of profiles requiring MFA
+	MFASerial     string
+	TokenProvider func() (string, error)
+
+	WebIdentityTokenFile string
+
+	// RoleChain lists roles assumed one after another, each with the
+	// credentials of the one before it, sharing RoleSessionName and Duration
+	RoleChain []*RoleHop
+}
+
+// NewIAM creates an IAM client with the session and credentials of the
+// options; credentials are resolved by the client's first request
+func NewIAM(options *IAMOptions) (*iam.IAM, error) {
+	sessionOptions := session.Options{
+		Profile:                 options.Profile,
+		SharedConfigState:       session.SharedConfigEnable,
+		AssumeRoleTokenProvider: options.TokenProvider,
+	}
+	if len(options.Region) > 0 {
+		sessionOptions.Config.Region = aws.String(options.Region)
+	}
+	sess, err := session.NewSessionWithOptions(sessionOptions)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create AWS session; %v", err)
+	}
+
+	config := &aws.Config{}
+	if len(options.Endpoint) > 0 {
+		config.Endpoint = aws.String(options.Endpoint)
+		if len(aws.StringValue(sess.Config.Region)) == 0 {
+			config.Region = aws.String(globalRegion)
+		}
+	}
+	if len(options.AssumeRoleARN) > 0 {
+		config.Credentials = roleCredentials(sess, options)
+	} else if len(options.RoleChain) > 0 {
+		config.Credentials = chainCredentials(sess, options)
+	}
+	return iam.New(sess, config), nil
+}
+
+// newSTS creates an STS client of the session, sending its requests to the
+// options' STS endpoint, if set
+func newSTS(sess *session.Session, options *IAMOptions) *sts.STS {
+	config := &aws.Config{}
+	if len(options.STSEndpoint) > 0 {
+		config.Endpoint = aws.String(options.STSEndpoint)
+		if len(aws.StringValue(sess.Config.Region)) == 0 {
+			config.Region = aws.String(globalRegion)
+		}
+	}
+	return sts.New(sess, config)
+}
+
+// roleCredentials returns the credentials of the options' role, assumed with
+// the session's credentials or the web identity token
+func roleCredentials(sess *session.Session, options *IAMOptions) *credentials.Credentials {
+	sessionName := roleSessionName(options)
+	if len(options.WebIdentityTokenFile) > 0 {
+		return credentials.NewCredentials(&WebIdentityProvider{
+			Client:          newSTS(sess, options),
+			RoleARN:         options.AssumeRoleARN,
+			RoleSessionName: sessionName,
+			Duration:        options.Duration,
+			TokenFile:       options.WebIdentityTokenFile,
+		})
+	}
+	return stscreds.NewCredentialsWithClient(newSTS(sess, options), options.AssumeRoleARN, func(p *stscreds.AssumeRoleProvider) {
+		p.RoleSessionName = sessionName
+		if options.Duration > 0 {
+			p.Duration = options.Duration
+		}
+		if len(options.ExternalID) > 0 {
+			p.ExternalID = aws.String(options.ExternalID)
+		}
+		if len(options.MFASerial) > 0 {
+			p.SerialNumber = aws.String(options.MFASerial)
+			p.TokenProvider = options.TokenProvider
+		}
+	})
+}
+
+// roleSessionName returns the options' role session name, or by default one
+// unique to the process
+func roleSessionName(options *IAMOptions) string {
+	if len(options.RoleSessionName) > 0 {
+		return options.RoleSessionName
+	}
+	return fmt.Sprintf("assert-aws-iam-permissions-%d", time.Now().UnixNano())
+}
+
+// WebIdentityProvider retrieves the credentials of a role with
+// AssumeRoleWithWebIdentity, using the OIDC token of a file (such as that
+// issued to a CI job), which is read again whenever the credentials expire
+type WebIdentityProvider struct {
+	credentials.Expiry
+
+	Client          stsiface.STSAPI
+	RoleARN         string
+	RoleSessionName string
+	// Duration is the duration of the role's session; by default, an hour
+	Duration  time.Duration
+	TokenFile string
+}
+
+// Retrieve assumes the role with the token of the file
+func (p *WebIdentityProvider) Retrieve() (credentials.Value, error) {
+	token, err := ioutil.ReadFile(p.TokenFile)
+	if err != nil {
+		return credentials.Value{}, fmt.Errorf("Failed to read web identity token; %v", err)
+	}
+	input := &sts.AssumeRoleWithWebIdentityInput{
+		RoleArn:          aws.String(p.RoleARN),
+		RoleSessionName:  aws.String(p.RoleSessionName),
+		WebIdentityToken: aws.String(strings.TrimSpace(string(token))),
+	}
+	if p.Duration > 0 {
+		input.DurationSeconds = aws.Int64(int64(p.Duration / time.Second))
+	}
+	output, err := p.Client.AssumeRoleWithWebIdentity(input)
+	if err != nil {
+		return credentials.Value{}, fmt.Errorf("Failed to assume role %s with web identity; %v", p.RoleARN, err)
+	}
+	// credentials are refreshed shortly before they expire
+	p.SetExpiration(aws.TimeValue(output.Credentials.Expiration), time.Minute)
+	return credentials.Value{
+		AccessKeyID:     aws.StringValue(output.Credentials.AccessKeyId),
+		SecretAccessKey: aws.StringValue(output.Credentials.SecretAccessKey),
+		SessionToken:    aws.StringValue(output.Credentials.SessionToken),
+		ProviderName:    "WebIdentityProvider",
+	}, nil
+}
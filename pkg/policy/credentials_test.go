@@ -0,0 +1,148 @@
+package policy_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/matt-deboer/assert-aws-iam-permissions/pkg/policy"
+)
+
+// newStandInSTS starts a local server answering AssumeRole and
+// AssumeRoleWithWebIdentity with the credentials ASIAROLE, passing the form
+// and Authorization header of each request to requested
+func newStandInSTS(t *testing.T, requested func(form url.Values, authorization string)) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		requested(r.Form, r.Header.Get("Authorization"))
+		action := r.Form.Get("Action")
+		w.Header().Set("Content-Type", "text/xml")
+		fmt.Fprintf(w, `<%sResponse><%sResult><Credentials><AccessKeyId>ASIAROLE</AccessKeyId>`+
+			`<SecretAccessKey>SECRET</SecretAccessKey><SessionToken>TOKEN</SessionToken>`+
+			`<Expiration>%s</Expiration></Credentials></%sResult></%sResponse>`,
+			action, action, time.Now().Add(time.Hour).UTC().Format(time.RFC3339), action, action)
+	}))
+}
+
+func setEnv(env map[string]string) func() {
+	previous := map[string]string{}
+	for key, value := range env {
+		previous[key] = os.Getenv(key)
+		os.Setenv(key, value)
+	}
+	return func() {
+		for key, value := range previous {
+			os.Setenv(key, value)
+		}
+	}
+}
+
+func TestNewIAM_AssumeRole(t *testing.T) {
+
+	defer setEnv(map[string]string{"AWS_ACCESS_KEY_ID": "AKID", "AWS_SECRET_ACCESS_KEY": "SECRET", "AWS_PROFILE": ""})()
+
+	var assumed url.Values
+	stsServer := newStandInSTS(t, func(form url.Values, authorization string) {
+		assumed = form
+		if !strings.Contains(authorization, "Credential=AKID/") {
+			t.Errorf("expected AssumeRole to be signed by the environment's credentials, but got %s", authorization)
+		}
+	})
+	defer stsServer.Close()
+	var signedBy string
+	iamServer := newFakeIAM(t, testDetails(), func(authorization string) { signedBy = authorization })
+	defer iamServer.Close()
+
+	iamSvc, err := policy.NewIAM(&policy.IAMOptions{
+		Region:          "eu-west-1",
+		Endpoint:        iamServer.URL,
+		STSEndpoint:     stsServer.URL,
+		AssumeRoleARN:   "arn:aws:iam::123456789012:role/auditor",
+		ExternalID:      "the-external-id",
+		RoleSessionName: "ci-audit",
+		Duration:        time.Hour,
+		MFASerial:       "arn:aws:iam::123456789012:mfa/alice",
+		TokenProvider:   func() (string, error) { return "123456", nil },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = iamSvc.GetPolicy(&iam.GetPolicyInput{PolicyArn: aws.String(testPolicyArn)}); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]string{
+		"Action":          "AssumeRole",
+		"RoleArn":         "arn:aws:iam::123456789012:role/auditor",
+		"ExternalId":      "the-external-id",
+		"RoleSessionName": "ci-audit",
+		"DurationSeconds": "3600",
+		"SerialNumber":    "arn:aws:iam::123456789012:mfa/alice",
+		"TokenCode":       "123456",
+	}
+	for key, value := range expected {
+		if assumed.Get(key) != value {
+			t.Errorf("expected %s to be %s, but got %s", key, value, assumed.Get(key))
+		}
+	}
+	if !strings.Contains(signedBy, "Credential=ASIAROLE/") || !strings.Contains(signedBy, "/eu-west-1/iam/") {
+		t.Errorf("expected the IAM request to be signed by the role's credentials, but got %s", signedBy)
+	}
+}
+
+func TestWebIdentityProvider(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "credentials")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	tokenFile := filepath.Join(dir, "token")
+	if err = ioutil.WriteFile(tokenFile, []byte("the.oidc.token\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	var assumed url.Values
+	stsServer := newStandInSTS(t, func(form url.Values, authorization string) {
+		assumed = form
+		if len(authorization) > 0 {
+			t.Errorf("expected AssumeRoleWithWebIdentity to be unsigned, but got %s", authorization)
+		}
+	})
+	defer stsServer.Close()
+
+	sess := session.Must(session.NewSession(&aws.Config{Region: aws.String("us-east-1"), Endpoint: aws.String(stsServer.URL)}))
+	provider := &policy.WebIdentityProvider{
+		Client:          sts.New(sess),
+		RoleARN:         "arn:aws:iam::123456789012:role/ci",
+		RoleSessionName: "pipeline-42",
+		TokenFile:       tokenFile,
+	}
+	value, err := provider.Retrieve()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value.AccessKeyID != "ASIAROLE" || value.SessionToken != "TOKEN" || provider.IsExpired() {
+		t.Errorf("unexpected credentials %v", value)
+	}
+	if assumed.Get("Action") != "AssumeRoleWithWebIdentity" || assumed.Get("WebIdentityToken") != "the.oidc.token" ||
+		assumed.Get("RoleSessionName") != "pipeline-42" || len(assumed.Get("DurationSeconds")) > 0 {
+		t.Errorf("unexpected request %v", assumed)
+	}
+
+	provider.TokenFile = filepath.Join(dir, "missing")
+	if _, err = provider.Retrieve(); err == nil || !strings.HasPrefix(err.Error(), "Failed to read web identity token") {
+		t.Errorf("expected a failure to read the token, but got %v", err)
+	}
+}
@@ -0,0 +1,106 @@
+package policy
+
+import (
+	"fmt"
+
+	"github.com/matt-deboer/assert-aws-iam-permissions/pkg/types"
+)
+
+// resolveResourceOwner returns the resource owner for the assertion; for
+// 'cross_account' assertions without an explicit owner, it is derived from
+// the account ID found in the assertion's resource ARNs
+func resolveResourceOwner(assertion *types.Assertion) (string, error) {
+	if len(assertion.ResourceOwner) > 0 || !assertion.CrossAccount {
+		return assertion.ResourceOwner, nil
+	}
+	var owner *ARN
+	for _, resourceArn := range assertion.ResourceArns {
+		arn := ParseARN(resourceArn)
+		if arn == nil || len(arn.Account) == 0 {
+			continue
+		}
+		if owner != nil && owner.Account != arn.Account {
+			return "", fmt.Errorf("Cannot derive resource_owner for '%s'; resource ARNs belong to multiple accounts (%s, %s)",
+				assertion.Comment, owner.Account, arn.Account)
+		}
+		owner = arn
+	}
+	if owner == nil {
+		return "", fmt.Errorf("Cannot derive resource_owner for '%s'; none of the resource ARNs contain an account ID",
+			assertion.Comment)
+	}
+	return fmt.Sprintf("arn:%s:iam::%s:root", owner.Partition, owner.Account), nil
+}
+
+// isCrossAccount reports whether the caller and the resource owner are in
+// different accounts
+func isCrossAccount(callerArn, resourceOwner string) bool {
+	callerAccount := AccountOf(callerArn)
+	ownerAccount := AccountOf(resourceOwner)
+	return len(callerAccount) > 0 && len(ownerAccount) > 0 && callerAccount != ownerAccount
+}
+
+// combineDecisions merges the identity policy and resource policy
+// decisions: an explicit deny on either side wins; within an account
+// either side may grant access, but across accounts both sides must
+func combineDecisions(identityDecision, resourceDecision string, crossAccount bool) string {
+	if identityDecision == ExplicitDeny || resourceDecision == ExplicitDeny {
+		return ExplicitDeny
+	}
+	identityAllowed := identityDecision == Allowed
+	resourceAllowed := resourceDecision == Allowed
+	if (crossAccount && identityAllowed && resourceAllowed) || (!crossAccount && (identityAllowed || resourceAllowed)) {
+		return Allowed
+	}
+	return ImplicitDeny
+}
+
+// describeDecision reports which side of the evaluation granted or
+// blocked access
+func describeDecision(identityDecision, resourceDecision string, crossAccount bool) string {
+	scope := "same-account"
+	if crossAccount {
+		scope = "cross-account"
+	}
+	return fmt.Sprintf("%s, identity policy: %s, resource policy: %s; %s", scope,
+		identityDecision, resourceDecision, attributeDecision(identityDecision, resourceDecision, crossAccount))
+}
+
+// describeIdentityDecision reports the decision of the identity policy, when
+// no resource policy is involved
+func describeIdentityDecision(identityDecision string) string {
+	attribution := "not granted by the identity policy"
+	switch identityDecision {
+	case Allowed:
+		attribution = "granted by the identity policy"
+	case ExplicitDeny:
+		attribution = "explicitly denied by the identity policy"
+	}
+	return fmt.Sprintf("identity policy: %s; %s", identityDecision, attribution)
+}
+
+func attributeDecision(identityDecision, resourceDecision string, crossAccount bool) string {
+	identityAllowed := identityDecision == Allowed
+	resourceAllowed := resourceDecision == Allowed
+	switch {
+	case identityDecision == ExplicitDeny && resourceDecision == ExplicitDeny:
+		return "explicitly denied by both policies"
+	case identityDecision == ExplicitDeny:
+		return "explicitly denied by the identity policy"
+	case resourceDecision == ExplicitDeny:
+		return "explicitly denied by the resource policy"
+	case identityAllowed && resourceAllowed:
+		return "granted by both policies"
+	case crossAccount && !identityAllowed && !resourceAllowed:
+		return "not granted by either policy"
+	case crossAccount && !identityAllowed:
+		return "blocked by the identity policy"
+	case crossAccount:
+		return "blocked by the resource policy"
+	case identityAllowed:
+		return "granted by the identity policy"
+	case resourceAllowed:
+		return "granted by the resource policy"
+	}
+	return "not granted by either policy"
+}
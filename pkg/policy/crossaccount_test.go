@@ -0,0 +1,67 @@
+package policy
+
+import (
+	"testing"
+
+	"github.com/matt-deboer/assert-aws-iam-permissions/pkg/types"
+)
+
+func TestCombineDecisions(t *testing.T) {
+	cases := []struct {
+		identity, resource string
+		crossAccount       bool
+		expected           string
+	}{
+		{Allowed, ImplicitDeny, false, Allowed},
+		{ImplicitDeny, Allowed, false, Allowed},
+		{Allowed, ImplicitDeny, true, ImplicitDeny},
+		{ImplicitDeny, Allowed, true, ImplicitDeny},
+		{Allowed, Allowed, true, Allowed},
+		{Allowed, ExplicitDeny, false, ExplicitDeny},
+		{ExplicitDeny, Allowed, true, ExplicitDeny},
+	}
+	for _, c := range cases {
+		if decision := combineDecisions(c.identity, c.resource, c.crossAccount); decision != c.expected {
+			t.Errorf("identity: %s, resource: %s, cross-account: %v; expected '%s', but got '%s'",
+				c.identity, c.resource, c.crossAccount, c.expected, decision)
+		}
+	}
+}
+
+func TestResolveResourceOwner(t *testing.T) {
+	assertion := &types.Assertion{
+		CrossAccount: true,
+		CallerArn:    "arn:aws:iam::123456789012:user/alice",
+		ResourceArns: []string{"arn:aws:sqs:us-east-1:210987654321:queue"},
+	}
+	owner, err := resolveResourceOwner(assertion)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if owner != "arn:aws:iam::210987654321:root" {
+		t.Errorf("unexpected resource owner '%s'", owner)
+	}
+
+	assertion.ResourceArns = []string{"arn:aws:s3:::my-bucket"}
+	if _, err := resolveResourceOwner(assertion); err == nil {
+		t.Error("expected an error for resource ARNs without an account ID")
+	}
+
+	sameAccount := &types.Assertion{
+		CallerArn:     "arn:aws:iam::123456789012:user/alice",
+		ResourceOwner: "arn:aws:iam::123456789012:root",
+	}
+	if isCrossAccount(sameAccount.CallerArn, sameAccount.ResourceOwner) {
+		t.Error("expected caller and owner in the same account not to be cross-account")
+	}
+
+	// cross_account only derives the owner, which may turn out to be the
+	// caller's own account
+	assertion.ResourceArns = []string{"arn:aws:sqs:us-east-1:123456789012:queue"}
+	if owner, err = resolveResourceOwner(assertion); err != nil {
+		t.Fatal(err)
+	}
+	if isCrossAccount(assertion.CallerArn, owner) {
+		t.Error("expected a cross_account assertion on a resource of the caller's account not to be cross-account")
+	}
+}
@@ -0,0 +1,191 @@
+package policy
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Document is the parsed form of an IAM policy document
+type Document struct {
+	Version   string     `json:"Version,omitempty"`
+	ID        string     `json:"Id,omitempty"`
+	Statement Statements `json:"Statement"`
+}
+
+// Statements is the list of statements in a policy document; a document
+// may contain either a single statement object or an array of them
+type Statements []*Statement
+
+// Statement is a single statement within a policy document
+type Statement struct {
+	Sid          string                      `json:"Sid,omitempty"`
+	Effect       string                      `json:"Effect"`
+	Principal    *Principal                  `json:"Principal,omitempty"`
+	NotPrincipal *Principal                  `json:"NotPrincipal,omitempty"`
+	Action       Value                       `json:"Action,omitempty"`
+	NotAction    Value                       `json:"NotAction,omitempty"`
+	Resource     Value                       `json:"Resource,omitempty"`
+	NotResource  Value                       `json:"NotResource,omitempty"`
+	Condition    map[string]map[string]Value `json:"Condition,omitempty"`
+
+	// Start and End locate the statement within the source document
+	Start Position `json:"-"`
+	End   Position `json:"-"`
+}
+
+// Position is a 1-based line and column within a policy document
+type Position struct {
+	Line   int
+	Column int
+}
+
+// Value is a policy element which may be written either as a single
+// string or as an array of strings
+type Value []string
+
+// Principal maps a principal type ("AWS", "Service", "Federated" or
+// "CanonicalUser") to the principals of that type; the wildcard principal
+// "*" is represented as {"*": ["*"]}
+type Principal map[string]Value
+
+// ParseDocument parses the provided policy document JSON
+func ParseDocument(policyJSON string) (*Document, error) {
+	var doc Document
+	if err := json.Unmarshal([]byte(policyJSON), &doc); err != nil {
+		return nil, fmt.Errorf("Failed to parse policy document; %v", err)
+	}
+	offsets := statementOffsets(policyJSON)
+	for i, statement := range doc.Statement {
+		if statement == nil {
+			return nil, fmt.Errorf("Policy statement %d is empty", i)
+		}
+		if i < len(offsets) {
+			statement.Start = positionOf(policyJSON, offsets[i][0])
+			statement.End = positionOf(policyJSON, offsets[i][1])
+		}
+		if statement.Effect != "Allow" && statement.Effect != "Deny" {
+			return nil, fmt.Errorf("Policy statement %s has invalid Effect '%s'", statement.Label(i), statement.Effect)
+		}
+	}
+	return &doc, nil
+}
+
+// statementOffsets returns the start and end byte offsets of each statement
+// in the document; it returns nil if the statements can't be located
+func statementOffsets(policyJSON string) [][2]int {
+	dec := json.NewDecoder(strings.NewReader(policyJSON))
+	// nextValue returns the offset of the next value, skipping separators
+	nextValue := func() int {
+		offset := int(dec.InputOffset())
+		for offset < len(policyJSON) && strings.ContainsRune(" \t\r\n:,", rune(policyJSON[offset])) {
+			offset++
+		}
+		return offset
+	}
+	if token, err := dec.Token(); err != nil || token != json.Delim('{') {
+		return nil
+	}
+	for dec.More() {
+		key, err := dec.Token()
+		if err != nil {
+			return nil
+		}
+		start := nextValue()
+		var raw json.RawMessage
+		if key != "Statement" || start >= len(policyJSON) || policyJSON[start] != '[' {
+			if err := dec.Decode(&raw); err != nil {
+				return nil
+			}
+			if key == "Statement" {
+				return [][2]int{{start, int(dec.InputOffset())}}
+			}
+			continue
+		}
+		offsets := [][2]int{}
+		dec.Token()
+		for dec.More() {
+			start := nextValue()
+			if err := dec.Decode(&raw); err != nil {
+				return nil
+			}
+			offsets = append(offsets, [2]int{start, int(dec.InputOffset())})
+		}
+		return offsets
+	}
+	return nil
+}
+
+func positionOf(text string, offset int) Position {
+	preceding := text[:offset]
+	line := strings.Count(preceding, "\n") + 1
+	return Position{Line: line, Column: offset - strings.LastIndex(preceding, "\n")}
+}
+
+// Label returns a name for the statement at the given index, suitable for
+// display: the Sid when one is present, otherwise the statement's position
+func (s *Statement) Label(index int) string {
+	if len(s.Sid) > 0 {
+		return s.Sid
+	}
+	return fmt.Sprintf("Statement[%d]", index)
+}
+
+// UnmarshalJSON accepts either a single statement object or an array
+func (s *Statements) UnmarshalJSON(data []byte) error {
+	if trimmed := strings.TrimSpace(string(data)); strings.HasPrefix(trimmed, "{") {
+		var statement Statement
+		if err := json.Unmarshal(data, &statement); err != nil {
+			return err
+		}
+		*s = Statements{&statement}
+		return nil
+	}
+	var statements []*Statement
+	if err := json.Unmarshal(data, &statements); err != nil {
+		return err
+	}
+	*s = statements
+	return nil
+}
+
+// UnmarshalJSON accepts either a single string or an array of strings
+func (v *Value) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*v = Value{single}
+		return nil
+	}
+	var values []string
+	if err := json.Unmarshal(data, &values); err != nil {
+		return fmt.Errorf("expected a string or an array of strings, but got %s", string(data))
+	}
+	*v = values
+	return nil
+}
+
+// UnmarshalJSON accepts either the wildcard "*" or a map of principal types
+func (p *Principal) UnmarshalJSON(data []byte) error {
+	var wildcard string
+	if err := json.Unmarshal(data, &wildcard); err == nil {
+		if wildcard != "*" {
+			return fmt.Errorf("principal must be \"*\" or an object, but got %s", string(data))
+		}
+		*p = Principal{"*": Value{"*"}}
+		return nil
+	}
+	var principals map[string]Value
+	if err := json.Unmarshal(data, &principals); err != nil {
+		return err
+	}
+	*p = principals
+	return nil
+}
+
+// MarshalJSON writes the wildcard principal back out in its short form
+func (p Principal) MarshalJSON() ([]byte, error) {
+	if values, ok := p["*"]; ok && len(p) == 1 && len(values) == 1 && values[0] == "*" {
+		return []byte(`"*"`), nil
+	}
+	return json.Marshal(map[string]Value(p))
+}
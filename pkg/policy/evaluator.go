@@ -0,0 +1,197 @@
+package policy
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/aws/aws-sdk-go/service/iam/iamiface"
+	"github.com/matt-deboer/assert-aws-iam-permissions/pkg/types"
+)
+
+// Evaluator evaluates assertions against the combination of policy
+// documents, returning a result for each evaluated action and resource; an
+// error is returned when the assertions could not be evaluated, rather than
+// when they fail
+type Evaluator interface {
+	Evaluate(assertions []*types.Assertion, policies []string) ([]*Result, error)
+}
+
+// Results are the results of evaluated assertions
+type Results []*Result
+
+// Passed reports whether every result satisfied its assertion
+func (r Results) Passed() bool {
+	return len(r.Failed()) == 0
+}
+
+// Failed returns the results which did not satisfy their assertions
+func (r Results) Failed() Results {
+	failed := Results{}
+	for _, result := range r {
+		if !result.Passed {
+			failed = append(failed, result)
+		}
+	}
+	return failed
+}
+
+// Err joins the messages of the failed results into a single error, or
+// returns nil when every result passed
+func (r Results) Err() error {
+	messages := []string{}
+	for _, result := range r.Failed() {
+		messages = append(messages, result.Message())
+	}
+	if len(messages) > 0 {
+		return fmt.Errorf("%s", strings.Join(messages, ","))
+	}
+	return nil
+}
+
+// NewEvaluator returns an AWSEvaluator using iamSvc, or a LocalEvaluator
+// when iamSvc is nil
+func NewEvaluator(iamSvc iamiface.IAMAPI) Evaluator {
+	if iamSvc == nil {
+		return NewLocalEvaluator()
+	}
+	return NewAWSEvaluator(iamSvc)
+}
+
+// AWSEvaluator evaluates assertions with the IAM policy simulator
+type AWSEvaluator struct {
+	IAM iamiface.IAMAPI
+}
+
+// NewAWSEvaluator creates an evaluator calling the policy simulator with
+// iamSvc, which may be any implementation of the IAM API (such as a mock)
+func NewAWSEvaluator(iamSvc iamiface.IAMAPI) *AWSEvaluator {
+	return &AWSEvaluator{IAM: iamSvc}
+}
+
+// Evaluate evaluates the assertions with SimulateCustomPolicy; assertions
+// against no policies are evaluated locally, since the simulator requires one
+func (e *AWSEvaluator) Evaluate(assertions []*types.Assertion, policies []string) ([]*Result, error) {
+	if len(policies) == 0 {
+		return evaluateSimulated(assertions, policies, SimulateLocally)
+	}
+	return evaluateSimulated(assertions, policies, e.IAM.SimulateCustomPolicy)
+}
+
+// EvaluatePrincipal evaluates the assertions against the policies of an
+// existing IAM user, group or role with SimulatePrincipalPolicy; when
+// policyJSON is not empty, it is included as an additional policy
+func (e *AWSEvaluator) EvaluatePrincipal(principalARN string, assertions []*types.Assertion, policyJSON string) ([]*Result, error) {
+	policies := []string{}
+	if len(policyJSON) > 0 {
+		policies = append(policies, policyJSON)
+	}
+	return evaluateSimulated(assertions, policies, func(input *iam.SimulateCustomPolicyInput) (*iam.SimulatePolicyResponse, error) {
+		return e.IAM.SimulatePrincipalPolicy(&iam.SimulatePrincipalPolicyInput{
+			PolicySourceArn: aws.String(principalARN),
+			PolicyInputList: input.PolicyInputList,
+			ActionNames:     input.ActionNames,
+			ResourceArns:    input.ResourceArns,
+			CallerArn:       input.CallerArn,
+			ResourceOwner:   input.ResourceOwner,
+			ResourcePolicy:  input.ResourcePolicy,
+			ContextEntries:  input.ContextEntries,
+		})
+	})
+}
+
+// LocalEvaluator evaluates assertions with the local engine, without calling AWS
+type LocalEvaluator struct{}
+
+// NewLocalEvaluator creates an evaluator using the local engine
+func NewLocalEvaluator() *LocalEvaluator {
+	return &LocalEvaluator{}
+}
+
+// Evaluate evaluates the assertions with the local engine
+func (e *LocalEvaluator) Evaluate(assertions []*types.Assertion, policies []string) ([]*Result, error) {
+	return evaluateSimulated(assertions, policies, SimulateLocally)
+}
+
+// Interaction is a request to SimulateCustomPolicy, with its response
+type Interaction struct {
+	Input    *iam.SimulateCustomPolicyInput `json:"input"`
+	Response *iam.SimulatePolicyResponse    `json:"response"`
+}
+
+// Recording holds the interactions of the policy simulator, by the
+// SimulationKey of their input
+type Recording struct {
+	mu           sync.Mutex
+	interactions map[string]*Interaction
+}
+
+// NewRecording creates an empty recording
+func NewRecording() *Recording {
+	return &Recording{interactions: map[string]*Interaction{}}
+}
+
+// Record adds the response to a simulation to the recording, returning the
+// interaction recorded and its key
+func (r *Recording) Record(input *iam.SimulateCustomPolicyInput, response *iam.SimulatePolicyResponse) (string, *Interaction) {
+	key := SimulationKey(input)
+	interaction := &Interaction{Input: NormalizeSimulation(input), Response: response}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.interactions[key] = interaction
+	return key, interaction
+}
+
+// Interactions returns the recorded interactions, by the key of their input
+func (r *Recording) Interactions() map[string]*Interaction {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	interactions := map[string]*Interaction{}
+	for key, interaction := range r.interactions {
+		interactions[key] = interaction
+	}
+	return interactions
+}
+
+// SimulateCustomPolicy returns the recorded response to the input, or a
+// *NotRecordedError when there is none
+func (r *Recording) SimulateCustomPolicy(input *iam.SimulateCustomPolicyInput) (*iam.SimulatePolicyResponse, error) {
+	key := SimulationKey(input)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	interaction, ok := r.interactions[key]
+	if !ok {
+		return nil, &NotRecordedError{Key: key, Input: input}
+	}
+	return interaction.Response, nil
+}
+
+// NotRecordedError is returned for simulations missing from a recording
+type NotRecordedError struct {
+	Key   string
+	Input *iam.SimulateCustomPolicyInput
+}
+
+func (e *NotRecordedError) Error() string {
+	return fmt.Sprintf("No recorded simulation %s of %s on %s; the simulation must be recorded again", e.Key,
+		strings.Join(aws.StringValueSlice(e.Input.ActionNames), ", "), strings.Join(aws.StringValueSlice(e.Input.ResourceArns), ", "))
+}
+
+// RecordedEvaluator evaluates assertions with the responses of the policy
+// simulator held by a recording, without calling AWS
+type RecordedEvaluator struct {
+	Recording *Recording
+}
+
+// NewRecordedEvaluator creates an evaluator replaying the recording
+func NewRecordedEvaluator(recording *Recording) *RecordedEvaluator {
+	return &RecordedEvaluator{Recording: recording}
+}
+
+// Evaluate evaluates the assertions with the recorded responses, failing
+// with a *NotRecordedError for any simulation not recorded
+func (e *RecordedEvaluator) Evaluate(assertions []*types.Assertion, policies []string) ([]*Result, error) {
+	return evaluateSimulated(assertions, policies, e.Recording.SimulateCustomPolicy)
+}
@@ -0,0 +1,120 @@
+package policy
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/aws/aws-sdk-go/service/iam/iamiface"
+	"github.com/matt-deboer/assert-aws-iam-permissions/pkg/types"
+)
+
+// fakeSimulator answers SimulateCustomPolicy with the local engine,
+// counting its calls
+type fakeSimulator struct {
+	iamiface.IAMAPI
+	calls int
+}
+
+func (f *fakeSimulator) SimulateCustomPolicy(input *iam.SimulateCustomPolicyInput) (*iam.SimulatePolicyResponse, error) {
+	f.calls++
+	return SimulateLocally(input)
+}
+
+func testEvaluatorAssertions() []*types.Assertion {
+	return []*types.Assertion{
+		{
+			Comment:        "Can list the bucket",
+			ActionNames:    []string{"s3:ListBucket"},
+			ResourceArns:   []string{"arn:aws:s3:::my-bucket"},
+			ExpectedResult: "allowed",
+			ContextEntries: map[string]*types.ContextEntryValue{
+				"aws:SourceIp":        {Type: "ip", Values: []string{"10.0.0.1"}},
+				"aws:SecureTransport": {Type: "boolean", Values: []string{"true"}},
+				"s3:prefix":           {Values: []string{"reports/"}},
+			},
+		},
+		{
+			Comment:        "Can delete the bucket",
+			ActionNames:    []string{"s3:DeleteBucket"},
+			ResourceArns:   []string{"arn:aws:s3:::my-bucket"},
+			ExpectedResult: "allowed",
+		},
+	}
+}
+
+func TestAWSEvaluator(t *testing.T) {
+
+	simulator := &fakeSimulator{}
+	results, err := AssertPermissions(NewAWSEvaluator(simulator), testEvaluatorAssertions(), testPolicy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if simulator.calls != 2 || len(results) != 2 {
+		t.Fatalf("expected 2 simulations and results, but got %d and %d", simulator.calls, len(results))
+	}
+	failed := results.Failed()
+	if results.Passed() || len(failed) != 1 || failed[0].Action != "s3:DeleteBucket" || failed[0].Decision != ImplicitDeny {
+		t.Errorf("unexpected results %v", results)
+	}
+	expected := "[POLICY ASSERTION FAILED] Can delete the bucket ( for s3:DeleteBucket [ arn:aws:s3:::my-bucket ]: " +
+		"expected 'allowed', but got 'implicitDeny'; identity policy: implicitDeny; not granted by the identity policy )"
+	if err = results.Err(); err == nil || err.Error() != expected {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestRecordedEvaluator(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "cassette")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	simulator := &fakeSimulator{}
+	recorder, err := NewRecorder(simulator, filepath.Join(dir, "suite"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected, err := NewAWSEvaluator(recorder).Evaluate(testEvaluatorAssertions(), []string{testPolicy})
+	if err != nil {
+		t.Fatal(err)
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "suite", "*.json"))
+	if err != nil || len(files) != 2 {
+		t.Fatalf("expected 2 cassette files, but got %v %v", files, err)
+	}
+	data, err := ioutil.ReadFile(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "null") || !strings.Contains(string(data), `"ActionNames": [`) {
+		t.Errorf("unexpected cassette file:\n%s", data)
+	}
+
+	recording, err := LoadRecording(filepath.Join(dir, "suite"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the context entries of equal simulations are built from maps, in any order
+	assertions := testEvaluatorAssertions()
+	results, err := NewRecordedEvaluator(recording).Evaluate(assertions, []string{testPolicy})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if simulator.calls != 2 || len(results) != 2 ||
+		results[0].Decision != expected[0].Decision || results[1].Decision != expected[1].Decision ||
+		results[0].MatchedStatements[0] != expected[0].MatchedStatements[0] {
+		t.Errorf("unexpected replayed results %v", results)
+	}
+
+	assertions[0].ResourceArns = []string{"arn:aws:s3:::other-bucket"}
+	_, err = NewAWSEvaluator(NewReplayer(recording)).Evaluate(assertions, []string{testPolicy})
+	if e, ok := err.(*NotRecordedError); !ok || !strings.HasSuffix(e.Error(), "of s3:ListBucket on arn:aws:s3:::other-bucket; the simulation must be recorded again") {
+		t.Errorf("expected a *NotRecordedError, but got %v", err)
+	}
+}
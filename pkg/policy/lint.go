@@ -0,0 +1,127 @@
+package policy
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Rules of the findings of LintPolicy
+const (
+	// RulePrivilegeEscalation flags statements allowing actions with which a
+	// principal can grant itself further permissions
+	RulePrivilegeEscalation = "privilege-escalation"
+	// RuleWildcardResource flags statements allowing actions other than
+	// reads on every resource
+	RuleWildcardResource = "wildcard-resource"
+)
+
+// escalationActions can be used to escalate privileges, by changing the
+// policies, credentials or trust of a principal, or by running code as one
+var escalationActions = []string{
+	"iam:AddUserToGroup",
+	"iam:AttachGroupPolicy",
+	"iam:AttachRolePolicy",
+	"iam:AttachUserPolicy",
+	"iam:CreateAccessKey",
+	"iam:CreateLoginProfile",
+	"iam:CreatePolicyVersion",
+	"iam:PassRole",
+	"iam:PutGroupPolicy",
+	"iam:PutRolePolicy",
+	"iam:PutUserPolicy",
+	"iam:SetDefaultPolicyVersion",
+	"iam:UpdateAssumeRolePolicy",
+	"iam:UpdateLoginProfile",
+	"lambda:UpdateFunctionCode",
+	"sts:AssumeRole",
+}
+
+// readOnlyPrefixes are the action name prefixes of actions which only read
+var readOnlyPrefixes = []string{"Describe", "Get", "List"}
+
+// Finding is a potential problem with a statement of a policy
+type Finding struct {
+	Rule string
+	// Statement labels the statement, which starts at Position
+	Statement string
+	Position  Position
+	Message   string
+}
+
+// LintPolicy checks the Allow statements of the policy for actions which
+// allow privilege escalation, and for writes allowed on every resource
+func LintPolicy(policyJSON string) ([]*Finding, error) {
+	doc, err := ParseDocument(policyJSON)
+	if err != nil {
+		return nil, err
+	}
+	findings := []*Finding{}
+	for i, statement := range doc.Statement {
+		if statement.Effect != "Allow" {
+			continue
+		}
+		label := statement.Label(i)
+		newFinding := func(rule, format string, args ...interface{}) *Finding {
+			return &Finding{Rule: rule, Statement: label, Position: statement.Start, Message: fmt.Sprintf(format, args...)}
+		}
+
+		escalations := []string{}
+		for _, action := range escalationActions {
+			if statement.allowsAction(action) {
+				escalations = append(escalations, action)
+			}
+		}
+		if len(escalations) > 0 {
+			findings = append(findings, newFinding(RulePrivilegeEscalation,
+				"Statement %s allows %s, which can be used to escalate privileges", label, strings.Join(escalations, ", ")))
+		}
+
+		if !contains(statement.Resource, "*") {
+			continue
+		}
+		writes := []string{}
+		for _, action := range statement.Action {
+			if !isReadOnly(action) {
+				writes = append(writes, action)
+			}
+		}
+		if len(statement.NotAction) > 0 {
+			writes = append(writes, "all actions except "+strings.Join(statement.NotAction, ", "))
+		}
+		if len(writes) > 0 {
+			findings = append(findings, newFinding(RuleWildcardResource,
+				"Statement %s allows %s on all resources ('*')", label, strings.Join(writes, ", ")))
+		}
+	}
+	return findings, nil
+}
+
+func (s *Statement) allowsAction(action string) bool {
+	if len(s.NotAction) > 0 {
+		return !matchAny(s.NotAction, action, true)
+	}
+	return matchAny(s.Action, action, true)
+}
+
+// isReadOnly reports whether the action pattern matches only reads
+func isReadOnly(action string) bool {
+	parts := strings.SplitN(action, ":", 2)
+	if len(parts) != 2 {
+		return false
+	}
+	for _, prefix := range readOnlyPrefixes {
+		if strings.HasPrefix(strings.ToLower(parts[1]), strings.ToLower(prefix)) {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
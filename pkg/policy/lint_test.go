@@ -0,0 +1,38 @@
+package policy
+
+import (
+	"testing"
+)
+
+func TestLintPolicy(t *testing.T) {
+	policyJSON := `{
+  "Version": "2012-10-17",
+  "Statement": [
+    {"Sid": "Describe", "Effect": "Allow", "Action": ["ec2:Describe*", "s3:GetObject"], "Resource": "*"},
+    {"Sid": "Records", "Effect": "Allow", "Action": ["route53:ChangeResourceRecordSets", "route53:List*"], "Resource": "*"},
+    {"Sid": "Roles", "Effect": "Allow", "Action": ["iam:Attach*Policy", "iam:PassRole"], "Resource": "arn:aws:iam::123456789012:role/app-*"},
+    {"Effect": "Allow", "NotAction": "iam:*", "Resource": "*"},
+    {"Effect": "Deny", "Action": "*", "Resource": "*"}
+  ]
+}`
+	findings, err := LintPolicy(policyJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Finding{
+		{RuleWildcardResource, "Records", Position{5, 5}, "Statement Records allows route53:ChangeResourceRecordSets on all resources ('*')"},
+		{RulePrivilegeEscalation, "Roles", Position{6, 5}, "Statement Roles allows iam:AttachGroupPolicy, iam:AttachRolePolicy, " +
+			"iam:AttachUserPolicy, iam:PassRole, which can be used to escalate privileges"},
+		{RulePrivilegeEscalation, "Statement[3]", Position{7, 5}, "Statement Statement[3] allows lambda:UpdateFunctionCode, sts:AssumeRole, " +
+			"which can be used to escalate privileges"},
+		{RuleWildcardResource, "Statement[3]", Position{7, 5}, "Statement Statement[3] allows all actions except iam:* on all resources ('*')"},
+	}
+	if len(findings) != len(expected) {
+		t.Fatalf("expected %d findings, but got %d: %+v", len(expected), len(findings), findings)
+	}
+	for i, finding := range findings {
+		if *finding != expected[i] {
+			t.Errorf("expected finding %+v, but got %+v", expected[i], *finding)
+		}
+	}
+}
@@ -0,0 +1,286 @@
+package policy
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/matt-deboer/assert-aws-iam-permissions/pkg/types"
+)
+
+// Evaluation decisions, matching those returned by the policy simulator
+const (
+	Allowed      = "allowed"
+	ExplicitDeny = "explicitDeny"
+	ImplicitDeny = "implicitDeny"
+)
+
+var policyVariablePattern = regexp.MustCompile(`\$\{([^}]+)\}`)
+
+// Request describes a single action against a single resource, to be
+// evaluated locally against a policy document
+type Request struct {
+	Action   string
+	Resource string
+	// Principal is the caller; it is only consulted for statements which
+	// have a Principal or NotPrincipal element
+	Principal string
+	// PrincipalType is one of the Principal* constants; it is inferred
+	// from Principal when empty
+	PrincipalType string
+	// Context holds the request context values, keyed by lower-cased key
+	Context map[string][]string
+}
+
+// Evaluation is the outcome of evaluating a Request against a Document
+type Evaluation struct {
+	Decision string
+	// MatchedStatements labels the statements which determined the decision
+	MatchedStatements []string
+	// MissingContextValues lists the condition keys of statements matching
+	// the action and resource which were absent from the request context
+	MissingContextValues []string
+
+	matched []*Statement
+}
+
+// NewContext converts assertion context entries into the form used by
+// Request, with keys folded to lower case as IAM treats them
+func NewContext(entries map[string]*types.ContextEntryValue) map[string][]string {
+	context := make(map[string][]string, len(entries))
+	for key, entry := range entries {
+		if entry != nil {
+			context[strings.ToLower(key)] = entry.Values
+		}
+	}
+	return context
+}
+
+// Evaluate applies the standard IAM evaluation logic to the request: an
+// applicable Deny statement wins, otherwise any applicable Allow statement
+// grants access, otherwise access is implicitly denied
+func (d *Document) Evaluate(req *Request) (*Evaluation, error) {
+	var caller *identity
+	if len(req.Principal) > 0 {
+		caller = newIdentity(req.PrincipalType, req.Principal)
+	}
+	allows, denies := &Evaluation{Decision: Allowed}, &Evaluation{Decision: ExplicitDeny}
+	missing := []string{}
+	for i, statement := range d.Statement {
+		if !statement.matchesRequest(req, caller) {
+			continue
+		}
+		missing = appendMissingKeys(missing, statement.Condition, req.Context)
+		satisfied, err := evaluateConditions(statement.Condition, req.Context)
+		if err != nil {
+			return nil, err
+		}
+		if !satisfied {
+			continue
+		}
+		matches := allows
+		if statement.Effect == "Deny" {
+			matches = denies
+		}
+		matches.MatchedStatements = append(matches.MatchedStatements, statement.Label(i))
+		matches.matched = append(matches.matched, statement)
+	}
+	evaluation := &Evaluation{Decision: ImplicitDeny, MatchedStatements: []string{}}
+	if len(denies.matched) > 0 {
+		evaluation = denies
+	} else if len(allows.matched) > 0 {
+		evaluation = allows
+	}
+	evaluation.MissingContextValues = missing
+	return evaluation, nil
+}
+
+// matchesRequest reports whether the statement's principal, action and
+// resource elements match the request, without considering its conditions
+func (s *Statement) matchesRequest(req *Request, caller *identity) bool {
+	if s.Principal != nil && (caller == nil || !s.Principal.matches(caller)) {
+		return false
+	}
+	if s.NotPrincipal != nil && (caller == nil || s.NotPrincipal.excludes(caller)) {
+		return false
+	}
+	if len(s.Action) > 0 && !matchAny(s.Action, req.Action, true) {
+		return false
+	}
+	if len(s.NotAction) > 0 && matchAny(s.NotAction, req.Action, true) {
+		return false
+	}
+	if len(s.Resource) > 0 && !matchAny(substituteAll(s.Resource, req.Context), req.Resource, false) {
+		return false
+	}
+	if len(s.NotResource) > 0 && matchAny(substituteAll(s.NotResource, req.Context), req.Resource, false) {
+		return false
+	}
+	return true
+}
+
+// appendMissingKeys adds the condition keys absent from the context
+func appendMissingKeys(missing []string, conditions map[string]map[string]Value, context map[string][]string) []string {
+	for _, keys := range conditions {
+		for key := range keys {
+			if _, ok := context[strings.ToLower(key)]; !ok {
+				missing = appendUnique(missing, key)
+			}
+		}
+	}
+	return missing
+}
+
+// appendUnique adds a context key unless it is already present, ignoring case
+func appendUnique(keys []string, key string) []string {
+	for _, existing := range keys {
+		if strings.EqualFold(existing, key) {
+			return keys
+		}
+	}
+	return append(keys, key)
+}
+
+// SimulateLocally stands in for SimulateCustomPolicy, evaluating the input
+// policies with the local engine; as with the simulator, an explicit deny in
+// any policy wins, otherwise any policy may allow the request
+func SimulateLocally(input *iam.SimulateCustomPolicyInput) (*iam.SimulatePolicyResponse, error) {
+	docs := make([]*Document, len(input.PolicyInputList))
+	for i, policyJSON := range input.PolicyInputList {
+		doc, err := ParseDocument(aws.StringValue(policyJSON))
+		if err != nil {
+			return nil, err
+		}
+		docs[i] = doc
+	}
+	context := map[string][]string{}
+	for _, entry := range input.ContextEntries {
+		context[strings.ToLower(aws.StringValue(entry.ContextKeyName))] = aws.StringValueSlice(entry.ContextKeyValues)
+	}
+	resources := aws.StringValueSlice(input.ResourceArns)
+	if len(resources) == 0 {
+		resources = []string{"*"}
+	}
+
+	response := &iam.SimulatePolicyResponse{IsTruncated: aws.Bool(false)}
+	for _, action := range aws.StringValueSlice(input.ActionNames) {
+		for _, resource := range resources {
+			result := &iam.EvaluationResult{
+				EvalActionName:    aws.String(action),
+				EvalResourceName:  aws.String(resource),
+				EvalDecision:      aws.String(ImplicitDeny),
+				MatchedStatements: []*iam.Statement{},
+			}
+			missing := []string{}
+			for i, doc := range docs {
+				evaluation, err := doc.Evaluate(&Request{
+					Action:    action,
+					Resource:  resource,
+					Principal: aws.StringValue(input.CallerArn),
+					Context:   context,
+				})
+				if err != nil {
+					return nil, err
+				}
+				for _, key := range evaluation.MissingContextValues {
+					missing = appendUnique(missing, key)
+				}
+				if evaluation.Decision == ImplicitDeny || aws.StringValue(result.EvalDecision) == ExplicitDeny {
+					continue
+				}
+				if evaluation.Decision == ExplicitDeny {
+					result.MatchedStatements = []*iam.Statement{}
+				}
+				result.EvalDecision = aws.String(evaluation.Decision)
+				for _, statement := range evaluation.matched {
+					result.MatchedStatements = append(result.MatchedStatements, &iam.Statement{
+						SourcePolicyId:   aws.String(fmt.Sprintf("PolicyInputList.%d", i+1)),
+						SourcePolicyType: aws.String("IAM Policy"),
+						StartPosition:    &iam.Position{Line: aws.Int64(int64(statement.Start.Line)), Column: aws.Int64(int64(statement.Start.Column))},
+						EndPosition:      &iam.Position{Line: aws.Int64(int64(statement.End.Line)), Column: aws.Int64(int64(statement.End.Column))},
+					})
+				}
+			}
+			result.MissingContextValues = aws.StringSlice(missing)
+			response.EvaluationResults = append(response.EvaluationResults, result)
+		}
+	}
+	return response, nil
+}
+
+// labelStatements names the statements matched by the simulator, using the
+// Sid of the statement found at the reported position of the source policy
+func labelStatements(statements []*iam.Statement, policies []string) []string {
+	labels := []string{}
+	docs := map[int]*Document{}
+	for _, statement := range statements {
+		sourceID := aws.StringValue(statement.SourcePolicyId)
+		label := sourceID
+		var index int
+		if _, err := fmt.Sscanf(sourceID, "PolicyInputList.%d", &index); err == nil && index > 0 && index <= len(policies) {
+			doc, ok := docs[index]
+			if !ok {
+				doc, _ = ParseDocument(policies[index-1])
+				docs[index] = doc
+			}
+			if found := doc.statementAt(statement.StartPosition); len(found) > 0 {
+				label = found
+				if len(policies) > 1 {
+					label = sourceID + ":" + found
+				}
+			}
+		}
+		labels = append(labels, label)
+	}
+	return labels
+}
+
+// statementAt returns the label of the statement starting at the position,
+// or "" when there is none
+func (d *Document) statementAt(position *iam.Position) string {
+	if d == nil || position == nil {
+		return ""
+	}
+	line, column := int(aws.Int64Value(position.Line)), int(aws.Int64Value(position.Column))
+	for i, statement := range d.Statement {
+		if statement.Start.Line == line && statement.Start.Column == column {
+			return statement.Label(i)
+		}
+	}
+	// the simulator's columns may be offset from ours, so fall back to
+	// matching on the line alone
+	for i, statement := range d.Statement {
+		if statement.Start.Line == line {
+			return statement.Label(i)
+		}
+	}
+	return ""
+}
+
+// substituteAll replaces policy variables such as ${aws:username} with
+// their values from the request context; values referencing a variable
+// missing from the context are dropped, since they can never match
+func substituteAll(values []string, context map[string][]string) []string {
+	substituted := make([]string, 0, len(values))
+	for _, value := range values {
+		resolved := true
+		result := policyVariablePattern.ReplaceAllStringFunc(value, func(variable string) string {
+			name := variable[2 : len(variable)-1]
+			switch name {
+			case "*", "?", "$":
+				return name
+			}
+			if values := context[strings.ToLower(name)]; len(values) > 0 {
+				return values[0]
+			}
+			resolved = false
+			return variable
+		})
+		if resolved {
+			substituted = append(substituted, result)
+		}
+	}
+	return substituted
+}
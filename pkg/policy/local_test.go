@@ -0,0 +1,167 @@
+package policy
+
+import (
+	"testing"
+)
+
+const testResourcePolicy = `
+{
+	"Version": "2012-10-17",
+	"Statement": [
+		{
+			"Sid": "AllowPartnerRead",
+			"Effect": "Allow",
+			"Principal": {"AWS": "arn:aws:iam::210987654321:root"},
+			"Action": ["s3:GetObject", "s3:ListBucket"],
+			"Resource": ["arn:aws:s3:::my-bucket", "arn:aws:s3:::my-bucket/*"]
+		},
+		{
+			"Sid": "DenyInsecureTransport",
+			"Effect": "Deny",
+			"Principal": "*",
+			"Action": "s3:*",
+			"Resource": "arn:aws:s3:::my-bucket/*",
+			"Condition": {
+				"Bool": {"aws:SecureTransport": "false"}
+			}
+		},
+		{
+			"Sid": "DenyAllButAdmins",
+			"Effect": "Deny",
+			"NotPrincipal": {"AWS": [
+				"arn:aws:iam::123456789012:role/admin",
+				"arn:aws:iam::123456789012:root"
+			]},
+			"Action": "s3:DeleteBucket",
+			"Resource": "arn:aws:s3:::my-bucket"
+		}
+	]
+}
+`
+
+func TestEvaluateResourcePolicy(t *testing.T) {
+	doc, err := ParseDocument(testResourcePolicy)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name      string
+		request   *Request
+		decision  string
+		statement string
+	}{
+		{
+			name: "account principal covers roles within the account",
+			request: &Request{Action: "s3:GetObject", Resource: "arn:aws:s3:::my-bucket/key",
+				Principal: "arn:aws:iam::210987654321:role/reader"},
+			decision:  Allowed,
+			statement: "AllowPartnerRead",
+		},
+		{
+			name: "other accounts are not granted",
+			request: &Request{Action: "s3:GetObject", Resource: "arn:aws:s3:::my-bucket/key",
+				Principal: "arn:aws:iam::111111111111:role/reader"},
+			decision: ImplicitDeny,
+		},
+		{
+			name: "condition denies insecure transport",
+			request: &Request{Action: "s3:GetObject", Resource: "arn:aws:s3:::my-bucket/key",
+				Principal: "arn:aws:iam::210987654321:role/reader",
+				Context:   map[string][]string{"aws:securetransport": {"false"}}},
+			decision:  ExplicitDeny,
+			statement: "DenyInsecureTransport",
+		},
+		{
+			name: "not principal exempts sessions of a listed role",
+			request: &Request{Action: "s3:DeleteBucket", Resource: "arn:aws:s3:::my-bucket",
+				Principal: "arn:aws:sts::123456789012:assumed-role/admin/session"},
+			decision: ImplicitDeny,
+		},
+		{
+			name: "not principal denies everyone else",
+			request: &Request{Action: "s3:DeleteBucket", Resource: "arn:aws:s3:::my-bucket",
+				Principal: "arn:aws:iam::123456789012:user/someone"},
+			decision:  ExplicitDeny,
+			statement: "DenyAllButAdmins",
+		},
+	}
+
+	for _, c := range cases {
+		evaluation, err := doc.Evaluate(c.request)
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		if evaluation.Decision != c.decision {
+			t.Errorf("%s: expected '%s', but got '%s'", c.name, c.decision, evaluation.Decision)
+		}
+		if len(c.statement) > 0 && (len(evaluation.MatchedStatements) != 1 || evaluation.MatchedStatements[0] != c.statement) {
+			t.Errorf("%s: expected statement '%s' to match, but got %v", c.name, c.statement, evaluation.MatchedStatements)
+		}
+	}
+}
+
+func TestEvaluateConditionOperators(t *testing.T) {
+	context := map[string][]string{
+		"aws:sourceip":           {"10.1.2.3"},
+		"aws:requesttag/env":     {"prod"},
+		"aws:tagkeys":            {"env", "team"},
+		"s3:max-keys":            {"10"},
+		"aws:principalorgid":     {"o-abc123"},
+		"aws:multifactorauthage": {"300"},
+	}
+	cases := []struct {
+		operator string
+		key      string
+		values   []string
+		expected bool
+	}{
+		{"IpAddress", "aws:SourceIp", []string{"10.0.0.0/8"}, true},
+		{"NotIpAddress", "aws:SourceIp", []string{"10.0.0.0/8"}, false},
+		{"StringEquals", "aws:RequestTag/env", []string{"dev", "prod"}, true},
+		{"StringNotEquals", "aws:RequestTag/env", []string{"prod"}, false},
+		{"StringLike", "aws:PrincipalOrgID", []string{"o-abc*"}, true},
+		{"ForAllValues:StringEquals", "aws:TagKeys", []string{"env", "team", "owner"}, true},
+		{"ForAllValues:StringEquals", "aws:TagKeys", []string{"env"}, false},
+		{"ForAnyValue:StringEquals", "aws:TagKeys", []string{"team"}, true},
+		{"NumericLessThanEquals", "s3:max-keys", []string{"10"}, true},
+		{"NumericGreaterThan", "aws:MultiFactorAuthAge", []string{"3600"}, false},
+		{"StringEquals", "aws:missing", []string{"x"}, false},
+		{"StringEqualsIfExists", "aws:missing", []string{"x"}, true},
+		{"StringNotEquals", "aws:missing", []string{"x"}, true},
+		{"Null", "aws:missing", []string{"true"}, true},
+		{"Null", "aws:SourceIp", []string{"true"}, false},
+	}
+	for _, c := range cases {
+		satisfied, err := evaluateCondition(c.operator, c.key, c.values, context)
+		if err != nil {
+			t.Fatalf("%s %s: %v", c.operator, c.key, err)
+		}
+		if satisfied != c.expected {
+			t.Errorf("%s %s %v: expected %v, but got %v", c.operator, c.key, c.values, c.expected, satisfied)
+		}
+	}
+}
+
+func TestEvaluatePolicyVariables(t *testing.T) {
+	doc, err := ParseDocument(`{
+		"Version": "2012-10-17",
+		"Statement": {
+			"Effect": "Allow",
+			"Action": "s3:*",
+			"Resource": "arn:aws:s3:::home/${aws:username}/*"
+		}
+	}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	request := &Request{Action: "s3:GetObject", Resource: "arn:aws:s3:::home/alice/notes",
+		Context: map[string][]string{"aws:username": {"alice"}}}
+	if evaluation, _ := doc.Evaluate(request); evaluation.Decision != Allowed {
+		t.Errorf("expected '%s', but got '%s'", Allowed, evaluation.Decision)
+	}
+	request.Context["aws:username"] = []string{"bob"}
+	if evaluation, _ := doc.Evaluate(request); evaluation.Decision != ImplicitDeny {
+		t.Errorf("expected '%s', but got '%s'", ImplicitDeny, evaluation.Decision)
+	}
+}
@@ -0,0 +1,109 @@
+package policy
+
+import (
+	"regexp"
+	"strings"
+)
+
+var accountIDPattern = regexp.MustCompile(`^\d{12}$`)
+
+// matchWildcard reports whether value matches an IAM pattern, where '*'
+// matches any run of characters and '?' matches any single character
+func matchWildcard(pattern, value string, ignoreCase bool) bool {
+	if ignoreCase {
+		pattern = strings.ToLower(pattern)
+		value = strings.ToLower(value)
+	}
+	// iterative glob matching with backtracking on the most recent '*'
+	p, v := 0, 0
+	starP, starV := -1, 0
+	for v < len(value) {
+		switch {
+		case p < len(pattern) && (pattern[p] == '?' || pattern[p] == value[v]):
+			p++
+			v++
+		case p < len(pattern) && pattern[p] == '*':
+			starP, starV = p, v
+			p++
+		case starP >= 0:
+			p = starP + 1
+			starV++
+			v = starV
+		default:
+			return false
+		}
+	}
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+	return p == len(pattern)
+}
+
+// MatchWildcard reports whether value matches an IAM-style pattern, where
+// '*' matches any run of characters and '?' matches any single character
+func MatchWildcard(pattern, value string) bool {
+	return matchWildcard(pattern, value, false)
+}
+
+// matchAny reports whether value matches any of the provided patterns
+func matchAny(patterns []string, value string, ignoreCase bool) bool {
+	for _, pattern := range patterns {
+		if matchWildcard(pattern, value, ignoreCase) {
+			return true
+		}
+	}
+	return false
+}
+
+// ARN is the parsed form of an Amazon Resource Name
+type ARN struct {
+	Partition string
+	Service   string
+	Region    string
+	Account   string
+	Resource  string
+}
+
+// ParseARN splits an ARN into its components, returning nil when the
+// value is not an ARN
+func ParseARN(arn string) *ARN {
+	parts := strings.SplitN(arn, ":", 6)
+	if len(parts) != 6 || parts[0] != "arn" {
+		return nil
+	}
+	return &ARN{
+		Partition: parts[1],
+		Service:   parts[2],
+		Region:    parts[3],
+		Account:   parts[4],
+		Resource:  parts[5],
+	}
+}
+
+// AccountOf returns the account ID referenced by an ARN, an account root
+// ARN or a bare account ID; it returns "" when no account can be determined
+func AccountOf(value string) string {
+	if accountIDPattern.MatchString(value) {
+		return value
+	}
+	if arn := ParseARN(value); arn != nil {
+		return arn.Account
+	}
+	return ""
+}
+
+// matchARN compares two ARNs component-wise, as the ArnLike/ArnEquals
+// condition operators do; wildcards are permitted within each component
+func matchARN(pattern, value string) bool {
+	patternParts := strings.SplitN(pattern, ":", 6)
+	valueParts := strings.SplitN(value, ":", 6)
+	if len(patternParts) != 6 || len(valueParts) != 6 {
+		return false
+	}
+	for i := range patternParts {
+		if !matchWildcard(patternParts[i], valueParts[i], false) {
+			return false
+		}
+	}
+	return true
+}
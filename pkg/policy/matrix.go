@@ -0,0 +1,123 @@
+package policy
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/matt-deboer/assert-aws-iam-permissions/pkg/types"
+)
+
+// ExpandMatrix replaces each assertion having a matrix with one concrete
+// assertion per combination of its action, resource and context variant;
+// assertions without a matrix are returned unchanged
+func ExpandMatrix(assertions []*types.Assertion) ([]*types.Assertion, error) {
+	expanded := make([]*types.Assertion, 0, len(assertions))
+	for _, assertion := range assertions {
+		if assertion.Matrix == nil {
+			expanded = append(expanded, assertion)
+			continue
+		}
+		cells, err := expandAssertion(assertion)
+		if err != nil {
+			return nil, err
+		}
+		expanded = append(expanded, cells...)
+	}
+	return expanded, nil
+}
+
+func expandAssertion(assertion *types.Assertion) ([]*types.Assertion, error) {
+	matrix := assertion.Matrix
+	actions := matrix.ActionNames
+	if len(actions) == 0 {
+		actions = assertion.ActionNames
+	}
+	if len(actions) == 0 {
+		return nil, fmt.Errorf("The matrix of '%s' has no action_names", assertion.Comment)
+	}
+	// a missing dimension is expanded as a single cell with an empty coordinate
+	resources := matrix.ResourceArns
+	if len(resources) == 0 {
+		resources = assertion.ResourceArns
+	}
+	if len(resources) == 0 {
+		resources = []string{""}
+	}
+	variants := make([]string, 0, len(matrix.Contexts))
+	for name := range matrix.Contexts {
+		variants = append(variants, name)
+	}
+	sort.Strings(variants)
+	if len(variants) == 0 {
+		variants = []string{""}
+	}
+
+	cells := []*types.Assertion{}
+	for _, action := range actions {
+		for _, resource := range resources {
+			for _, variant := range variants {
+				coordinates := []string{"action=" + action}
+				if len(resource) > 0 {
+					coordinates = append(coordinates, "resource="+resource)
+				}
+				if len(variant) > 0 {
+					coordinates = append(coordinates, "context="+variant)
+				}
+
+				cell := *assertion
+				cell.Matrix = nil
+				cell.MatrixCell = fmt.Sprintf("matrix[%s]", strings.Join(coordinates, ", "))
+				cell.ActionNames = []string{action}
+				cell.ResourceArns = nil
+				if len(resource) > 0 {
+					cell.ResourceArns = []string{resource}
+				}
+				cell.ContextEntries = mergeContext(assertion.ContextEntries, matrix.Contexts[variant])
+				if rule := matchingRule(matrix.Rules, action, resource, variant); rule != nil {
+					cell.ExpectedResult = rule.ExpectedResult
+				}
+				if len(cell.ExpectedResult) == 0 {
+					return nil, fmt.Errorf("No rule of the matrix of '%s' matches %s, and it has no expected_result",
+						assertion.Comment, cell.MatrixCell)
+				}
+				cells = append(cells, &cell)
+			}
+		}
+	}
+	return cells, nil
+}
+
+// mergeContext overlays the entries of a context variant on the entries
+// common to every cell
+func mergeContext(common, variant map[string]*types.ContextEntryValue) map[string]*types.ContextEntryValue {
+	if len(variant) == 0 {
+		return common
+	}
+	merged := make(map[string]*types.ContextEntryValue, len(common)+len(variant))
+	for key, entry := range common {
+		merged[key] = entry
+	}
+	for key, entry := range variant {
+		merged[key] = entry
+	}
+	return merged
+}
+
+// matchingRule returns the first rule matching the cell; rule actions and
+// resources may contain wildcards
+func matchingRule(rules []*types.MatrixRule, action, resource, variant string) *types.MatrixRule {
+	for _, rule := range rules {
+		if len(rule.ActionNames) > 0 && !matchAny(rule.ActionNames, action, true) {
+			continue
+		}
+		if len(rule.ResourceArns) > 0 && !matchAny(rule.ResourceArns, resource, false) {
+			continue
+		}
+		if len(rule.Contexts) > 0 && !matchAny(rule.Contexts, variant, false) {
+			continue
+		}
+		return rule
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package policy
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/matt-deboer/assert-aws-iam-permissions/pkg/types"
+)
+
+const testVPCPolicy = `
+{
+	"Version": "2012-10-17",
+	"Statement": [
+		{
+			"Sid": "ReadFromVPC",
+			"Effect": "Allow",
+			"Action": ["s3:GetObject", "s3:ListBucket"],
+			"Resource": ["arn:aws:s3:::my-bucket", "arn:aws:s3:::my-bucket/*"],
+			"Condition": {"StringEquals": {"aws:SourceVpce": "vpce-1234"}}
+		}
+	]
+}
+`
+
+func TestExpandMatrix(t *testing.T) {
+	assertions := []*types.Assertion{
+		&types.Assertion{
+			Comment: "reads are only allowed from the VPC endpoint",
+			ContextEntries: map[string]*types.ContextEntryValue{
+				"aws:SecureTransport": &types.ContextEntryValue{Type: "boolean", Values: []string{"true"}},
+			},
+			ExpectedResult: "denied",
+			Matrix: &types.Matrix{
+				ActionNames:  []string{"s3:GetObject", "s3:PutObject"},
+				ResourceArns: []string{"arn:aws:s3:::my-bucket/key"},
+				Contexts: map[string]map[string]*types.ContextEntryValue{
+					"vpce":     {"aws:SourceVpce": &types.ContextEntryValue{Values: []string{"vpce-1234"}}},
+					"internet": {"aws:SourceIp": &types.ContextEntryValue{Type: "ip", Values: []string{"203.0.113.1"}}},
+				},
+				Rules: []*types.MatrixRule{
+					&types.MatrixRule{ActionNames: []string{"s3:Get*"}, Contexts: []string{"vpce"}, ExpectedResult: "allowed"},
+				},
+			},
+		},
+	}
+
+	expanded, err := ExpandMatrix(assertions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"matrix[action=s3:GetObject, resource=arn:aws:s3:::my-bucket/key, context=internet]: denied",
+		"matrix[action=s3:GetObject, resource=arn:aws:s3:::my-bucket/key, context=vpce]: allowed",
+		"matrix[action=s3:PutObject, resource=arn:aws:s3:::my-bucket/key, context=internet]: denied",
+		"matrix[action=s3:PutObject, resource=arn:aws:s3:::my-bucket/key, context=vpce]: denied",
+	}
+	cells := []string{}
+	for _, cell := range expanded {
+		cells = append(cells, cell.MatrixCell+": "+cell.ExpectedResult)
+		if len(cell.ContextEntries) != 2 {
+			t.Errorf("%s: expected the common and variant context entries, but got %v", cell.MatrixCell, cell.ContextEntries)
+		}
+	}
+	if strings.Join(cells, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("expected cells:\n%s\nbut got:\n%s", strings.Join(expected, "\n"), strings.Join(cells, "\n"))
+	}
+
+	results, err := EvaluatePolicies(nil, assertions, []string{testVPCPolicy})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := failures(results, nil); err != nil {
+		t.Error(err)
+	}
+
+	// the failing cell is identified by its coordinates
+	assertions[0].Matrix.Rules[0].ExpectedResult = "denied"
+	err = failures(EvaluatePolicies(nil, assertions, []string{testVPCPolicy}))
+	message := "[POLICY ASSERTION FAILED] reads are only allowed from the VPC endpoint " +
+		"matrix[action=s3:GetObject, resource=arn:aws:s3:::my-bucket/key, context=vpce] " +
+		"( for s3:GetObject [ arn:aws:s3:::my-bucket/key ]: expected 'denied', but got 'allowed'; " +
+		"identity policy: allowed; granted by the identity policy )"
+	if err == nil || err.Error() != message {
+		t.Errorf("expected error:\n%s\nbut got:\n%v", message, err)
+	}
+}
+
+func TestExpandMatrix_MissingExpectedResult(t *testing.T) {
+	_, err := ExpandMatrix([]*types.Assertion{
+		&types.Assertion{
+			Comment: "writes",
+			Matrix: &types.Matrix{
+				ActionNames: []string{"s3:PutObject", "s3:DeleteObject"},
+				Rules:       []*types.MatrixRule{&types.MatrixRule{ActionNames: []string{"s3:Put*"}, ExpectedResult: "allowed"}},
+			},
+		},
+	})
+	if err == nil || !strings.Contains(err.Error(), "matrix[action=s3:DeleteObject]") {
+		t.Errorf("expected an error naming the unmatched cell, but got %v", err)
+	}
+}
@@ -0,0 +1,163 @@
+package policy
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Principal types, as used for keys of a policy's Principal element
+const (
+	PrincipalAWS           = "AWS"
+	PrincipalService       = "Service"
+	PrincipalFederated     = "Federated"
+	PrincipalCanonicalUser = "CanonicalUser"
+)
+
+var (
+	canonicalUserPattern = regexp.MustCompile(`^[0-9a-f]{64}$`)
+	webIdentityProviders = map[string]bool{
+		"cognito-identity.amazonaws.com": true,
+		"accounts.google.com":            true,
+		"graph.facebook.com":             true,
+		"www.amazon.com":                 true,
+	}
+)
+
+// identity describes the principal making a request for local evaluation
+type identity struct {
+	Type    string
+	ID      string
+	Account string
+	// RoleName is set when the identity is a role or one of its sessions
+	RoleName string
+	// Root is set when the identity is the account itself
+	Root bool
+}
+
+// newIdentity builds the identity for the given principal; when
+// principalType is empty it is inferred from the form of the principal
+func newIdentity(principalType, principal string) *identity {
+	if len(principalType) == 0 {
+		principalType = inferPrincipalType(principal)
+	}
+	id := &identity{Type: principalType, ID: principal}
+	if principalType != PrincipalAWS {
+		return id
+	}
+	if accountIDPattern.MatchString(principal) {
+		id.Account = principal
+		id.Root = true
+		return id
+	}
+	if arn := ParseARN(principal); arn != nil {
+		id.Account = arn.Account
+		switch {
+		case arn.Resource == "root":
+			id.Root = true
+		case strings.HasPrefix(arn.Resource, "role/"):
+			id.RoleName = lastPathSegment(arn.Resource)
+		case strings.HasPrefix(arn.Resource, "assumed-role/"):
+			// assumed-role/<role-name>/<session-name>
+			if parts := strings.Split(arn.Resource, "/"); len(parts) >= 2 {
+				id.RoleName = parts[1]
+			}
+		}
+	}
+	return id
+}
+
+func inferPrincipalType(principal string) string {
+	switch {
+	case webIdentityProviders[principal]:
+		return PrincipalFederated
+	case strings.Contains(principal, ":saml-provider/") || strings.Contains(principal, ":oidc-provider/"):
+		return PrincipalFederated
+	case strings.HasSuffix(principal, ".amazonaws.com") || strings.HasSuffix(principal, ".amazonaws.com.cn"):
+		return PrincipalService
+	case canonicalUserPattern.MatchString(principal):
+		return PrincipalCanonicalUser
+	}
+	return PrincipalAWS
+}
+
+func lastPathSegment(resource string) string {
+	return resource[strings.LastIndex(resource, "/")+1:]
+}
+
+// accountPrincipal returns the account ID when value names an entire
+// account (either a bare account ID or an account root ARN)
+func accountPrincipal(value string) string {
+	if accountIDPattern.MatchString(value) {
+		return value
+	}
+	if arn := ParseARN(value); arn != nil && arn.Service == "iam" && arn.Resource == "root" {
+		return arn.Account
+	}
+	return ""
+}
+
+// matchesValue reports whether a single principal value from a policy
+// names this identity
+func (id *identity) matchesValue(value string) bool {
+	if value == "*" {
+		return true
+	}
+	if id.Type != PrincipalAWS {
+		return value == id.ID
+	}
+	// an account principal covers every principal within that account
+	if account := accountPrincipal(value); len(account) > 0 {
+		return account == id.Account
+	}
+	// a role principal covers the role and all of its sessions; role
+	// paths don't appear in session ARNs, so roles are matched by name
+	if arn := ParseARN(value); arn != nil && strings.HasPrefix(arn.Resource, "role/") && len(id.RoleName) > 0 {
+		return arn.Account == id.Account && lastPathSegment(arn.Resource) == id.RoleName
+	}
+	return value == id.ID
+}
+
+// matches reports whether the Principal element applies to the identity
+func (p Principal) matches(id *identity) bool {
+	if _, ok := p["*"]; ok {
+		return true
+	}
+	for _, value := range p[id.Type] {
+		if id.matchesValue(value) {
+			return true
+		}
+	}
+	return false
+}
+
+// excludes reports whether a NotPrincipal element exempts the identity.
+// As with AWS, exempting a principal within an account requires that the
+// account itself also be listed; naming only a role or user is not enough.
+func (p Principal) excludes(id *identity) bool {
+	if _, ok := p["*"]; ok {
+		return true
+	}
+	values := p[id.Type]
+	if id.Type != PrincipalAWS {
+		for _, value := range values {
+			if value == id.ID {
+				return true
+			}
+		}
+		return false
+	}
+	accountListed, principalListed := false, false
+	for _, value := range values {
+		if account := accountPrincipal(value); len(account) > 0 {
+			if account == id.Account {
+				accountListed = true
+			}
+		} else if id.matchesValue(value) {
+			principalListed = true
+		}
+	}
+	if id.Root {
+		return accountListed
+	}
+	return accountListed && principalListed
+}
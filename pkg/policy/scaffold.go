@@ -0,0 +1,337 @@
+package policy
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/matt-deboer/assert-aws-iam-permissions/pkg/types"
+)
+
+// sample values used to instantiate wildcards in scaffolded assertions
+const (
+	sampleAccount = "123456789012"
+	sampleRegion  = "us-east-1"
+	sampleSegment = "sample"
+	outsideSuffix = "-outside"
+)
+
+// sampleActions are well-known actions, used to instantiate wildcard
+// actions and to find near-miss actions in the same service
+var sampleActions = []string{
+	"s3:GetObject", "s3:PutObject", "s3:DeleteObject", "s3:ListBucket", "s3:DeleteBucket", "s3:PutBucketPolicy",
+	"ec2:DescribeInstances", "ec2:RunInstances", "ec2:TerminateInstances", "ec2:CreateTags", "ec2:DeleteVolume",
+	"iam:GetRole", "iam:ListRoles", "iam:PassRole", "iam:CreateUser", "iam:AttachRolePolicy", "iam:DeleteRole",
+	"sts:AssumeRole", "sts:GetCallerIdentity",
+	"dynamodb:GetItem", "dynamodb:PutItem", "dynamodb:Query", "dynamodb:DeleteTable",
+	"sqs:SendMessage", "sqs:ReceiveMessage", "sqs:DeleteQueue",
+	"sns:Publish", "sns:Subscribe", "sns:DeleteTopic",
+	"kms:Decrypt", "kms:Encrypt", "kms:GenerateDataKey", "kms:ScheduleKeyDeletion",
+	"lambda:InvokeFunction", "lambda:GetFunction", "lambda:DeleteFunction",
+	"logs:CreateLogStream", "logs:PutLogEvents", "logs:DeleteLogGroup",
+	"route53:GetHostedZone", "route53:ListHostedZones", "route53:ChangeResourceRecordSets", "route53:DeleteHostedZone",
+	"cloudwatch:PutMetricData", "cloudwatch:GetMetricData", "cloudwatch:DeleteAlarms",
+}
+
+// Scaffold generates a starter assertion suite for an identity policy: an
+// 'allowed' assertion per Allow statement, using a representative action
+// and a sample ARN matching each Resource pattern, and 'denied' assertions
+// for near-miss actions and resources just outside those patterns. Context
+// entries are filled in to satisfy each statement's conditions, and every
+// assertion is checked against the local engine before it is emitted: near
+// misses another statement grants are dropped, while an 'allowed' assertion
+// the policy doesn't allow (because of a Deny, say) is kept, noting the
+// policy's decision, so the suite fails until it's looked into.
+// Statements with NotAction, NotResource or a Principal are skipped.
+func Scaffold(policyJSON string) ([]*types.Assertion, error) {
+	doc, err := ParseDocument(policyJSON)
+	if err != nil {
+		return nil, err
+	}
+	assertions := []*types.Assertion{}
+	for i, statement := range doc.Statement {
+		if statement.Effect != "Allow" || len(statement.Action) == 0 || len(statement.NotResource) > 0 ||
+			statement.Principal != nil || statement.NotPrincipal != nil {
+			continue
+		}
+		label := statement.Label(i)
+		entries, err := satisfyConditions(statement.Condition)
+		if err != nil {
+			return nil, fmt.Errorf("Statement %s: %v", label, err)
+		}
+		for _, variable := range appendVariables([]string{}, statement.Resource) {
+			if _, ok := NewContext(entries)[strings.ToLower(variable)]; !ok {
+				entries[variable] = &types.ContextEntryValue{Values: []string{sampleSegment}}
+			}
+		}
+		action := sampleAction(statement.Action[0])
+		var resources []string
+		for _, pattern := range statement.Resource {
+			if pattern != "*" {
+				resources = append(resources, sampleResource(pattern, entries))
+			}
+		}
+
+		allowed := &types.Assertion{
+			Comment:        fmt.Sprintf("%s allows %s", label, action),
+			ExpectedResult: Allowed,
+			ActionNames:    []string{action},
+			ResourceArns:   resources,
+			ContextEntries: entries,
+		}
+		decision, err := doc.scaffoldDecision(allowed)
+		if err != nil {
+			return nil, err
+		}
+		if decision != Allowed {
+			allowed.Comment += fmt.Sprintf(" (but the policy decides '%s')", decision)
+		}
+		assertions = append(assertions, allowed)
+
+		nearMisses := []*types.Assertion{}
+		if nearMiss := nearMissAction(statement); len(nearMiss) > 0 {
+			nearMisses = append(nearMisses, &types.Assertion{
+				Comment:      fmt.Sprintf("near miss: %s is not granted by %s", nearMiss, label),
+				ActionNames:  []string{nearMiss},
+				ResourceArns: resources,
+			})
+		}
+		for _, pattern := range statement.Resource {
+			if outside := nearMissResource(pattern, entries); len(outside) > 0 {
+				nearMisses = append(nearMisses, &types.Assertion{
+					Comment:      fmt.Sprintf("near miss: %s is outside %s", outside, pattern),
+					ActionNames:  []string{action},
+					ResourceArns: []string{outside},
+				})
+			}
+		}
+		for _, nearMiss := range nearMisses {
+			nearMiss.ExpectedResult = "denied"
+			nearMiss.ContextEntries = entries
+			decision, err := doc.scaffoldDecision(nearMiss)
+			if err != nil {
+				return nil, err
+			}
+			// another statement may grant the near miss, in which case it
+			// is no assertion worth making
+			if decision != Allowed {
+				assertions = append(assertions, nearMiss)
+			}
+		}
+	}
+	return assertions, nil
+}
+
+// scaffoldDecision evaluates an assertion against the document, returning
+// the decision for its first resource
+func (d *Document) scaffoldDecision(assertion *types.Assertion) (string, error) {
+	resource := "*"
+	if len(assertion.ResourceArns) > 0 {
+		resource = assertion.ResourceArns[0]
+	}
+	evaluation, err := d.Evaluate(&Request{
+		Action:   assertion.ActionNames[0],
+		Resource: resource,
+		Context:  NewContext(assertion.ContextEntries),
+	})
+	if err != nil {
+		return "", err
+	}
+	return evaluation.Decision, nil
+}
+
+// sampleAction returns a concrete action matching the pattern, preferring
+// a well-known action
+func sampleAction(pattern string) string {
+	if !strings.ContainsAny(pattern, "*?") {
+		return pattern
+	}
+	for _, action := range sampleActions {
+		if matchWildcard(pattern, action, true) {
+			return action
+		}
+	}
+	return instantiate(pattern, "Sample")
+}
+
+// nearMissAction returns a well-known action in the same service as the
+// statement's actions which the statement doesn't grant
+func nearMissAction(statement *Statement) string {
+	services := map[string]bool{}
+	for _, action := range statement.Action {
+		services[strings.ToLower(strings.SplitN(action, ":", 2)[0])] = true
+	}
+	for _, action := range sampleActions {
+		service := strings.ToLower(strings.SplitN(action, ":", 2)[0])
+		if services[service] && !matchAny(statement.Action, action, true) {
+			return action
+		}
+	}
+	return ""
+}
+
+// sampleResource returns a concrete ARN matching the pattern, substituting
+// policy variables with the values of the context entries
+func sampleResource(pattern string, entries map[string]*types.ContextEntryValue) string {
+	pattern = substituteSample(pattern, entries)
+	arn := ParseARN(pattern)
+	if arn == nil {
+		return instantiate(pattern, sampleSegment)
+	}
+	return sampleARN(arn, instantiate(arn.Resource, sampleSegment))
+}
+
+// nearMissResource returns an ARN just outside the pattern, by altering the
+// last literal segment of its resource component; it returns "" when the
+// resource component is entirely a wildcard
+func nearMissResource(pattern string, entries map[string]*types.ContextEntryValue) string {
+	arn := ParseARN(substituteSample(pattern, entries))
+	if arn == nil {
+		return ""
+	}
+	literal := arn.Resource
+	if i := strings.IndexAny(literal, "*?"); i >= 0 {
+		literal = literal[:i]
+	}
+	trimmed := strings.TrimRight(literal, "/:")
+	if len(trimmed) == 0 {
+		return ""
+	}
+	rest := instantiate(arn.Resource, sampleSegment)[len(trimmed):]
+	return sampleARN(arn, trimmed+outsideSuffix+rest)
+}
+
+func sampleARN(arn *ARN, resource string) string {
+	return fmt.Sprintf("arn:%s:%s:%s:%s:%s", instantiate(arn.Partition, "aws"), instantiate(arn.Service, sampleSegment),
+		instantiate(arn.Region, sampleRegion), instantiate(arn.Account, sampleAccount), resource)
+}
+
+// instantiate replaces the wildcards in a pattern with a sample value
+func instantiate(pattern, sample string) string {
+	if pattern == "*" {
+		return sample
+	}
+	return strings.Replace(strings.Replace(pattern, "*", sample, -1), "?", "x", -1)
+}
+
+// substituteSample replaces policy variables with the values of the context
+// entries, or with a sample value when there is no entry for the variable
+func substituteSample(value string, entries map[string]*types.ContextEntryValue) string {
+	context := NewContext(entries)
+	return policyVariablePattern.ReplaceAllStringFunc(value, func(variable string) string {
+		name := variable[2 : len(variable)-1]
+		switch name {
+		case "*", "?", "$":
+			return name
+		}
+		if values := context[strings.ToLower(name)]; len(values) > 0 {
+			return values[0]
+		}
+		return sampleSegment
+	})
+}
+
+// satisfyConditions generates context entries which satisfy a condition block
+func satisfyConditions(conditions map[string]map[string]Value) (map[string]*types.ContextEntryValue, error) {
+	entries := map[string]*types.ContextEntryValue{}
+	// Null conditions are resolved last, as they may require the presence
+	// of a key which another condition gives a value
+	nullConditions := map[string]string{}
+	for operatorName, keys := range conditions {
+		baseName := strings.TrimPrefix(strings.TrimPrefix(operatorName, "ForAllValues:"), "ForAnyValue:")
+		multiValued := baseName != operatorName
+		baseName = strings.TrimSuffix(baseName, "IfExists")
+		for key, policyValues := range keys {
+			if baseName == "Null" {
+				if len(policyValues) != 1 {
+					return nil, fmt.Errorf("Null condition on '%s' must have a single value", key)
+				}
+				nullConditions[key] = policyValues[0]
+				continue
+			}
+			value, keyType, err := satisfyingValue(baseName, policyValues)
+			if err != nil {
+				return nil, fmt.Errorf("Condition %s on '%s': %v", operatorName, key, err)
+			}
+			if len(value) == 0 {
+				continue
+			}
+			if multiValued {
+				keyType += "List"
+			} else if keyType == "string" {
+				keyType = ""
+			}
+			entries[key] = &types.ContextEntryValue{Type: keyType, Values: []string{value}}
+		}
+	}
+	for key, expectAbsent := range nullConditions {
+		if absent, _ := strconv.ParseBool(expectAbsent); absent {
+			delete(entries, key)
+		} else if _, ok := entries[key]; !ok {
+			entries[key] = &types.ContextEntryValue{Values: []string{sampleSegment}}
+		}
+	}
+	return entries, nil
+}
+
+// satisfyingValue returns a request value, along with its context key type,
+// which satisfies the operator for the policy values; it returns "" when the
+// operator is best satisfied by leaving the key out
+func satisfyingValue(operatorName string, policyValues []string) (string, string, error) {
+	if len(policyValues) == 0 {
+		return "", "", nil
+	}
+	policyValue := substituteSample(policyValues[0], nil)
+	switch operatorName {
+	case "StringEquals", "StringEqualsIgnoreCase", "BinaryEquals":
+		if operatorName == "BinaryEquals" {
+			return policyValue, "binary", nil
+		}
+		return policyValue, "string", nil
+	case "StringLike", "ArnEquals", "ArnLike":
+		return instantiate(policyValue, sampleSegment), "string", nil
+	case "StringNotEquals", "StringNotEqualsIgnoreCase", "StringNotLike", "ArnNotEquals", "ArnNotLike":
+		return policyValue + outsideSuffix, "string", nil
+	case "Bool":
+		return policyValue, "boolean", nil
+	case "IpAddress":
+		ip, _, err := net.ParseCIDR(policyValue)
+		if err != nil {
+			if ip = net.ParseIP(policyValue); ip == nil {
+				return "", "", err
+			}
+		}
+		return ip.String(), "ip", nil
+	case "NotIpAddress":
+		return "", "", nil
+	}
+	if strings.HasPrefix(operatorName, "Numeric") {
+		number, err := strconv.ParseFloat(policyValue, 64)
+		if err != nil {
+			return "", "", err
+		}
+		switch operatorName {
+		case "NumericLessThan":
+			number--
+		case "NumericGreaterThan", "NumericNotEquals":
+			number++
+		}
+		return strconv.FormatFloat(number, 'f', -1, 64), "numeric", nil
+	}
+	if strings.HasPrefix(operatorName, "Date") {
+		date, err := parseDate(policyValue)
+		if err != nil {
+			return "", "", err
+		}
+		switch operatorName {
+		case "DateLessThan":
+			date = date.Add(-24 * time.Hour)
+		case "DateGreaterThan", "DateNotEquals":
+			date = date.Add(24 * time.Hour)
+		}
+		return date.UTC().Format(time.RFC3339), "date", nil
+	}
+	return "", "", fmt.Errorf("Unsupported condition operator '%s'", operatorName)
+}
@@ -0,0 +1,130 @@
+package policy
+
+import (
+	"testing"
+)
+
+const testLegacyPolicy = `
+{
+	"Version": "2012-10-17",
+	"Statement": [
+		{
+			"Sid": "Uploads",
+			"Effect": "Allow",
+			"Action": ["s3:PutObject", "s3:Get*"],
+			"Resource": "arn:aws:s3:::my-bucket/uploads/*",
+			"Condition": {
+				"StringEquals": {"s3:x-amz-acl": "bucket-owner-full-control"},
+				"IpAddress": {"aws:SourceIp": "10.0.0.0/8"},
+				"NumericLessThan": {"s3:max-keys": "10"}
+			}
+		},
+		{
+			"Sid": "HomeDirectory",
+			"Effect": "Allow",
+			"Action": "s3:*",
+			"Resource": "arn:aws:s3:::home/${aws:username}/*"
+		},
+		{
+			"Effect": "Allow",
+			"Action": "iam:PassRole",
+			"Resource": "arn:aws:iam::*:role/deployer"
+		},
+		{
+			"Effect": "Deny",
+			"Action": "s3:DeleteObject",
+			"Resource": "*"
+		}
+	]
+}
+`
+
+func TestScaffold(t *testing.T) {
+	assertions, err := Scaffold(testLegacyPolicy)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []struct {
+		comment  string
+		action   string
+		resource string
+		result   string
+	}{
+		{"Uploads allows s3:PutObject", "s3:PutObject", "arn:aws:s3:::my-bucket/uploads/sample", Allowed},
+		{"near miss: s3:DeleteObject is not granted by Uploads", "s3:DeleteObject", "arn:aws:s3:::my-bucket/uploads/sample", "denied"},
+		{"near miss: arn:aws:s3:::my-bucket/uploads-outside/sample is outside arn:aws:s3:::my-bucket/uploads/*",
+			"s3:PutObject", "arn:aws:s3:::my-bucket/uploads-outside/sample", "denied"},
+		{"HomeDirectory allows s3:GetObject", "s3:GetObject", "arn:aws:s3:::home/sample/sample", Allowed},
+		{"near miss: arn:aws:s3:::home/sample-outside/sample is outside arn:aws:s3:::home/${aws:username}/*",
+			"s3:GetObject", "arn:aws:s3:::home/sample-outside/sample", "denied"},
+		{"Statement[2] allows iam:PassRole", "iam:PassRole", "arn:aws:iam::123456789012:role/deployer", Allowed},
+		{"near miss: iam:GetRole is not granted by Statement[2]", "iam:GetRole", "arn:aws:iam::123456789012:role/deployer", "denied"},
+		{"near miss: arn:aws:iam::123456789012:role/deployer-outside is outside arn:aws:iam::*:role/deployer",
+			"iam:PassRole", "arn:aws:iam::123456789012:role/deployer-outside", "denied"},
+	}
+	if len(assertions) != len(expected) {
+		for _, assertion := range assertions {
+			t.Log(assertion.Comment)
+		}
+		t.Fatalf("expected %d assertions, but got %d", len(expected), len(assertions))
+	}
+	for i, e := range expected {
+		a := assertions[i]
+		if a.Comment != e.comment || a.ActionNames[0] != e.action || a.ResourceArns[0] != e.resource || a.ExpectedResult != e.result {
+			t.Errorf("assertion %d: expected %v, but got %s %s %v %s", i, e, a.Comment, a.ActionNames, a.ResourceArns, a.ExpectedResult)
+		}
+	}
+
+	uploads := assertions[0].ContextEntries
+	if uploads["s3:x-amz-acl"].Values[0] != "bucket-owner-full-control" || uploads["aws:SourceIp"].Values[0] != "10.0.0.0" ||
+		uploads["aws:SourceIp"].Type != "ip" || uploads["s3:max-keys"].Values[0] != "9" {
+		t.Errorf("unexpected context entries for Uploads: %v %v %v", uploads["s3:x-amz-acl"], uploads["aws:SourceIp"], uploads["s3:max-keys"])
+	}
+	if assertions[3].ContextEntries["aws:username"].Values[0] != "sample" {
+		t.Errorf("expected the aws:username policy variable to be supplied, but got %v", assertions[3].ContextEntries)
+	}
+
+	// the scaffolded suite passes against the policy it was generated from
+	if err := failures(EvaluatePolicies(nil, assertions, []string{testLegacyPolicy})); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestScaffold_Overridden(t *testing.T) {
+	overridden := `{
+		"Version": "2012-10-17",
+		"Statement": [
+			{"Sid": "Reads", "Effect": "Allow", "Action": "s3:GetObject", "Resource": "arn:aws:s3:::my-bucket/*"},
+			{"Effect": "Deny", "Action": "s3:GetObject", "Resource": "*"}
+		]
+	}`
+	assertions, err := Scaffold(overridden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(assertions) == 0 {
+		t.Fatal("expected an assertion for Reads")
+	}
+	if a := assertions[0]; a.Comment != "Reads allows s3:GetObject (but the policy decides 'explicitDeny')" || a.ExpectedResult != Allowed {
+		t.Errorf("expected the assertion to still expect '%s', but got '%s': %s", Allowed, a.ExpectedResult, a.Comment)
+	}
+
+	// the scaffolded suite fails until the Deny is looked into
+	if err := failures(EvaluatePolicies(nil, assertions, []string{overridden})); err == nil {
+		t.Error("expected the scaffolded suite to fail")
+	}
+}
+
+func TestScaffold_InvalidNullCondition(t *testing.T) {
+	_, err := Scaffold(`{
+		"Version": "2012-10-17",
+		"Statement": [
+			{"Sid": "Reads", "Effect": "Allow", "Action": "s3:GetObject", "Resource": "*",
+				"Condition": {"Null": {"aws:TokenIssueTime": []}}}
+		]
+	}`)
+	if err == nil || err.Error() != "Statement Reads: Null condition on 'aws:TokenIssueTime' must have a single value" {
+		t.Errorf("expected an invalid Null condition, but got %v", err)
+	}
+}
@@ -0,0 +1,35 @@
+package policy
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sort"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/iam"
+)
+
+// NormalizeSimulation returns a copy of the input of a simulation with its
+// context entries sorted by key, so that equal simulations have equal inputs
+func NormalizeSimulation(input *iam.SimulateCustomPolicyInput) *iam.SimulateCustomPolicyInput {
+	normalized := *input
+	normalized.ContextEntries = append([]*iam.ContextEntry{}, input.ContextEntries...)
+	sort.Slice(normalized.ContextEntries, func(i, j int) bool {
+		return aws.StringValue(normalized.ContextEntries[i].ContextKeyName) <
+			aws.StringValue(normalized.ContextEntries[j].ContextKeyName)
+	})
+	return &normalized
+}
+
+// SimulationKey returns the SHA-256 hash (in hex) of the normalized input of a
+// simulation, identifying the simulations whose responses are the same
+func SimulationKey(input *iam.SimulateCustomPolicyInput) string {
+	data, err := json.Marshal(NormalizeSimulation(input))
+	if err != nil {
+		// the input holds only strings, and always marshals
+		panic(err)
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
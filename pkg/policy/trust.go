@@ -0,0 +1,151 @@
+package policy
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/matt-deboer/assert-aws-iam-permissions/pkg/types"
+)
+
+var principalTypes = map[string]bool{
+	PrincipalAWS:           true,
+	PrincipalService:       true,
+	PrincipalFederated:     true,
+	PrincipalCanonicalUser: true,
+}
+
+// AssertTrustPolicy evaluates the provided set of assertions against a role
+// trust policy (AssumeRolePolicyDocument). Each assertion names the principals
+// attempting to assume the role along with the sts:AssumeRole* actions they
+// call; since the policy simulator does not support trust policies, they
+// are evaluated locally.
+func AssertTrustPolicy(assertions []*types.Assertion, trustPolicyJSON string) error {
+	return failures(EvaluateTrustPolicy(assertions, trustPolicyJSON))
+}
+
+// EvaluateTrustPolicy evaluates the provided set of assertions against a role
+// trust policy, returning a result for each principal, action and resource
+func EvaluateTrustPolicy(assertions []*types.Assertion, trustPolicyJSON string) ([]*Result, error) {
+
+	doc, err := ParseDocument(trustPolicyJSON)
+	if err != nil {
+		return nil, err
+	}
+	if assertions, err = ExpandMatrix(assertions); err != nil {
+		return nil, err
+	}
+
+	results := []*Result{}
+
+	for _, assertion := range assertions {
+		if err := ValidateTrustAssertion(assertion); err != nil {
+			return nil, err
+		}
+		resources := assertion.ResourceArns
+		if len(resources) == 0 {
+			resources = []string{"*"}
+		}
+
+		for _, principalType := range sortedKeys(assertion.Principals) {
+			for _, principal := range assertion.Principals[principalType] {
+				for _, action := range assertion.ActionNames {
+					for _, resource := range resources {
+						evaluation, err := doc.Evaluate(&Request{
+							Action:        action,
+							Resource:      resource,
+							Principal:     principal,
+							PrincipalType: principalType,
+							Context:       trustContext(assertion, principalType, principal),
+						})
+						if err != nil {
+							return nil, err
+						}
+
+						result := &Result{
+							Assertion:            assertion,
+							Action:               action,
+							Resource:             principalType + " " + principal,
+							Decision:             evaluation.Decision,
+							MatchedStatements:    evaluation.MatchedStatements,
+							MissingContextValues: evaluation.MissingContextValues,
+						}
+						if len(evaluation.MatchedStatements) > 0 {
+							result.Details = "matched " + strings.Join(evaluation.MatchedStatements, ", ")
+						}
+						result.Passed = !isUnexpectedResult(assertion.ExpectedResult, result.Decision)
+						logResult(result)
+						results = append(results, result)
+					}
+				}
+			}
+		}
+	}
+
+	return results, nil
+}
+
+// ValidateTrustAssertion checks that a trust policy assertion names its
+// principals, by known principal types, and only sts actions
+func ValidateTrustAssertion(assertion *types.Assertion) error {
+	if len(assertion.Principals) == 0 {
+		return fmt.Errorf("'principals' is required for trust policy assertion '%s'", assertion.Comment)
+	}
+	for principalType := range assertion.Principals {
+		if !principalTypes[principalType] {
+			return fmt.Errorf("Unknown principal type '%s' for trust policy assertion '%s'; expected one of AWS, Service, Federated or CanonicalUser",
+				principalType, assertion.Comment)
+		}
+	}
+	if len(assertion.ActionNames) == 0 {
+		return fmt.Errorf("'action_names' is required for trust policy assertion '%s'", assertion.Comment)
+	}
+	for _, action := range assertion.ActionNames {
+		if !strings.HasPrefix(strings.ToLower(action), "sts:") {
+			return fmt.Errorf("Trust policy assertion '%s' has action '%s'; only sts actions (e.g. sts:AssumeRole) apply to trust policies",
+				assertion.Comment, action)
+		}
+	}
+	return nil
+}
+
+// trustContext builds the request context for a principal, adding the
+// aws:PrincipalArn, aws:PrincipalAccount and aws:PrincipalType keys for AWS
+// principals unless the assertion supplies them
+func trustContext(assertion *types.Assertion, principalType, principal string) map[string][]string {
+	context := NewContext(assertion.ContextEntries)
+	if principalType != PrincipalAWS {
+		return context
+	}
+	id := newIdentity(principalType, principal)
+	principalArn := principal
+	if accountIDPattern.MatchString(principal) {
+		principalArn = fmt.Sprintf("arn:aws:iam::%s:root", principal)
+	}
+	defaults := map[string]string{
+		"aws:principalarn":     principalArn,
+		"aws:principalaccount": id.Account,
+	}
+	if id.Root {
+		defaults["aws:principaltype"] = "Account"
+	} else if len(id.RoleName) > 0 {
+		defaults["aws:principaltype"] = "AssumedRole"
+	} else if arn := ParseARN(principal); arn != nil && strings.HasPrefix(arn.Resource, "user/") {
+		defaults["aws:principaltype"] = "User"
+	}
+	for key, value := range defaults {
+		if _, ok := context[key]; !ok && len(value) > 0 {
+			context[key] = []string{value}
+		}
+	}
+	return context
+}
+
+func sortedKeys(m map[string][]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
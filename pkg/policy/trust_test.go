@@ -0,0 +1,163 @@
+package policy
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/matt-deboer/assert-aws-iam-permissions/pkg/types"
+)
+
+const testTrustPolicy = `
+{
+	"Version": "2012-10-17",
+	"Statement": [
+		{
+			"Sid": "PartnerWithExternalId",
+			"Effect": "Allow",
+			"Principal": {"AWS": "arn:aws:iam::210987654321:root"},
+			"Action": "sts:AssumeRole",
+			"Condition": {
+				"StringEquals": {"sts:ExternalId": "partner-secret"},
+				"Bool": {"aws:MultiFactorAuthPresent": "true"}
+			}
+		},
+		{
+			"Sid": "EC2",
+			"Effect": "Allow",
+			"Principal": {"Service": "ec2.amazonaws.com"},
+			"Action": "sts:AssumeRole"
+		},
+		{
+			"Sid": "GitHubActions",
+			"Effect": "Allow",
+			"Principal": {"Federated": "arn:aws:iam::123456789012:oidc-provider/token.actions.githubusercontent.com"},
+			"Action": "sts:AssumeRoleWithWebIdentity",
+			"Condition": {
+				"StringLike": {"token.actions.githubusercontent.com:sub": "repo:my-org/my-repo:*"}
+			}
+		},
+		{
+			"Sid": "WildcardRoleArn",
+			"Effect": "Allow",
+			"Principal": {"AWS": "arn:aws:iam::333333333333:role/*"},
+			"Action": "sts:AssumeRole"
+		},
+		{
+			"Sid": "OnlyBreakGlass",
+			"Effect": "Deny",
+			"NotPrincipal": {"AWS": [
+				"arn:aws:iam::123456789012:role/break-glass",
+				"arn:aws:iam::123456789012:root"
+			]},
+			"Action": "sts:TagSession"
+		}
+	]
+}
+`
+
+func TestAssertTrustPolicy(t *testing.T) {
+	assertions := []*types.Assertion{
+		&types.Assertion{
+			Comment:        "partner can assume with external id and MFA",
+			Principals:     map[string][]string{"AWS": {"arn:aws:iam::210987654321:role/partner-deployer"}},
+			ActionNames:    []string{"sts:AssumeRole"},
+			ExpectedResult: "allowed",
+			ContextEntries: map[string]*types.ContextEntryValue{
+				"sts:ExternalId":             &types.ContextEntryValue{Values: []string{"partner-secret"}},
+				"aws:MultiFactorAuthPresent": &types.ContextEntryValue{Type: "boolean", Values: []string{"true"}},
+			},
+		},
+		&types.Assertion{
+			Comment:        "partner cannot assume without the external id",
+			Principals:     map[string][]string{"AWS": {"210987654321"}},
+			ActionNames:    []string{"sts:AssumeRole"},
+			ExpectedResult: "denied",
+			ContextEntries: map[string]*types.ContextEntryValue{
+				"aws:MultiFactorAuthPresent": &types.ContextEntryValue{Type: "boolean", Values: []string{"true"}},
+			},
+		},
+		&types.Assertion{
+			Comment: "other accounts and services are not trusted",
+			Principals: map[string][]string{
+				"AWS":     {"arn:aws:iam::111111111111:root"},
+				"Service": {"lambda.amazonaws.com"},
+			},
+			ActionNames:    []string{"sts:AssumeRole"},
+			ExpectedResult: "implicitDeny",
+		},
+		&types.Assertion{
+			Comment:        "wildcards within principal ARNs are not honored",
+			Principals:     map[string][]string{"AWS": {"arn:aws:iam::333333333333:role/anything"}},
+			ActionNames:    []string{"sts:AssumeRole"},
+			ExpectedResult: "implicitDeny",
+		},
+		&types.Assertion{
+			Comment:        "ec2 is trusted",
+			Principals:     map[string][]string{"Service": {"ec2.amazonaws.com"}},
+			ActionNames:    []string{"sts:AssumeRole"},
+			ExpectedResult: "allowed",
+		},
+		&types.Assertion{
+			Comment: "only the expected repository can assume via OIDC",
+			Principals: map[string][]string{
+				"Federated": {"arn:aws:iam::123456789012:oidc-provider/token.actions.githubusercontent.com"},
+			},
+			ActionNames:    []string{"sts:AssumeRoleWithWebIdentity"},
+			ExpectedResult: "denied",
+			ContextEntries: map[string]*types.ContextEntryValue{
+				"token.actions.githubusercontent.com:sub": &types.ContextEntryValue{Values: []string{"repo:my-org/other-repo:ref:refs/heads/main"}},
+			},
+		},
+		&types.Assertion{
+			Comment:        "sessions of break-glass are exempt from the NotPrincipal deny",
+			Principals:     map[string][]string{"AWS": {"arn:aws:sts::123456789012:assumed-role/break-glass/alice"}},
+			ActionNames:    []string{"sts:TagSession"},
+			ExpectedResult: "implicitDeny",
+		},
+		&types.Assertion{
+			Comment:        "everyone else is explicitly denied by the NotPrincipal deny",
+			Principals:     map[string][]string{"AWS": {"arn:aws:iam::123456789012:role/other"}},
+			ActionNames:    []string{"sts:TagSession"},
+			ExpectedResult: "explicitDeny",
+		},
+	}
+
+	if err := AssertTrustPolicy(assertions, testTrustPolicy); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestAssertTrustPolicy_Failure(t *testing.T) {
+	assertions := []*types.Assertion{
+		&types.Assertion{
+			Comment:        "partner cannot assume the role",
+			Principals:     map[string][]string{"AWS": {"arn:aws:iam::210987654321:role/partner-deployer"}},
+			ActionNames:    []string{"sts:AssumeRole"},
+			ExpectedResult: "denied",
+			ContextEntries: map[string]*types.ContextEntryValue{
+				"sts:ExternalId":             &types.ContextEntryValue{Values: []string{"partner-secret"}},
+				"aws:MultiFactorAuthPresent": &types.ContextEntryValue{Type: "boolean", Values: []string{"true"}},
+			},
+		},
+	}
+	err := AssertTrustPolicy(assertions, testTrustPolicy)
+	if err == nil {
+		t.Fatal("expected the assertion to fail")
+	}
+	if !strings.Contains(err.Error(), "[ AWS arn:aws:iam::210987654321:role/partner-deployer ]: expected 'denied', but got 'allowed'; matched PartnerWithExternalId") {
+		t.Errorf("unexpected failure message:\n%s", err.Error())
+	}
+}
+
+func TestAssertTrustPolicy_Validation(t *testing.T) {
+	invalid := [][]*types.Assertion{
+		{&types.Assertion{ActionNames: []string{"sts:AssumeRole"}, ExpectedResult: "allowed"}},
+		{&types.Assertion{Principals: map[string][]string{"Users": {"x"}}, ActionNames: []string{"sts:AssumeRole"}}},
+		{&types.Assertion{Principals: map[string][]string{"AWS": {"*"}}, ActionNames: []string{"s3:GetObject"}}},
+	}
+	for _, assertions := range invalid {
+		if err := AssertTrustPolicy(assertions, testTrustPolicy); err == nil {
+			t.Errorf("expected a validation error for %+v", assertions[0])
+		}
+	}
+}
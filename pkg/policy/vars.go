@@ -0,0 +1,108 @@
+package policy
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/matt-deboer/assert-aws-iam-permissions/pkg/types"
+)
+
+// inputVariablePattern matches input variables, written as {{name}}; unlike
+// IAM policy variables (${aws:username}), they are resolved before evaluation
+var inputVariablePattern = regexp.MustCompile(`\{\{\s*([^{}\s]*)\s*\}\}`)
+
+var variableNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.-]*$`)
+
+// Interpolate replaces the input variables in value with their values,
+// returning an error naming any undefined variables
+func Interpolate(value string, vars map[string]string) (string, error) {
+	undefined := []string{}
+	result := inputVariablePattern.ReplaceAllStringFunc(value, func(variable string) string {
+		name := inputVariablePattern.FindStringSubmatch(variable)[1]
+		resolved, ok := vars[name]
+		if !ok {
+			undefined = append(undefined, name)
+			return variable
+		}
+		return resolved
+	})
+	if len(undefined) > 0 {
+		return "", fmt.Errorf("Undefined variable(s) %s", strings.Join(undefined, ", "))
+	}
+	return result, nil
+}
+
+// ParseVar parses a variable definition of the form key=value
+func ParseVar(definition string) (string, string, error) {
+	parts := strings.SplitN(definition, "=", 2)
+	if len(parts) != 2 || !variableNamePattern.MatchString(parts[0]) {
+		return "", "", fmt.Errorf("Invalid variable '%s'; expected key=value, where the key is a letter or underscore "+
+			"followed by letters, digits, '_', '.' or '-'", definition)
+	}
+	return parts[0], parts[1], nil
+}
+
+// InterpolateAssertions replaces the input variables in the resource ARNs,
+// caller ARN, resource owner, resource policy, principals and context entry
+// values of each assertion (including those of its matrix)
+func InterpolateAssertions(assertions []*types.Assertion, vars map[string]string) error {
+	for _, assertion := range assertions {
+		i := &interpolator{vars: vars}
+		assertion.ResourceArns = i.all(assertion.ResourceArns)
+		assertion.CallerArn = i.one(assertion.CallerArn)
+		assertion.ResourceOwner = i.one(assertion.ResourceOwner)
+		assertion.ResourcePolicy = i.one(assertion.ResourcePolicy)
+		i.context(assertion.ContextEntries)
+		for _, principals := range assertion.Principals {
+			i.all(principals)
+		}
+		assertion.ExceptPrincipals = i.all(assertion.ExceptPrincipals)
+		if matrix := assertion.Matrix; matrix != nil {
+			matrix.ResourceArns = i.all(matrix.ResourceArns)
+			for _, entries := range matrix.Contexts {
+				i.context(entries)
+			}
+			for _, rule := range matrix.Rules {
+				rule.ResourceArns = i.all(rule.ResourceArns)
+			}
+		}
+		if i.err != nil {
+			return fmt.Errorf("Assertion '%s': %v", assertion.Comment, i.err)
+		}
+	}
+	return nil
+}
+
+// interpolator records the first error of a series of interpolations
+type interpolator struct {
+	vars map[string]string
+	err  error
+}
+
+func (i *interpolator) one(value string) string {
+	if i.err != nil {
+		return value
+	}
+	result, err := Interpolate(value, i.vars)
+	if err != nil {
+		i.err = err
+		return value
+	}
+	return result
+}
+
+func (i *interpolator) all(values []string) []string {
+	for j, value := range values {
+		values[j] = i.one(value)
+	}
+	return values
+}
+
+func (i *interpolator) context(entries map[string]*types.ContextEntryValue) {
+	for _, entry := range entries {
+		if entry != nil {
+			entry.Values = i.all(entry.Values)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package policy
+
+import (
+	"testing"
+
+	"github.com/matt-deboer/assert-aws-iam-permissions/pkg/types"
+)
+
+func TestInterpolate(t *testing.T) {
+	vars := map[string]string{"account_id": "123456789012", "env": "prod"}
+	interpolated, err := Interpolate(`arn:aws:s3:::{{env}}-bucket/${aws:username}/{{ account_id }}`, vars)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "arn:aws:s3:::prod-bucket/${aws:username}/123456789012"; interpolated != expected {
+		t.Errorf("expected %s, but got %s", expected, interpolated)
+	}
+
+	_, err = Interpolate(`arn:aws:iam::{{account_id}}:role/{{role}}-{{region}}`, vars)
+	if err == nil || err.Error() != "Undefined variable(s) role, region" {
+		t.Errorf("expected an error naming the undefined variables, but got %v", err)
+	}
+
+	if _, _, err = ParseVar("account id=1"); err == nil {
+		t.Error("expected an invalid variable name to be rejected")
+	}
+}
+
+func TestInterpolateAssertions(t *testing.T) {
+	assertion := &types.Assertion{
+		Comment:       "partner reads",
+		ResourceArns:  []string{"arn:aws:s3:::{{env}}-bucket/key"},
+		CallerArn:     "arn:aws:iam::{{partner}}:role/reader",
+		ResourceOwner: "arn:aws:iam::{{account_id}}:root",
+		ContextEntries: map[string]*types.ContextEntryValue{
+			"aws:SourceVpce": &types.ContextEntryValue{Values: []string{"{{vpce}}"}},
+		},
+	}
+	vars := map[string]string{"env": "prod", "partner": "210987654321", "account_id": "123456789012", "vpce": "vpce-1234"}
+	if err := InterpolateAssertions([]*types.Assertion{assertion}, vars); err != nil {
+		t.Fatal(err)
+	}
+	if assertion.ResourceArns[0] != "arn:aws:s3:::prod-bucket/key" || assertion.CallerArn != "arn:aws:iam::210987654321:role/reader" ||
+		assertion.ResourceOwner != "arn:aws:iam::123456789012:root" || assertion.ContextEntries["aws:SourceVpce"].Values[0] != "vpce-1234" {
+		t.Errorf("unexpected interpolation: %+v", assertion)
+	}
+
+	delete(vars, "env")
+	assertion.ResourceArns = []string{"arn:aws:s3:::{{env}}-bucket/key"}
+	err := InterpolateAssertions([]*types.Assertion{assertion}, vars)
+	if err == nil || err.Error() != "Assertion 'partner reads': Undefined variable(s) env" {
+		t.Errorf("expected an undefined variable error, but got %v", err)
+	}
+}
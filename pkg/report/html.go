@@ -0,0 +1,108 @@
+package report
+
+import (
+	"html/template"
+	"io"
+	"strings"
+
+	"github.com/matt-deboer/assert-aws-iam-permissions/pkg/runner"
+)
+
+// htmlTemplate is self-contained, with its styles inline, so that the report
+// can be attached or archived as a single file
+var htmlTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"join":  strings.Join,
+	"badge": badgeClass,
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>IAM policy assertions</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; color: #24292f; margin: 2em auto; max-width: 1100px; padding: 0 1em; }
+h1, h2, h3 { font-weight: 600; }
+h2 { border-bottom: 1px solid #d0d7de; padding-bottom: .3em; margin-top: 2em; }
+table { border-collapse: collapse; margin: 1em 0; width: 100%; }
+th, td { border: 1px solid #d0d7de; padding: .3em .6em; text-align: left; vertical-align: top; }
+th { background: #f6f8fa; }
+code, pre { font-family: SFMono-Regular, Consolas, "Liberation Mono", Menlo, monospace; font-size: 90%; }
+pre { background: #f6f8fa; border: 1px solid #d0d7de; border-radius: 6px; overflow-x: auto; padding: .5em 0; }
+pre span.line { display: block; padding: 0 1em; }
+pre span.line .number { color: #8c959f; display: inline-block; margin-right: 1em; text-align: right; user-select: none; width: 3em; }
+pre span.hit { background: #dafbe1; }
+pre span.failed { background: #ffebe9; }
+pre span.annotation { color: #57606a; font-style: italic; }
+.badge { border-radius: 1em; color: #fff; display: inline-block; font-size: 80%; font-weight: 600; padding: .1em .7em; }
+.badge.PASS { background: #1a7f37; }
+.badge.FAIL { background: #cf222e; }
+.badge.ERROR { background: #9a6700; }
+.badge.SKIP { background: #6e7781; }
+.error { color: #cf222e; }
+.meter { background: #eaeef2; border-radius: 4px; height: .6em; margin: .3em 0; width: 20em; }
+.meter div { background: #1a7f37; border-radius: 4px; height: 100%; }
+.meter.over div { background: #cf222e; }
+</style>
+</head>
+<body>
+<h1>IAM policy assertions</h1>
+<p>
+<span class="badge PASS">{{.Summary.Passed}} passed</span>
+<span class="badge FAIL">{{.Summary.Failed}} failed</span>
+<span class="badge SKIP">{{.Summary.Skipped}} skipped</span>
+<span class="badge ERROR">{{.Summary.Errored}} errored</span>
+</p>
+{{range .Policies}}
+<h2><span class="badge {{badge .Status}}">{{.Status}}</span> {{.Name}}</h2>
+{{if .PolicyFile}}<p>Policy: <code>{{.PolicyFile}}</code></p>{{end}}
+{{if .AssertionsFile}}<p>Assertions: <code>{{.AssertionsFile}}</code></p>{{end}}
+{{if .Error}}<p class="error">{{.Error}}</p>{{end}}
+<h3>Length</h3>
+{{if .MaxLength}}
+<p>{{.Length}} of {{.MaxLength}} characters, excluding whitespace{{if .OverLimit}} &mdash; <span class="error">over the limit</span>{{end}}</p>
+<div class="meter{{if .OverLimit}} over{{end}}"><div style="width: {{.LengthPercent}}%"></div></div>
+{{else}}
+<p>{{.Length}} characters, excluding whitespace (no <code>max_length</code> configured)</p>
+{{end}}
+{{if .Lines}}
+<h3>Policy</h3>
+<pre>{{range .Lines}}{{with .Statement}}{{$statement := .}}{{range .Hits}}<span class="line annotation"><span class="number"></span>{{$statement.Indent}}// {{$statement.Label}}: <span class="badge {{if .Passed}}PASS{{else}}FAIL{{end}}">{{if .Passed}}PASS{{else}}FAIL{{end}}</span> {{.Assertion}} ({{join .Actions ", "}})</span>{{end}}{{end}}<span class="line{{if .Failed}} failed{{else if .Hit}} hit{{end}}"><span class="number">{{.Number}}</span>{{.Text}}</span>{{end}}</pre>
+{{end}}
+<h3>Assertions</h3>
+{{if .Assertions}}
+<table>
+<tr><th>Assertion</th><th>Status</th><th>Evaluations passed</th><th>Error</th></tr>
+{{range .Assertions}}<tr><td>{{.Name}}</td><td><span class="badge {{badge .Status}}">{{.Status}}</span></td><td>{{.Passed}} / {{.Evaluations}}</td><td class="error">{{.Error}}</td></tr>
+{{end}}</table>
+{{else}}
+<p>No assertions.</p>
+{{end}}
+{{if .Results}}
+<h3>Evaluated actions and resources</h3>
+<table>
+<tr><th>Assertion</th><th>Action</th><th>Resource</th><th>Expected</th><th>Decision</th><th>Matched statements</th></tr>
+{{range .Results}}<tr><td>{{.Assertion}}</td><td><code>{{.Action}}</code></td><td><code>{{.Resource}}</code></td><td>{{.ExpectedResult}}</td><td><span class="badge {{if .Passed}}PASS{{else}}FAIL{{end}}">{{.Decision}}</span></td><td>{{join .MatchedStatements ", "}}</td></tr>
+{{end}}</table>
+{{end}}
+{{end}}
+<p><small>Generated by {{.Tool.Name}}{{if .Tool.Version}} {{.Tool.Version}}{{end}}</small></p>
+</body>
+</html>
+`))
+
+// WriteHTML writes the results as a self-contained HTML report for reviewers:
+// for each policy, its length against the maximum, the pretty-printed policy
+// with each statement annotated by the assertions which matched it, a table
+// of the assertions, and the evaluated actions and resources
+func WriteHTML(w io.Writer, results []*runner.TargetResult) error {
+	return htmlTemplate.Execute(w, newReview(results))
+}
+
+// badgeClass restricts the class of a status badge to the known statuses
+func badgeClass(status string) string {
+	switch status {
+	case runner.Pass, runner.Fail, runner.Error:
+		return status
+	default:
+		return runner.Skip
+	}
+}
@@ -0,0 +1,163 @@
+package report
+
+import (
+	"encoding/json"
+	"io"
+
+	"github.com/matt-deboer/assert-aws-iam-permissions/pkg/policy"
+	"github.com/matt-deboer/assert-aws-iam-permissions/pkg/runner"
+	"github.com/matt-deboer/assert-aws-iam-permissions/pkg/types"
+	"github.com/matt-deboer/assert-aws-iam-permissions/pkg/version"
+)
+
+// SchemaVersion is the version of the JSON results document; it changes
+// only when fields are removed or their meaning changes, while new fields
+// may be added within a version
+const SchemaVersion = "1"
+
+// Results is the JSON results document, described by docs/results.schema.json
+type Results struct {
+	SchemaVersion string           `json:"schema_version"`
+	Tool          *Tool            `json:"tool"`
+	Policies      []*PolicyResults `json:"policies"`
+	Summary       *Summary         `json:"summary"`
+}
+
+// Tool identifies the version of the tool producing the results
+type Tool struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+// PolicyResults holds the results of the assertions evaluated against one policy
+type PolicyResults struct {
+	Name           string              `json:"name"`
+	PolicyFile     string              `json:"policy_file,omitempty"`
+	AssertionsFile string              `json:"assertions_file,omitempty"`
+	Status         string              `json:"status"`
+	Error          string              `json:"error,omitempty"`
+	DurationMillis int64               `json:"duration_ms"`
+	Assertions     []*AssertionResults `json:"assertions"`
+}
+
+// AssertionResults holds the input and the evaluations of one assertion
+type AssertionResults struct {
+	Name           string             `json:"name"`
+	Suite          string             `json:"suite,omitempty"`
+	Status         string             `json:"status"`
+	Error          string             `json:"error,omitempty"`
+	DurationMillis int64              `json:"duration_ms"`
+	Input          *types.Assertion   `json:"input"`
+	Evaluations    []*EvaluatedResult `json:"evaluations"`
+}
+
+// EvaluatedResult is the decision for one evaluated action and resource
+type EvaluatedResult struct {
+	Action               string   `json:"action"`
+	Resource             string   `json:"resource"`
+	MatrixCell           string   `json:"matrix_cell,omitempty"`
+	ExpectedResult       string   `json:"expected_result"`
+	Decision             string   `json:"decision"`
+	Passed               bool     `json:"passed"`
+	MatchedStatements    []string `json:"matched_statements"`
+	MissingContextValues []string `json:"missing_context_values"`
+	DecisionDetails      string   `json:"decision_details,omitempty"`
+}
+
+// Summary counts the policies, assertions (by status) and evaluations of the results
+type Summary struct {
+	Policies          int `json:"policies"`
+	Assertions        int `json:"assertions"`
+	Passed            int `json:"passed"`
+	Failed            int `json:"failed"`
+	Skipped           int `json:"skipped"`
+	Errored           int `json:"errored"`
+	Evaluations       int `json:"evaluations"`
+	FailedEvaluations int `json:"failed_evaluations"`
+}
+
+// NewResults builds the JSON results document for the results of a run
+func NewResults(results []*runner.TargetResult) *Results {
+	counts := runner.Summarize(results)
+	document := &Results{
+		SchemaVersion: SchemaVersion,
+		Tool:          &Tool{Name: version.Name, Version: version.Version},
+		Policies:      []*PolicyResults{},
+		Summary: &Summary{
+			Policies: len(results),
+			Passed:   counts.Passed,
+			Failed:   counts.Failed,
+			Skipped:  counts.Skipped,
+			Errored:  counts.Errored,
+		},
+	}
+	for _, result := range results {
+		policyResults := &PolicyResults{
+			Name:           result.Target.Name,
+			PolicyFile:     result.Target.PolicyFile,
+			AssertionsFile: result.Target.AssertionsFile,
+			Status:         result.Status(),
+			DurationMillis: result.Duration.Nanoseconds() / 1e6,
+			Assertions:     []*AssertionResults{},
+		}
+		if result.Err != nil {
+			policyResults.Error = result.Err.Error()
+		}
+		for _, assertion := range result.Assertions {
+			assertionResults := &AssertionResults{
+				Name:           assertion.Name(),
+				Suite:          assertion.Suite,
+				Status:         assertion.Status,
+				DurationMillis: assertion.Duration.Nanoseconds() / 1e6,
+				Input:          assertion.Assertion,
+				Evaluations:    []*EvaluatedResult{},
+			}
+			if assertion.Err != nil {
+				assertionResults.Error = assertion.Err.Error()
+			}
+			for _, evaluated := range assertion.Results {
+				assertionResults.Evaluations = append(assertionResults.Evaluations, newEvaluatedResult(evaluated))
+				document.Summary.Evaluations++
+				if !evaluated.Passed {
+					document.Summary.FailedEvaluations++
+				}
+			}
+			policyResults.Assertions = append(policyResults.Assertions, assertionResults)
+			document.Summary.Assertions++
+		}
+		document.Policies = append(document.Policies, policyResults)
+	}
+	return document
+}
+
+func newEvaluatedResult(result *policy.Result) *EvaluatedResult {
+	evaluated := &EvaluatedResult{
+		Action:               result.Action,
+		Resource:             result.Resource,
+		MatrixCell:           result.Assertion.MatrixCell,
+		ExpectedResult:       result.Assertion.ExpectedResult,
+		Decision:             result.Decision,
+		Passed:               result.Passed,
+		MatchedStatements:    result.MatchedStatements,
+		MissingContextValues: result.MissingContextValues,
+		DecisionDetails:      result.Details,
+	}
+	// lists are always present, so that consumers needn't check for null
+	if evaluated.MatchedStatements == nil {
+		evaluated.MatchedStatements = []string{}
+	}
+	if evaluated.MissingContextValues == nil {
+		evaluated.MissingContextValues = []string{}
+	}
+	return evaluated
+}
+
+// WriteJSON writes the JSON results document for the results of a run
+func WriteJSON(w io.Writer, results []*runner.TargetResult) error {
+	data, err := json.MarshalIndent(NewResults(results), "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
@@ -0,0 +1,46 @@
+package report
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func TestWriteJSON(t *testing.T) {
+	output := &bytes.Buffer{}
+	if err := WriteJSON(output, testResults()); err != nil {
+		t.Fatal(err)
+	}
+	var results Results
+	if err := json.Unmarshal(output.Bytes(), &results); err != nil {
+		t.Fatal(err)
+	}
+	if results.SchemaVersion != SchemaVersion || len(results.Policies) != 2 {
+		t.Fatalf("unexpected results %s", output.String())
+	}
+	expected := Summary{Policies: 2, Assertions: 4, Passed: 1, Failed: 1, Skipped: 1, Errored: 2, Evaluations: 3, FailedEvaluations: 1}
+	if *results.Summary != expected {
+		t.Errorf("expected summary %+v, but got %+v", expected, *results.Summary)
+	}
+
+	reader := results.Policies[0]
+	if reader.Status != "ERROR" || len(reader.Assertions) != 4 {
+		t.Fatalf("unexpected policy results %+v", reader)
+	}
+	read, write, list := reader.Assertions[0], reader.Assertions[1], reader.Assertions[2]
+	if read.Name != "readers/Can read objects" || read.Suite != "readers" || read.Input.Comment != "Can read objects" ||
+		len(read.Evaluations) != 2 || read.Evaluations[1].Action != "s3:GetObjectAcl" || !read.Evaluations[1].Passed {
+		t.Errorf("unexpected assertion results %+v", read)
+	}
+	evaluation := write.Evaluations[0]
+	if write.Status != "FAIL" || evaluation.ExpectedResult != "denied" || evaluation.Decision != "allowed" ||
+		evaluation.MatchedStatements[0] != "ReadWrite" || evaluation.MissingContextValues == nil {
+		t.Errorf("unexpected failed evaluation %+v", evaluation)
+	}
+	if list.Status != "ERROR" || list.Error != "Throttling: Rate exceeded" || len(list.Evaluations) != 0 {
+		t.Errorf("unexpected errored assertion %+v", list)
+	}
+	if orphan := results.Policies[1]; orphan.Error != "No policy found for policies/orphan.assertions.yaml" || orphan.Assertions == nil {
+		t.Errorf("unexpected errored policy %+v", orphan)
+	}
+}
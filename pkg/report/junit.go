@@ -0,0 +1,185 @@
+package report
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/matt-deboer/assert-aws-iam-permissions/pkg/policy"
+	"github.com/matt-deboer/assert-aws-iam-permissions/pkg/runner"
+)
+
+type junitTestSuites struct {
+	XMLName  xml.Name          `xml:"testsuites"`
+	Tests    int               `xml:"tests,attr"`
+	Failures int               `xml:"failures,attr"`
+	Errors   int               `xml:"errors,attr"`
+	Skipped  int               `xml:"skipped,attr"`
+	Time     string            `xml:"time,attr"`
+	Suites   []*junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name      string           `xml:"name,attr"`
+	Tests     int              `xml:"tests,attr"`
+	Failures  int              `xml:"failures,attr"`
+	Errors    int              `xml:"errors,attr"`
+	Skipped   int              `xml:"skipped,attr"`
+	Time      string           `xml:"time,attr"`
+	TestCases []*junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitMessage `xml:"failure,omitempty"`
+	Error     *junitMessage `xml:"error,omitempty"`
+	Skipped   *junitMessage `xml:"skipped,omitempty"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr,omitempty"`
+	Type    string `xml:"type,attr,omitempty"`
+	Body    string `xml:",cdata"`
+}
+
+// WriteJUnit writes the results as JUnit XML: a testsuite per policy, and a
+// testcase per evaluated action and resource of each assertion. Assertions
+// which could not be evaluated (and policies which could not be loaded) are
+// reported as errors rather than failures.
+func WriteJUnit(w io.Writer, results []*runner.TargetResult) error {
+	suites := &junitTestSuites{}
+	var total time.Duration
+	for _, result := range results {
+		suite := junitSuite(result)
+		suites.Suites = append(suites.Suites, suite)
+		suites.Tests += suite.Tests
+		suites.Failures += suite.Failures
+		suites.Errors += suite.Errors
+		suites.Skipped += suite.Skipped
+		total += result.Duration
+	}
+	suites.Time = seconds(total)
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(suites); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+func junitSuite(result *runner.TargetResult) *junitTestSuite {
+	name := result.Target.Name
+	suite := &junitTestSuite{Name: name, Time: seconds(result.Duration)}
+	if result.Err != nil {
+		suite.TestCases = append(suite.TestCases, &junitTestCase{
+			Name:      result.Target.AssertionsFile,
+			ClassName: name,
+			Time:      seconds(0),
+			Error:     &junitMessage{Message: result.Err.Error(), Type: "LoadError", Body: result.Err.Error()},
+		})
+	}
+	for _, assertion := range result.Assertions {
+		switch assertion.Status {
+		case runner.Skip:
+			suite.TestCases = append(suite.TestCases, &junitTestCase{
+				Name:      assertion.Name(),
+				ClassName: name,
+				Time:      seconds(0),
+				Skipped:   &junitMessage{Message: "excluded by the --run or --tags filters"},
+			})
+		case runner.Error:
+			suite.TestCases = append(suite.TestCases, &junitTestCase{
+				Name:      assertion.Name(),
+				ClassName: name,
+				Time:      seconds(assertion.Duration),
+				Error:     &junitMessage{Message: assertion.Err.Error(), Type: errorType(assertion.Err), Body: assertion.Err.Error()},
+			})
+		default:
+			// the time of the assertion is shared among its results
+			each := assertion.Duration
+			if len(assertion.Results) > 1 {
+				each /= time.Duration(len(assertion.Results))
+			}
+			for _, evaluated := range assertion.Results {
+				testCase := &junitTestCase{
+					Name:      resultName(assertion, evaluated),
+					ClassName: name,
+					Time:      seconds(each),
+				}
+				if !evaluated.Passed {
+					testCase.Failure = &junitMessage{
+						Message: fmt.Sprintf("expected '%s', but got '%s'", evaluated.Assertion.ExpectedResult, evaluated.Decision),
+						Type:    evaluated.Decision,
+						Body:    failureDetails(evaluated),
+					}
+				}
+				suite.TestCases = append(suite.TestCases, testCase)
+			}
+		}
+	}
+	for _, testCase := range suite.TestCases {
+		suite.Tests++
+		if testCase.Failure != nil {
+			suite.Failures++
+		} else if testCase.Error != nil {
+			suite.Errors++
+		} else if testCase.Skipped != nil {
+			suite.Skipped++
+		}
+	}
+	return suite
+}
+
+// resultName names the testcase of an evaluated action and resource after
+// the assertion's comment
+func resultName(assertion *runner.AssertionResult, result *policy.Result) string {
+	name := assertion.Name()
+	if len(result.Assertion.MatrixCell) > 0 {
+		name += " " + result.Assertion.MatrixCell
+	}
+	return fmt.Sprintf("%s [%s %s]", name, result.Action, result.Resource)
+}
+
+func failureDetails(result *policy.Result) string {
+	lines := []string{
+		"action: " + result.Action,
+		"resource: " + result.Resource,
+		"expected: " + result.Assertion.ExpectedResult,
+		"decision: " + result.Decision,
+	}
+	if len(result.MatchedStatements) > 0 {
+		lines = append(lines, "matched statements: "+strings.Join(result.MatchedStatements, ", "))
+	} else {
+		lines = append(lines, "matched statements: none")
+	}
+	if len(result.MissingContextValues) > 0 {
+		lines = append(lines, "missing context values: "+strings.Join(result.MissingContextValues, ", "))
+	}
+	if len(result.Details) > 0 {
+		lines = append(lines, "details: "+result.Details)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// errorType names the AWS error code of simulator errors
+func errorType(err error) string {
+	if coded, ok := err.(interface {
+		Code() string
+	}); ok {
+		return coded.Code()
+	}
+	return "EvaluationError"
+}
+
+func seconds(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
@@ -0,0 +1,68 @@
+package report
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/matt-deboer/assert-aws-iam-permissions/pkg/policy"
+	"github.com/matt-deboer/assert-aws-iam-permissions/pkg/runner"
+	"github.com/matt-deboer/assert-aws-iam-permissions/pkg/types"
+)
+
+func testResults() []*runner.TargetResult {
+	read := &types.Assertion{Comment: "Can read objects", ExpectedResult: "allowed",
+		ActionNames: []string{"s3:GetObject", "s3:GetObjectAcl"}, ResourceArns: []string{"arn:aws:s3:::my-bucket/key"}}
+	write := &types.Assertion{Comment: "Cannot write <objects>", ExpectedResult: "denied",
+		ActionNames: []string{"s3:PutObject"}, ResourceArns: []string{"arn:aws:s3:::my-bucket/key"}}
+	list := &types.Assertion{Comment: "Can list", ExpectedResult: "allowed", ActionNames: []string{"s3:ListBucket"}}
+
+	return []*runner.TargetResult{
+		{
+			Target: &runner.Target{Name: "policies/s3/reader", AssertionsFile: "policies/s3/reader.assertions.yaml"},
+			Assertions: []*runner.AssertionResult{
+				{Suite: "readers", Assertion: read, Label: read.Comment, Status: runner.Pass, Results: []*policy.Result{
+					{Assertion: read, Action: "s3:GetObject", Resource: "arn:aws:s3:::my-bucket/key", Decision: "allowed", Passed: true},
+					{Assertion: read, Action: "s3:GetObjectAcl", Resource: "arn:aws:s3:::my-bucket/key", Decision: "allowed", Passed: true},
+				}},
+				{Assertion: write, Label: write.Comment, Status: runner.Fail, Results: []*policy.Result{
+					{Assertion: write, Action: "s3:PutObject", Resource: "arn:aws:s3:::my-bucket/key", Decision: "allowed",
+						MatchedStatements: []string{"ReadWrite"}},
+				}},
+				{Assertion: list, Label: list.Comment, Status: runner.Error,
+					Err: awserr.New("Throttling", "Rate exceeded", nil)},
+				{Assertion: list, Label: "Assertion[3]", Status: runner.Skip},
+			},
+		},
+		{
+			Target: &runner.Target{Name: "policies/orphan", AssertionsFile: "policies/orphan.assertions.yaml"},
+			Err:    errors.New("No policy found for policies/orphan.assertions.yaml"),
+		},
+	}
+}
+
+func TestWriteJUnit(t *testing.T) {
+	output := &bytes.Buffer{}
+	if err := WriteJUnit(output, testResults()); err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{
+		`<?xml version="1.0" encoding="UTF-8"?>`,
+		`<testsuites tests="6" failures="1" errors="2" skipped="1" time="0.000">`,
+		`<testsuite name="policies/s3/reader" tests="5" failures="1" errors="1" skipped="1" time="0.000">`,
+		`<testcase name="readers/Can read objects [s3:GetObjectAcl arn:aws:s3:::my-bucket/key]" classname="policies/s3/reader" time="0.000"></testcase>`,
+		`<failure message="expected &#39;denied&#39;, but got &#39;allowed&#39;" type="allowed"><![CDATA[action: s3:PutObject` +
+			"\nresource: arn:aws:s3:::my-bucket/key\nexpected: denied\ndecision: allowed\nmatched statements: ReadWrite]]></failure>",
+		`name="Cannot write &lt;objects&gt; [s3:PutObject arn:aws:s3:::my-bucket/key]"`,
+		`<error message="Throttling: Rate exceeded" type="Throttling">`,
+		`<skipped message="excluded by the --run or --tags filters"></skipped>`,
+		`<testcase name="policies/orphan.assertions.yaml" classname="policies/orphan" time="0.000">`,
+		`<error message="No policy found for policies/orphan.assertions.yaml" type="LoadError">`,
+	} {
+		if !strings.Contains(output.String(), expected) {
+			t.Errorf("expected the report to contain %s, but got:\n%s", expected, output.String())
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package report
+
+import (
+	"io"
+	"strings"
+	"text/template"
+
+	"github.com/matt-deboer/assert-aws-iam-permissions/pkg/runner"
+)
+
+var markdownTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"badge":  markdownBadge,
+	"passed": markdownPassed,
+	"cell":   markdownCell,
+	"code":   markdownCode,
+	"join":   strings.Join,
+}).Parse(`# IAM policy assertions
+
+{{.Summary.Passed}} passed, {{.Summary.Failed}} failed, {{.Summary.Skipped}} skipped, {{.Summary.Errored}} errored
+{{range .Policies}}
+## {{badge .Status}} {{.Name}}
+{{if .PolicyFile}}
+Policy: {{code .PolicyFile}}
+{{end}}{{if .AssertionsFile}}
+Assertions: {{code .AssertionsFile}}
+{{end}}{{if .Error}}
+> **Error:** {{.Error}}
+{{end}}
+### Length
+{{if .MaxLength}}
+{{.Length}} of {{.MaxLength}} characters, excluding whitespace ({{.LengthPercent}}%){{if .OverLimit}} — **over the limit**{{end}}
+{{else}}
+{{.Length}} characters, excluding whitespace (no ` + "`max_length`" + ` configured)
+{{end}}{{if .Lines}}
+### Policy
+
+` + "```jsonc" + `
+{{range .Lines}}{{with .Statement}}{{$statement := .}}{{range .Hits}}{{$statement.Indent}}// {{passed .Passed}} {{$statement.Label}} matched by {{.Assertion}} ({{join .Actions ", "}})
+{{end}}{{end}}{{.Text}}
+{{end}}` + "```" + `
+{{end}}
+### Assertions
+{{if .Assertions}}
+| Assertion | Status | Evaluations passed | Error |
+|-----------|--------|--------------------|-------|
+{{range .Assertions}}| {{cell .Name}} | {{badge .Status}} | {{.Passed}} / {{.Evaluations}} | {{cell .Error}} |
+{{end}}{{else}}
+No assertions.
+{{end}}{{if .Results}}
+### Evaluated actions and resources
+
+| Assertion | Action | Resource | Expected | Decision | Matched statements |
+|-----------|--------|----------|----------|----------|--------------------|
+{{range .Results}}| {{cell .Assertion}} | {{code .Action}} | {{code .Resource}} | {{.ExpectedResult}} | {{passed .Passed}} {{.Decision}} | {{cell (join .MatchedStatements ", ")}} |
+{{end}}{{end}}{{end}}
+<sub>Generated by {{.Tool.Name}}{{if .Tool.Version}} {{.Tool.Version}}{{end}}</sub>
+`))
+
+// WriteMarkdown writes the results as a Markdown report for reviewers, with
+// the content of the HTML report (see WriteHTML); it suits pull request
+// comments and job summaries
+func WriteMarkdown(w io.Writer, results []*runner.TargetResult) error {
+	return markdownTemplate.Execute(w, newReview(results))
+}
+
+func markdownBadge(status string) string {
+	switch status {
+	case runner.Pass:
+		return "✅ PASS"
+	case runner.Fail:
+		return "❌ FAIL"
+	case runner.Error:
+		return "⚠️ ERROR"
+	default:
+		return "⏭️ SKIP"
+	}
+}
+
+func markdownPassed(passed bool) string {
+	if passed {
+		return markdownBadge(runner.Pass)
+	}
+	return markdownBadge(runner.Fail)
+}
+
+// markdownCell escapes text for a table cell, in which pipes end the cell
+// and newlines the row
+var markdownCell = strings.NewReplacer("|", `\|`, "\n", " ", "<", "&lt;", ">", "&gt;").Replace
+
+func markdownCode(text string) string {
+	if len(text) == 0 {
+		return ""
+	}
+	return "`" + strings.NewReplacer("|", `\|`, "\n", " ").Replace(text) + "`"
+}
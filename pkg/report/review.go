@@ -0,0 +1,217 @@
+package report
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+
+	"github.com/matt-deboer/assert-aws-iam-permissions/pkg/policy"
+	"github.com/matt-deboer/assert-aws-iam-permissions/pkg/runner"
+	"github.com/matt-deboer/assert-aws-iam-permissions/pkg/version"
+)
+
+// review is the content shared by the HTML and Markdown reports, which are
+// meant for reviewers of the policies rather than for tools
+type review struct {
+	Tool     *Tool
+	Summary  *runner.Summary
+	Policies []*reviewPolicy
+}
+
+type reviewPolicy struct {
+	Name           string
+	PolicyFile     string
+	AssertionsFile string
+	Status         string
+	Error          string
+	// Lines of the pretty-printed policy, annotated where its statements start
+	Lines      []*reviewLine
+	Statements []*reviewStatement
+	Length     int
+	MaxLength  int
+	Assertions []*reviewAssertion
+	Results    []*reviewResult
+}
+
+// OverLimit reports whether the policy is longer than its maximum length
+func (p *reviewPolicy) OverLimit() bool {
+	return p.MaxLength > 0 && p.Length > p.MaxLength
+}
+
+// LengthPercent is the length of the policy as a percentage of its maximum
+// length, capped at 100
+func (p *reviewPolicy) LengthPercent() int {
+	if p.MaxLength <= 0 || p.OverLimit() {
+		return 100
+	}
+	return p.Length * 100 / p.MaxLength
+}
+
+type reviewLine struct {
+	Number int
+	Text   string
+	// Statement is set on the first line of each statement
+	Statement *reviewStatement
+	// Hit and Failed mark the lines of statements matched by any evaluation,
+	// and by any failed evaluation
+	Hit    bool
+	Failed bool
+}
+
+type reviewStatement struct {
+	Label  string
+	Effect string
+	Hits   []*reviewHit
+	// Indent is the leading whitespace of the statement's first line
+	Indent string
+}
+
+// Failed reports whether any evaluation matching the statement failed
+func (s *reviewStatement) Failed() bool {
+	for _, hit := range s.Hits {
+		if !hit.Passed {
+			return true
+		}
+	}
+	return false
+}
+
+// reviewHit lists the evaluations of an assertion which matched a statement
+type reviewHit struct {
+	Assertion string
+	Actions   []string
+	Passed    bool
+}
+
+type reviewAssertion struct {
+	Name        string
+	Status      string
+	Error       string
+	Evaluations int
+	Passed      int
+}
+
+type reviewResult struct {
+	Assertion         string
+	Action            string
+	Resource          string
+	ExpectedResult    string
+	Decision          string
+	Passed            bool
+	MatchedStatements []string
+}
+
+func newReview(results []*runner.TargetResult) *review {
+	r := &review{
+		Tool:    &Tool{Name: toolName(), Version: version.Version},
+		Summary: runner.Summarize(results),
+	}
+	for _, result := range results {
+		r.Policies = append(r.Policies, newReviewPolicy(result))
+	}
+	return r
+}
+
+func newReviewPolicy(result *runner.TargetResult) *reviewPolicy {
+	p := &reviewPolicy{
+		Name:           result.Target.Name,
+		PolicyFile:     result.Target.PolicyFile,
+		AssertionsFile: result.Target.AssertionsFile,
+		Status:         result.Status(),
+		Length:         policy.PolicyLength(result.PolicyJSON),
+		MaxLength:      result.MaxLength,
+	}
+	if result.Err != nil {
+		p.Error = result.Err.Error()
+	}
+
+	// statements are located within the pretty-printed policy, so that the
+	// report reads the same however the policy was written
+	pretty := &bytes.Buffer{}
+	if err := json.Indent(pretty, []byte(result.PolicyJSON), "", "  "); err != nil {
+		pretty.Reset()
+		pretty.WriteString(result.PolicyJSON)
+	}
+	if len(strings.TrimSpace(pretty.String())) > 0 {
+		for i, text := range strings.Split(strings.TrimRight(pretty.String(), "\n"), "\n") {
+			p.Lines = append(p.Lines, &reviewLine{Number: i + 1, Text: text})
+		}
+	}
+	statements := map[string]*reviewStatement{}
+	doc, _ := policy.ParseDocument(pretty.String())
+	if doc != nil {
+		for i, statement := range doc.Statement {
+			s := &reviewStatement{Label: statement.Label(i), Effect: statement.Effect}
+			statements[s.Label] = s
+			p.Statements = append(p.Statements, s)
+		}
+	}
+
+	for _, assertion := range result.Assertions {
+		reviewed := &reviewAssertion{Name: assertion.Name(), Status: assertion.Status, Evaluations: len(assertion.Results)}
+		if assertion.Err != nil {
+			reviewed.Error = assertion.Err.Error()
+		}
+		for _, evaluated := range assertion.Results {
+			if evaluated.Passed {
+				reviewed.Passed++
+			}
+			name := assertion.Name()
+			if len(evaluated.Assertion.MatrixCell) > 0 {
+				name += " " + evaluated.Assertion.MatrixCell
+			}
+			p.Results = append(p.Results, &reviewResult{
+				Assertion:         name,
+				Action:            evaluated.Action,
+				Resource:          evaluated.Resource,
+				ExpectedResult:    evaluated.Assertion.ExpectedResult,
+				Decision:          evaluated.Decision,
+				Passed:            evaluated.Passed,
+				MatchedStatements: evaluated.MatchedStatements,
+			})
+			// statements of other policies (e.g. resource policies) aren't annotated
+			for _, label := range evaluated.MatchedStatements {
+				if statement, ok := statements[label]; ok {
+					statement.hit(name, evaluated)
+				}
+			}
+		}
+		p.Assertions = append(p.Assertions, reviewed)
+	}
+
+	if doc != nil {
+		for i, statement := range doc.Statement {
+			s := p.Statements[i]
+			for line := statement.Start.Line; line <= statement.End.Line && line <= len(p.Lines); line++ {
+				p.Lines[line-1].Hit = len(s.Hits) > 0
+				p.Lines[line-1].Failed = s.Failed()
+			}
+			if first := statement.Start.Line; first >= 1 && first <= len(p.Lines) {
+				p.Lines[first-1].Statement = s
+				s.Indent = p.Lines[first-1].Text[:statement.Start.Column-1]
+			}
+		}
+	}
+	return p
+}
+
+// hit records an evaluation of the named assertion which matched the statement
+func (s *reviewStatement) hit(assertion string, evaluated *policy.Result) {
+	var hit *reviewHit
+	for _, h := range s.Hits {
+		if h.Assertion == assertion {
+			hit = h
+		}
+	}
+	if hit == nil {
+		hit = &reviewHit{Assertion: assertion, Passed: true}
+		s.Hits = append(s.Hits, hit)
+	}
+	hit.Passed = hit.Passed && evaluated.Passed
+	for _, action := range hit.Actions {
+		if action == evaluated.Action {
+			return
+		}
+	}
+	hit.Actions = append(hit.Actions, evaluated.Action)
+}
@@ -0,0 +1,94 @@
+package report
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+const reviewTestPolicy = `{"Version": "2012-10-17", "Statement": [
+  {"Sid": "ReadWrite", "Effect": "Allow", "Action": ["s3:GetObject", "s3:PutObject"], "Resource": "*"},
+  {"Effect": "Deny", "Action": "s3:DeleteBucket", "Resource": "*"}]}`
+
+func TestNewReview(t *testing.T) {
+	results := testResults()
+	results[0].PolicyJSON = reviewTestPolicy
+	results[0].MaxLength = 100
+	results[0].Assertions[0].Results[0].MatchedStatements = []string{"ReadWrite"}
+
+	r := newReview(results)
+	reader := r.Policies[0]
+	if reader.Length != 191 || !reader.OverLimit() || reader.LengthPercent() != 100 {
+		t.Errorf("unexpected length %d of %d", reader.Length, reader.MaxLength)
+	}
+	if len(reader.Lines) != 19 || reader.Lines[0].Text != "{" || reader.Lines[3].Text != "    {" {
+		t.Fatalf("expected the pretty-printed policy, but got %d lines", len(reader.Lines))
+	}
+	readWrite := reader.Lines[3].Statement
+	if readWrite == nil || readWrite.Label != "ReadWrite" || readWrite.Indent != "    " || len(readWrite.Hits) != 2 {
+		t.Fatalf("expected the first statement to be annotated, but got %+v", readWrite)
+	}
+	if hit := readWrite.Hits[0]; hit.Assertion != "readers/Can read objects" || !hit.Passed || hit.Actions[0] != "s3:GetObject" {
+		t.Errorf("unexpected hit %+v", hit)
+	}
+	if hit := readWrite.Hits[1]; hit.Assertion != "Cannot write <objects>" || hit.Passed {
+		t.Errorf("unexpected hit %+v", hit)
+	}
+	if !reader.Lines[4].Failed || reader.Lines[12].Hit || reader.Lines[12].Statement == nil || reader.Lines[12].Statement.Label != "Statement[1]" {
+		t.Errorf("expected only the lines of the first statement to be marked")
+	}
+	if len(reader.Assertions) != 4 || reader.Assertions[0].Passed != 2 || len(reader.Results) != 3 {
+		t.Errorf("unexpected assertions %+v and results %+v", reader.Assertions, reader.Results)
+	}
+	if orphan := r.Policies[1]; len(orphan.Lines) != 0 || orphan.Error == "" {
+		t.Errorf("unexpected errored policy %+v", orphan)
+	}
+}
+
+func TestWriteHTML(t *testing.T) {
+	results := testResults()
+	results[0].PolicyJSON = reviewTestPolicy
+	output := &bytes.Buffer{}
+	if err := WriteHTML(output, results); err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{
+		`<h2><span class="badge ERROR">ERROR</span> policies/s3/reader</h2>`,
+		`no <code>max_length</code> configured`,
+		`// ReadWrite: <span class="badge FAIL">FAIL</span> Cannot write &lt;objects&gt; (s3:PutObject)`,
+		`<span class="line failed"><span class="number">4</span>    {</span>`,
+		`<td>Cannot write &lt;objects&gt;</td><td><span class="badge FAIL">FAIL</span></td><td>0 / 1</td>`,
+		`<td class="error">Throttling: Rate exceeded</td>`,
+		`<td><code>s3:PutObject</code></td><td><code>arn:aws:s3:::my-bucket/key</code></td><td>denied</td>`,
+		`No policy found for policies/orphan.assertions.yaml`,
+	} {
+		if !strings.Contains(output.String(), expected) {
+			t.Errorf("expected the report to contain %s, but got:\n%s", expected, output.String())
+		}
+	}
+	if strings.Contains(output.String(), "http") || strings.Contains(output.String(), "<script") {
+		t.Errorf("expected the report to have no external assets")
+	}
+}
+
+func TestWriteMarkdown(t *testing.T) {
+	results := testResults()
+	results[0].PolicyJSON = reviewTestPolicy
+	results[0].MaxLength = 6144
+	output := &bytes.Buffer{}
+	if err := WriteMarkdown(output, results); err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{
+		"## ⚠️ ERROR policies/s3/reader\n",
+		"191 of 6144 characters, excluding whitespace (3%)\n",
+		"```jsonc\n{\n  \"Version\": \"2012-10-17\",\n  \"Statement\": [\n    // ❌ FAIL ReadWrite matched by Cannot write <objects> (s3:PutObject)\n    {\n",
+		"| Cannot write &lt;objects&gt; | ❌ FAIL | 0 / 1 |  |\n",
+		"| readers/Can read objects | `s3:GetObjectAcl` | `arn:aws:s3:::my-bucket/key` | allowed | ✅ PASS allowed |  |\n",
+		"> **Error:** No policy found for policies/orphan.assertions.yaml\n",
+	} {
+		if !strings.Contains(output.String(), expected) {
+			t.Errorf("expected the report to contain %q, but got:\n%s", expected, output.String())
+		}
+	}
+}
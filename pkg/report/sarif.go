@@ -0,0 +1,230 @@
+package report
+
+import (
+	"encoding/json"
+	"io"
+	"strings"
+
+	"github.com/matt-deboer/assert-aws-iam-permissions/pkg/policy"
+	"github.com/matt-deboer/assert-aws-iam-permissions/pkg/runner"
+	"github.com/matt-deboer/assert-aws-iam-permissions/pkg/suite"
+	"github.com/matt-deboer/assert-aws-iam-permissions/pkg/types"
+	"github.com/matt-deboer/assert-aws-iam-permissions/pkg/version"
+)
+
+const (
+	sarifSchema  = "https://json.schemastore.org/sarif-2.1.0.json"
+	sarifVersion = "2.1.0"
+	toolURI      = "https://github.com/matt-deboer/assert-aws-iam-permissions"
+)
+
+// sarifRule describes a category of SARIF results; rule IDs are stable, so
+// that code scanning tools can track findings across runs
+type sarifRule struct {
+	ID               string        `json:"id"`
+	Name             string        `json:"name"`
+	ShortDescription *sarifMessage `json:"shortDescription"`
+	DefaultConfig    *sarifConfig  `json:"defaultConfiguration"`
+}
+
+type sarifConfig struct {
+	Level string `json:"level"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+var sarifRules = []*sarifRule{
+	newSARIFRule("AAIP001", "assertion-failed", "error", "A policy assertion failed"),
+	newSARIFRule("AAIP002", "assertion-error", "error", "A policy assertion could not be evaluated"),
+	newSARIFRule("AAIP003", policy.RulePrivilegeEscalation, "error", "The policy allows actions which can be used to escalate privileges"),
+	newSARIFRule("AAIP004", policy.RuleWildcardResource, "warning", "The policy allows actions other than reads on all resources"),
+	newSARIFRule("AAIP005", "policy-size-limit", "error", "The policy document exceeds its maximum expected length"),
+}
+
+func newSARIFRule(id, name, level, description string) *sarifRule {
+	return &sarifRule{ID: id, Name: name, ShortDescription: &sarifMessage{Text: description}, DefaultConfig: &sarifConfig{Level: level}}
+}
+
+type sarifLog struct {
+	Schema  string      `json:"$schema"`
+	Version string      `json:"version"`
+	Runs    []*sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    *sarifTool     `json:"tool"`
+	Results []*sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver *sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string       `json:"name"`
+	Version        string       `json:"version,omitempty"`
+	InformationURI string       `json:"informationUri"`
+	Rules          []*sarifRule `json:"rules"`
+}
+
+type sarifResult struct {
+	RuleID           string           `json:"ruleId"`
+	RuleIndex        int              `json:"ruleIndex"`
+	Level            string           `json:"level"`
+	Message          *sarifMessage    `json:"message"`
+	Locations        []*sarifLocation `json:"locations"`
+	RelatedLocations []*sarifLocation `json:"relatedLocations,omitempty"`
+}
+
+type sarifLocation struct {
+	ID               int                    `json:"id,omitempty"`
+	PhysicalLocation *sarifPhysicalLocation `json:"physicalLocation"`
+	Message          *sarifMessage          `json:"message,omitempty"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation *sarifArtifactLocation `json:"artifactLocation"`
+	Region           *sarifRegion           `json:"region,omitempty"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+type sarifRegion struct {
+	StartLine   int `json:"startLine"`
+	StartColumn int `json:"startColumn,omitempty"`
+}
+
+// WriteSARIF writes the failed and errored assertions of the results, along
+// with the findings of policy.LintPolicy and policy length violations, as a
+// SARIF 2.1.0 log. Results are located in the policy and assertion suite
+// files; policies given inline are located by the name of their input.
+func WriteSARIF(w io.Writer, results []*runner.TargetResult) error {
+	run := &sarifRun{
+		Tool: &sarifTool{Driver: &sarifDriver{
+			Name:           toolName(),
+			Version:        version.Version,
+			InformationURI: toolURI,
+			Rules:          sarifRules,
+		}},
+		Results: []*sarifResult{},
+	}
+	for _, result := range results {
+		run.Results = append(run.Results, sarifResults(result)...)
+	}
+	data, err := json.MarshalIndent(&sarifLog{Schema: sarifSchema, Version: sarifVersion, Runs: []*sarifRun{run}}, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
+
+func sarifResults(result *runner.TargetResult) []*sarifResult {
+	policyURI := result.Target.PolicyFile
+	if len(policyURI) == 0 {
+		policyURI = result.Target.Name
+	}
+	policyLocation := func(position policy.Position, message string) *sarifLocation {
+		location := newSARIFLocation(policyURI, position.Line, position.Column)
+		if len(message) > 0 {
+			location.Message = &sarifMessage{Text: message}
+		}
+		return location
+	}
+	// the statements of the policy locate matched statements and lint findings
+	statements := map[string]policy.Position{}
+	doc, _ := policy.ParseDocument(result.PolicyJSON)
+	if doc != nil {
+		for i, statement := range doc.Statement {
+			statements[statement.Label(i)] = statement.Start
+		}
+	}
+
+	sarif := []*sarifResult{}
+	if _, tooLong := result.Err.(*policy.LengthError); result.Err != nil && !tooLong {
+		location := policyLocation(policy.Position{Line: 1}, "")
+		if suiteErr, ok := result.Err.(*suite.Error); ok {
+			location = newSARIFLocation(suiteErr.File, suiteErr.Line, suiteErr.Column)
+		} else if len(result.Target.AssertionsFile) > 0 {
+			location = newSARIFLocation(result.Target.AssertionsFile, 1, 0)
+		}
+		sarif = append(sarif, newSARIFResult("assertion-error", result.Err.Error(), location))
+	}
+	for _, assertion := range result.Assertions {
+		location := assertionLocation(assertion.Assertion)
+		if location == nil {
+			location = policyLocation(policy.Position{Line: 1}, "")
+		}
+		if assertion.Err != nil {
+			sarif = append(sarif, newSARIFResult("assertion-error", assertion.Name()+": "+assertion.Err.Error(), location))
+		}
+		for _, evaluated := range assertion.Results {
+			if evaluated.Passed {
+				continue
+			}
+			failure := newSARIFResult("assertion-failed", evaluated.Message(), location)
+			for _, label := range evaluated.MatchedStatements {
+				// statements of other policies (e.g. resource policies) aren't located
+				if position, ok := statements[label]; ok {
+					related := policyLocation(position, "Matched statement "+label)
+					related.ID = len(failure.RelatedLocations) + 1
+					failure.RelatedLocations = append(failure.RelatedLocations, related)
+				}
+			}
+			sarif = append(sarif, failure)
+		}
+	}
+
+	if doc != nil && !result.Target.Trust {
+		findings, _ := policy.LintPolicy(result.PolicyJSON)
+		for _, finding := range findings {
+			sarif = append(sarif, newSARIFResult(finding.Rule, finding.Message, policyLocation(finding.Position, "")))
+		}
+	}
+	if result.MaxLength > 0 {
+		if err := policy.AssertPolicyLength(result.MaxLength, result.PolicyJSON); err != nil {
+			sarif = append(sarif, newSARIFResult("policy-size-limit", err.Error(), policyLocation(policy.Position{Line: 1}, "")))
+		}
+	}
+	return sarif
+}
+
+func assertionLocation(assertion *types.Assertion) *sarifLocation {
+	if assertion == nil || assertion.Location == nil {
+		return nil
+	}
+	return newSARIFLocation(assertion.Location.File, assertion.Location.Line, assertion.Location.Column)
+}
+
+func newSARIFLocation(uri string, line, column int) *sarifLocation {
+	if line < 1 {
+		line = 1
+	}
+	return &sarifLocation{PhysicalLocation: &sarifPhysicalLocation{
+		ArtifactLocation: &sarifArtifactLocation{URI: strings.TrimPrefix(uri, "./")},
+		Region:           &sarifRegion{StartLine: line, StartColumn: column},
+	}}
+}
+
+func newSARIFResult(ruleName, message string, location *sarifLocation) *sarifResult {
+	result := &sarifResult{Message: &sarifMessage{Text: message}, Locations: []*sarifLocation{location}}
+	for i, rule := range sarifRules {
+		if rule.Name == ruleName {
+			result.RuleID = rule.ID
+			result.RuleIndex = i
+			result.Level = rule.DefaultConfig.Level
+		}
+	}
+	return result
+}
+
+func toolName() string {
+	if len(version.Name) > 0 {
+		return version.Name
+	}
+	return "assert-aws-iam-permissions"
+}
@@ -0,0 +1,93 @@
+package report
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/matt-deboer/assert-aws-iam-permissions/pkg/suite"
+	"github.com/matt-deboer/assert-aws-iam-permissions/pkg/types"
+)
+
+const sarifTestPolicy = `{
+  "Version": "2012-10-17",
+  "Statement": [
+    {"Sid": "ReadWrite", "Effect": "Allow", "Action": ["s3:GetObject", "s3:PutObject"], "Resource": "*"}
+  ]
+}`
+
+func TestWriteSARIF(t *testing.T) {
+	results := testResults()
+	reader := results[0]
+	reader.Target.PolicyFile = "policies/s3/reader.json"
+	reader.PolicyJSON = sarifTestPolicy
+	reader.MaxLength = 50
+	reader.Assertions[1].Assertion.Location = &types.Location{File: "policies/s3/reader.assertions.yaml", Line: 12, Column: 5}
+	results[1].Err = &suite.Error{File: "policies/common.yaml", Line: 3, Column: 7, Message: "unknown key 'actions'"}
+
+	output := &bytes.Buffer{}
+	if err := WriteSARIF(output, results); err != nil {
+		t.Fatal(err)
+	}
+	var log struct {
+		Version string `json:"version"`
+		Runs    []struct {
+			Tool struct {
+				Driver struct {
+					Rules []struct {
+						ID   string `json:"id"`
+						Name string `json:"name"`
+					} `json:"rules"`
+				} `json:"driver"`
+			} `json:"tool"`
+			Results []struct {
+				RuleID    string `json:"ruleId"`
+				Level     string `json:"level"`
+				Message   struct{ Text string }
+				Locations []struct {
+					PhysicalLocation struct {
+						ArtifactLocation struct{ URI string }
+						Region           struct{ StartLine, StartColumn int }
+					}
+				}
+				RelatedLocations []struct {
+					PhysicalLocation struct {
+						Region struct{ StartLine int }
+					}
+				}
+			} `json:"results"`
+		} `json:"runs"`
+	}
+	if err := json.Unmarshal(output.Bytes(), &log); err != nil {
+		t.Fatal(err)
+	}
+	if log.Version != "2.1.0" || len(log.Runs) != 1 || len(log.Runs[0].Tool.Driver.Rules) != 5 {
+		t.Fatalf("unexpected SARIF log %s", output.String())
+	}
+
+	type located struct {
+		rule, level, uri string
+		line, column     int
+	}
+	expected := []located{
+		{"AAIP001", "error", "policies/s3/reader.assertions.yaml", 12, 5},
+		{"AAIP002", "error", "policies/s3/reader.json", 1, 0},
+		{"AAIP004", "warning", "policies/s3/reader.json", 4, 5},
+		{"AAIP005", "error", "policies/s3/reader.json", 1, 0},
+		{"AAIP002", "error", "policies/common.yaml", 3, 7},
+	}
+	sarifResults := log.Runs[0].Results
+	if len(sarifResults) != len(expected) {
+		t.Fatalf("expected %d results, but got %s", len(expected), output.String())
+	}
+	for i, result := range sarifResults {
+		location := result.Locations[0].PhysicalLocation
+		actual := located{result.RuleID, result.Level, location.ArtifactLocation.URI, location.Region.StartLine, location.Region.StartColumn}
+		if actual != expected[i] {
+			t.Errorf("expected result %+v, but got %+v", expected[i], actual)
+		}
+	}
+	if related := sarifResults[0].RelatedLocations; len(related) != 1 || related[0].PhysicalLocation.Region.StartLine != 4 {
+		t.Errorf("expected the matched statement as a related location, but got %+v", related)
+	}
+}
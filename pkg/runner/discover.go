@@ -0,0 +1,124 @@
+package runner
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// assertionsSuffixes are the suffixes of assertion suite files; the policy
+// evaluated by a suite file named x.assertions.yaml is x.json or x.policy.json
+var assertionsSuffixes = []string{".assertions.yaml", ".assertions.yml", ".assertions.json"}
+
+// trustSuffix marks trust policies (e.g. deployer.trust.json), whose
+// assertions are evaluated with the trust policy engine
+const trustSuffix = ".trust"
+
+// Target pairs a policy document with the suite file of its assertions
+type Target struct {
+	// Name is the path of the policy without its extension
+	Name       string
+	PolicyFile string
+	// PolicyJSON holds the policy document of targets whose policy isn't
+	// read from PolicyFile, such as those extracted from a terraform plan
+	PolicyJSON     string
+	AssertionsFile string
+	Trust          bool
+	// Resource marks resource policies (e.g. bucket policies), which are
+	// evaluated as the resource_policy of each assertion, on their own
+	Resource bool
+}
+
+// Discover finds the targets named by the patterns, in the manner of
+// 'go test' packages: a directory, a directory followed by '/...' to include
+// its subdirectories, or a single assertion suite file
+func Discover(patterns []string) ([]*Target, error) {
+	if len(patterns) == 0 {
+		patterns = []string{"."}
+	}
+	targets := []*Target{}
+	seen := map[string]bool{}
+	for _, pattern := range patterns {
+		files, err := suiteFiles(pattern)
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range files {
+			if !seen[file] {
+				seen[file] = true
+				targets = append(targets, newTarget(file))
+			}
+		}
+	}
+	return targets, nil
+}
+
+func suiteFiles(pattern string) ([]string, error) {
+	recursive := false
+	if pattern == "..." || strings.HasSuffix(pattern, "/...") {
+		recursive = true
+		pattern = strings.TrimSuffix(strings.TrimSuffix(pattern, "..."), "/")
+		if len(pattern) == 0 {
+			pattern = "."
+		}
+	}
+	info, err := os.Stat(pattern)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		if len(suiteBase(pattern)) == 0 {
+			return nil, fmt.Errorf("%s is not an assertion suite file; expected a name ending in %s",
+				pattern, strings.Join(assertionsSuffixes, ", "))
+		}
+		return []string{filepath.Clean(pattern)}, nil
+	}
+
+	files := []string{}
+	err = filepath.Walk(pattern, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if path != pattern && (!recursive || strings.HasPrefix(info.Name(), ".")) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if len(suiteBase(path)) > 0 {
+			files = append(files, path)
+		}
+		return nil
+	})
+	sort.Strings(files)
+	return files, err
+}
+
+// suiteBase returns the path of a suite file without its suffix, or an
+// empty string if the path is not a suite file
+func suiteBase(path string) string {
+	for _, suffix := range assertionsSuffixes {
+		if strings.HasSuffix(path, suffix) && len(path) > len(suffix) {
+			return strings.TrimSuffix(path, suffix)
+		}
+	}
+	return ""
+}
+
+func newTarget(assertionsFile string) *Target {
+	base := suiteBase(assertionsFile)
+	target := &Target{
+		Name:           base,
+		AssertionsFile: assertionsFile,
+		Trust:          strings.HasSuffix(base, trustSuffix),
+	}
+	for _, candidate := range []string{base + ".json", base + ".policy.json"} {
+		if info, err := os.Stat(candidate); err == nil && !info.IsDir() {
+			target.PolicyFile = candidate
+			break
+		}
+	}
+	return target
+}
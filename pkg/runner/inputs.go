@@ -0,0 +1,46 @@
+package runner
+
+import (
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/service/iam/iamiface"
+	"github.com/matt-deboer/assert-aws-iam-permissions/pkg/policy"
+	"github.com/matt-deboer/assert-aws-iam-permissions/pkg/types"
+)
+
+// RunInputs evaluates the assertions of the inputs of the main command: against
+// the trust policy with the local engine when one is given, and otherwise
+// against the principal's policies or the policy document, using the policy
+// simulator when iamSvc is provided, and the local engine when it is nil.
+// The inputs are expected to have been interpolated and checked already.
+func RunInputs(inputs *types.Inputs, iamSvc iamiface.IAMAPI) *TargetResult {
+	var result *TargetResult
+	switch {
+	case len(inputs.TrustPolicyJSON) > 0:
+		result = RunAssertions(&Target{Name: "trust_policy_json", Trust: true}, inputs.TrustPolicyJSON, inputs.Assertions,
+			func(assertions []*types.Assertion) ([]*policy.Result, error) {
+				return policy.EvaluateTrustPolicy(assertions, inputs.TrustPolicyJSON)
+			})
+		result.Engine = EngineLocal
+	case len(inputs.PrincipalArn) > 0:
+		result = RunAssertions(&Target{Name: inputs.PrincipalArn}, inputs.PolicyJSON, inputs.Assertions,
+			func(assertions []*types.Assertion) ([]*policy.Result, error) {
+				if iamSvc == nil {
+					return nil, fmt.Errorf("The policies of %s can only be evaluated by the policy simulator", inputs.PrincipalArn)
+				}
+				return policy.EvaluatePrincipalPolicies(iamSvc, inputs.PrincipalArn, assertions, inputs.PolicyJSON)
+			})
+		result.Engine = EngineSimulator
+	default:
+		result = RunAssertions(&Target{Name: "policy_json"}, inputs.PolicyJSON, inputs.Assertions,
+			func(assertions []*types.Assertion) ([]*policy.Result, error) {
+				return policy.EvaluatePolicies(iamSvc, assertions, []string{inputs.PolicyJSON})
+			})
+		result.Engine = EngineSimulator
+		if iamSvc == nil {
+			result.Engine = EngineLocal
+		}
+	}
+	result.MaxLength = inputs.MaxLength
+	return result
+}
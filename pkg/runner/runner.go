@@ -0,0 +1,313 @@
+package runner
+
+import (
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/iam/iamiface"
+	"github.com/matt-deboer/assert-aws-iam-permissions/pkg/policy"
+	"github.com/matt-deboer/assert-aws-iam-permissions/pkg/suite"
+	"github.com/matt-deboer/assert-aws-iam-permissions/pkg/types"
+)
+
+// Statuses of an assertion or target
+const (
+	Pass = "PASS"
+	Fail = "FAIL"
+	// Skip marks assertions excluded by the --run or --tags filters
+	Skip = "SKIP"
+	// Error marks assertions which could not be evaluated, and targets whose
+	// policy or suite file could not be loaded
+	Error = "ERROR"
+)
+
+// Engines evaluating assertions
+const (
+	// EngineSimulator is the IAM policy simulator API
+	EngineSimulator = "simulator"
+	// EngineLocal is the local evaluation engine, which also evaluates trust policies
+	EngineLocal = "local"
+)
+
+// Options control which assertions are run, and how
+type Options struct {
+	// Run selects the assertions whose comments it matches, when set
+	Run  *regexp.Regexp
+	Tags *TagFilter
+	// FailFast stops the run at the first failed or errored assertion
+	FailFast bool
+	// IAM is used to run the policy simulator; when nil, the local engine is used
+	IAM  iamiface.IAMAPI
+	Vars map[string]string
+	// MaxLength is the maximum expected length of each policy (see
+	// policy.AssertPolicyLength); longer policies are errored
+	MaxLength int
+	// Context holds context entries given to the assertions evaluated by the
+	// local engine, except those which set the same keys themselves
+	Context map[string]*types.ContextEntryValue
+}
+
+// TagFilter selects assertions having any of the included tags (or any
+// assertion, when none are included) and none of the excluded tags
+type TagFilter struct {
+	Include []string
+	Exclude []string
+}
+
+// ParseTagFilter parses a comma-separated list of tags, where tags prefixed
+// by '!' are excluded
+func ParseTagFilter(tags string) *TagFilter {
+	filter := &TagFilter{}
+	for _, tag := range strings.Split(tags, ",") {
+		tag = strings.TrimSpace(tag)
+		if strings.HasPrefix(tag, "!") {
+			filter.Exclude = append(filter.Exclude, strings.TrimPrefix(tag, "!"))
+		} else if len(tag) > 0 {
+			filter.Include = append(filter.Include, tag)
+		}
+	}
+	return filter
+}
+
+func (f *TagFilter) selects(assertion *types.Assertion) bool {
+	tagged := func(tags []string) bool {
+		for _, tag := range tags {
+			for _, assertionTag := range assertion.Tags {
+				if tag == assertionTag {
+					return true
+				}
+			}
+		}
+		return false
+	}
+	return (len(f.Include) == 0 || tagged(f.Include)) && !tagged(f.Exclude)
+}
+
+// AssertionResult is the outcome of one assertion of a target's suite
+type AssertionResult struct {
+	Suite     string
+	Assertion *types.Assertion
+	// Label identifies the assertion in output, by its comment or else its position
+	Label    string
+	Status   string
+	Results  []*policy.Result
+	Err      error
+	Duration time.Duration
+}
+
+// TargetResult is the outcome of the assertions of a target
+type TargetResult struct {
+	Target     *Target
+	PolicyJSON string
+	// MaxLength is the maximum expected length of the policy, if any
+	MaxLength int
+	// Engine names the engine which evaluated the assertions
+	Engine     string
+	Assertions []*AssertionResult
+	// Err is set when the target's policy or suite file could not be loaded
+	Err      error
+	Duration time.Duration
+}
+
+// Status summarizes the statuses of the target's assertions
+func (t *TargetResult) Status() string {
+	if t.Err != nil {
+		return Error
+	}
+	status := Skip
+	for _, assertion := range t.Assertions {
+		switch assertion.Status {
+		case Error:
+			return Error
+		case Fail:
+			status = Fail
+		case Pass:
+			if status == Skip {
+				status = Pass
+			}
+		}
+	}
+	return status
+}
+
+// Summary counts the assertions of a run by status; targets which could not
+// be loaded are counted as errored
+type Summary struct {
+	Passed  int
+	Failed  int
+	Skipped int
+	Errored int
+}
+
+// Ok reports whether nothing failed or errored
+func (s *Summary) Ok() bool {
+	return s.Failed == 0 && s.Errored == 0
+}
+
+// Summarize counts the assertions of the results by status
+func Summarize(results []*TargetResult) *Summary {
+	summary := &Summary{}
+	for _, result := range results {
+		if result.Err != nil {
+			summary.Errored++
+		}
+		for _, assertion := range result.Assertions {
+			switch assertion.Status {
+			case Pass:
+				summary.Passed++
+			case Fail:
+				summary.Failed++
+			case Skip:
+				summary.Skipped++
+			case Error:
+				summary.Errored++
+			}
+		}
+	}
+	return summary
+}
+
+// Run evaluates the suite of each target against its policy; with
+// FailFast, the run ends after the first target with a failed or errored
+// assertion, whose remaining assertions are not run
+func Run(targets []*Target, options *Options) []*TargetResult {
+	results := []*TargetResult{}
+	for _, target := range targets {
+		result := runTarget(target, options)
+		results = append(results, result)
+		if options.FailFast && (result.Status() == Fail || result.Status() == Error) {
+			break
+		}
+	}
+	return results
+}
+
+// EvaluateFunc evaluates assertions against the policies of a target
+type EvaluateFunc func(assertions []*types.Assertion) ([]*policy.Result, error)
+
+// RunAssertions evaluates each of the assertions with evaluate, for callers
+// which load the policies and assertions of a target themselves
+func RunAssertions(target *Target, policyJSON string, assertions []*types.Assertion, evaluate EvaluateFunc) *TargetResult {
+	start := time.Now()
+	result := &TargetResult{Target: target, PolicyJSON: policyJSON}
+	for i, assertion := range assertions {
+		assertionResult := &AssertionResult{Assertion: assertion, Label: label(assertion, i)}
+		assertionResult.evaluate(evaluate)
+		result.Assertions = append(result.Assertions, assertionResult)
+	}
+	result.Duration = time.Since(start)
+	return result
+}
+
+func runTarget(target *Target, options *Options) *TargetResult {
+	start := time.Now()
+	result := &TargetResult{Target: target, MaxLength: options.MaxLength, Engine: EngineLocal}
+	if options.IAM != nil && !target.Trust && !target.Resource {
+		result.Engine = EngineSimulator
+	}
+	defer func() { result.Duration = time.Since(start) }()
+
+	suites, err := load(target, options.Vars, result)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	if result.MaxLength > 0 {
+		if err = policy.AssertPolicyLength(result.MaxLength, result.PolicyJSON); err != nil {
+			result.Err = err
+			return result
+		}
+	}
+	evaluate := func(assertions []*types.Assertion) ([]*policy.Result, error) {
+		if result.Engine == EngineLocal {
+			assertions = policy.WithContext(assertions, options.Context)
+		}
+		if target.Trust {
+			return policy.EvaluateTrustPolicy(assertions, result.PolicyJSON)
+		}
+		if target.Resource {
+			resourceAssertions := []*types.Assertion{}
+			for _, assertion := range assertions {
+				resourceAssertion := *assertion
+				resourceAssertion.ResourcePolicy = result.PolicyJSON
+				resourceAssertions = append(resourceAssertions, &resourceAssertion)
+			}
+			return policy.EvaluatePolicies(nil, resourceAssertions, nil)
+		}
+		return policy.EvaluatePolicies(options.IAM, assertions, []string{result.PolicyJSON})
+	}
+	for _, s := range suites {
+		for i, assertion := range s.Assertions {
+			assertionResult := &AssertionResult{Suite: s.Name, Assertion: assertion, Label: label(assertion, i)}
+			result.Assertions = append(result.Assertions, assertionResult)
+			if !options.selects(assertion) {
+				assertionResult.Status = Skip
+				continue
+			}
+			assertionResult.evaluate(evaluate)
+			if options.FailFast && assertionResult.Status != Pass {
+				return result
+			}
+		}
+	}
+	return result
+}
+
+func load(target *Target, vars map[string]string, result *TargetResult) ([]*suite.Suite, error) {
+	if len(target.PolicyJSON) > 0 {
+		result.PolicyJSON = target.PolicyJSON
+	} else if len(target.PolicyFile) == 0 {
+		return nil, fmt.Errorf("No policy found for %s; expected %s.json or %s.policy.json",
+			target.AssertionsFile, target.Name, target.Name)
+	} else {
+		data, err := ioutil.ReadFile(target.PolicyFile)
+		if err != nil {
+			return nil, err
+		}
+		if result.PolicyJSON, err = policy.Interpolate(string(data), vars); err != nil {
+			return nil, fmt.Errorf("%s: %v", target.PolicyFile, err)
+		}
+	}
+	suites, err := suite.Load(target.AssertionsFile)
+	if err != nil {
+		return nil, err
+	}
+	if err = policy.InterpolateAssertions(suite.Assertions(suites), vars); err != nil {
+		return nil, fmt.Errorf("%s: %v", target.AssertionsFile, err)
+	}
+	return suites, nil
+}
+
+func (o *Options) selects(assertion *types.Assertion) bool {
+	if o.Run != nil && !o.Run.MatchString(assertion.Comment) {
+		return false
+	}
+	return o.Tags == nil || o.Tags.selects(assertion)
+}
+
+func (a *AssertionResult) evaluate(evaluate EvaluateFunc) {
+	start := time.Now()
+	defer func() { a.Duration = time.Since(start) }()
+
+	a.Results, a.Err = evaluate([]*types.Assertion{a.Assertion})
+	if a.Err != nil {
+		a.Status = Error
+		return
+	}
+	a.Status = Pass
+	for _, result := range a.Results {
+		if !result.Passed {
+			a.Status = Fail
+		}
+	}
+}
+
+func label(assertion *types.Assertion, index int) string {
+	if len(assertion.Comment) > 0 {
+		return assertion.Comment
+	}
+	return fmt.Sprintf("Assertion[%d]", index)
+}
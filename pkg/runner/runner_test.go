@@ -0,0 +1,161 @@
+package runner
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+const readerPolicy = `{
+	"Version": "2012-10-17",
+	"Statement": [
+		{"Sid": "Read", "Effect": "Allow", "Action": "s3:GetObject", "Resource": "arn:aws:s3:::{{env}}-bucket/*"}
+	]
+}`
+
+const readerAssertions = `
+assertions:
+  - comment: Can read objects
+    tags: [smoke]
+    action_names: [s3:GetObject]
+    resource_arns: ["arn:aws:s3:::{{env}}-bucket/key"]
+    expected_result: allowed
+  - comment: Can delete objects
+    action_names: [s3:DeleteObject]
+    resource_arns: ["arn:aws:s3:::{{env}}-bucket/key"]
+    expected_result: allowed
+  - comment: Cannot write objects
+    tags: [slow]
+    action_names: [s3:PutObject]
+    resource_arns: ["arn:aws:s3:::{{env}}-bucket/key"]
+    expected_result: denied
+`
+
+const deployerTrust = `{
+	"Version": "2012-10-17",
+	"Statement": {"Effect": "Allow", "Principal": {"Service": "ec2.amazonaws.com"}, "Action": "sts:AssumeRole"}
+}`
+
+const deployerAssertions = `[
+	{"comment": "EC2 can assume the role", "principals": {"Service": ["ec2.amazonaws.com"]},
+	 "action_names": ["sts:AssumeRole"], "expected_result": "allowed"}
+]`
+
+func writeTree(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "policies")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range map[string]string{
+		"s3/reader.json":                      readerPolicy,
+		"s3/reader.assertions.yaml":           readerAssertions,
+		"iam/deployer.trust.policy.json":      deployerTrust,
+		"iam/deployer.trust.assertions.json":  deployerAssertions,
+		"orphan/missing.assertions.yml":       "assertions: []\n",
+		".hidden/ignored.assertions.yaml":     "assertions: []\n",
+		"s3/reader-notes.md":                  "not a suite",
+		"iam/nested/broken.policy.json":       readerPolicy,
+		"iam/nested/broken.assertions.json":   `[{"comment": "oops" "expected_result": "allowed"}]`,
+		"iam/nested/.gitkeep":                 "",
+		"iam/nested/unrelated.assertions.txt": "",
+	} {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestDiscover(t *testing.T) {
+	dir := writeTree(t)
+	defer os.RemoveAll(dir)
+
+	targets, err := Discover([]string{dir + "/..."})
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := []string{}
+	for _, target := range targets {
+		names = append(names, strings.TrimPrefix(target.Name, dir+"/"))
+	}
+	if expected := "iam/deployer.trust,iam/nested/broken,orphan/missing,s3/reader"; strings.Join(names, ",") != expected {
+		t.Fatalf("expected targets %s, but got %s", expected, strings.Join(names, ","))
+	}
+	if !targets[0].Trust || targets[0].PolicyFile != filepath.Join(dir, "iam/deployer.trust.policy.json") {
+		t.Errorf("unexpected trust target %+v", targets[0])
+	}
+	if len(targets[2].PolicyFile) > 0 || targets[3].PolicyFile != filepath.Join(dir, "s3/reader.json") {
+		t.Errorf("unexpected policy files %+v, %+v", targets[2], targets[3])
+	}
+
+	if targets, err = Discover([]string{filepath.Join(dir, "iam")}); err != nil || len(targets) != 1 {
+		t.Errorf("expected only the suites directly within the directory, but got %v, %v", targets, err)
+	}
+}
+
+func TestRun(t *testing.T) {
+	dir := writeTree(t)
+	defer os.RemoveAll(dir)
+	targets, err := Discover([]string{dir + "/..."})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	options := &Options{Vars: map[string]string{"env": "prod"}, Tags: ParseTagFilter("!slow")}
+	results := Run(targets, options)
+	if len(results) != 4 {
+		t.Fatalf("expected a result per target, but got %d", len(results))
+	}
+	statuses := []string{}
+	for _, result := range results {
+		statuses = append(statuses, result.Status())
+	}
+	if expected := "PASS,ERROR,ERROR,FAIL"; strings.Join(statuses, ",") != expected {
+		t.Errorf("expected target statuses %s, but got %s", expected, strings.Join(statuses, ","))
+	}
+	reader := results[3]
+	if reader.Assertions[0].Status != Pass || reader.Assertions[1].Status != Fail || reader.Assertions[2].Status != Skip {
+		t.Errorf("unexpected assertion results %+v", reader.Assertions)
+	}
+	if summary := Summarize(results); *summary != (Summary{Passed: 2, Failed: 1, Skipped: 1, Errored: 2}) {
+		t.Errorf("unexpected summary %+v", summary)
+	}
+
+	output := &bytes.Buffer{}
+	Write(output, results, false)
+	for _, expected := range []string{
+		"ok  \t" + filepath.Join(dir, "iam/deployer.trust") + "\t",
+		"--- ERROR: " + filepath.Join(dir, "orphan/missing"),
+		"    No policy found for " + filepath.Join(dir, "orphan/missing.assertions.yml"),
+		"    --- FAIL: Can delete objects (",
+		"        [POLICY ASSERTION FAILED] Can delete objects ( for s3:DeleteObject [ arn:aws:s3:::prod-bucket/key ]",
+		"FAIL\t" + filepath.Join(dir, "s3/reader") + "\t",
+		"FAIL\n2 passed, 1 failed, 1 skipped, 2 errored\n",
+	} {
+		if !strings.Contains(output.String(), expected) {
+			t.Errorf("expected the output to contain %q, but got:\n%s", expected, output.String())
+		}
+	}
+	if strings.Contains(output.String(), "Can read objects") {
+		t.Errorf("expected passing assertions to be omitted without verbose output:\n%s", output.String())
+	}
+
+	options = &Options{Vars: options.Vars, Run: regexp.MustCompile("objects$"), Tags: ParseTagFilter("smoke"), FailFast: true}
+	results = Run(targets[3:], options)
+	if summary := Summarize(results); *summary != (Summary{Passed: 1, Skipped: 2}) {
+		t.Errorf("expected only the smoke assertion to run, but got %+v", summary)
+	}
+
+	options = &Options{Vars: options.Vars, FailFast: true}
+	if results = Run(targets, options); len(results) != 2 {
+		t.Errorf("expected the run to stop at the first errored target, but got %d results", len(results))
+	}
+}
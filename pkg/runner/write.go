@@ -0,0 +1,72 @@
+package runner
+
+import (
+	"fmt"
+	"io"
+	"time"
+)
+
+// Name identifies the assertion within its target, prefixed by the name of
+// its suite
+func (a *AssertionResult) Name() string {
+	if len(a.Suite) > 0 {
+		return a.Suite + "/" + a.Label
+	}
+	return a.Label
+}
+
+// Write prints the results in the manner of 'go test': the failed and
+// errored assertions of each target (or, when verbose, every assertion),
+// a status line per target, and the summary counts
+func Write(w io.Writer, results []*TargetResult, verbose bool) {
+	for _, result := range results {
+		status := result.Status()
+		if result.Err != nil {
+			fmt.Fprintf(w, "--- %s: %s (%s)\n", Error, result.Target.Name, seconds(result.Duration))
+			fmt.Fprintf(w, "    %v\n", result.Err)
+		} else if verbose || status == Fail || status == Error {
+			fmt.Fprintf(w, "--- %s: %s (%s)\n", status, result.Target.Name, seconds(result.Duration))
+			for _, assertion := range result.Assertions {
+				if verbose || assertion.Status == Fail || assertion.Status == Error {
+					assertion.write(w)
+				}
+			}
+		}
+		switch status {
+		case Pass:
+			fmt.Fprintf(w, "ok  \t%s\t%s\n", result.Target.Name, seconds(result.Duration))
+		case Skip:
+			fmt.Fprintf(w, "?   \t%s\t[no assertions to run]\n", result.Target.Name)
+		default:
+			fmt.Fprintf(w, "%s\t%s\t%s\n", Fail, result.Target.Name, seconds(result.Duration))
+		}
+	}
+	summary := Summarize(results)
+	if summary.Ok() {
+		fmt.Fprintln(w, Pass)
+	} else {
+		fmt.Fprintln(w, Fail)
+	}
+	fmt.Fprintf(w, "%d passed, %d failed, %d skipped, %d errored\n",
+		summary.Passed, summary.Failed, summary.Skipped, summary.Errored)
+}
+
+func (a *AssertionResult) write(w io.Writer) {
+	if a.Status == Skip {
+		fmt.Fprintf(w, "    --- %s: %s\n", a.Status, a.Name())
+		return
+	}
+	fmt.Fprintf(w, "    --- %s: %s (%s)\n", a.Status, a.Name(), seconds(a.Duration))
+	if a.Err != nil {
+		fmt.Fprintf(w, "        %v\n", a.Err)
+	}
+	for _, result := range a.Results {
+		if !result.Passed {
+			fmt.Fprintf(w, "        %s\n", result.Message())
+		}
+	}
+}
+
+func seconds(d time.Duration) string {
+	return fmt.Sprintf("%.3fs", d.Seconds())
+}
@@ -0,0 +1,207 @@
+package server
+
+import (
+	"container/list"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/aws/aws-sdk-go/service/iam/iamiface"
+	"github.com/matt-deboer/assert-aws-iam-permissions/pkg/metrics"
+	"github.com/matt-deboer/assert-aws-iam-permissions/pkg/policy"
+	"github.com/matt-deboer/assert-aws-iam-permissions/pkg/runner"
+)
+
+// serverMetrics are the metrics of a server, each labeled by the engine
+// evaluating assertions
+type serverMetrics struct {
+	registry *metrics.Registry
+
+	assertionsEvaluated *metrics.Counter
+	assertionsPassed    *metrics.Counter
+	assertionsFailed    *metrics.Counter
+	simulatorCalls      *metrics.Counter
+	simulatorErrors     *metrics.Counter
+	simulatorThrottles  *metrics.Counter
+	cacheHits           *metrics.Counter
+	cacheMisses         *metrics.Counter
+	simulationSeconds   *metrics.Histogram
+	policyLength        *metrics.Histogram
+}
+
+func newServerMetrics() *serverMetrics {
+	r := metrics.NewRegistry()
+	return &serverMetrics{
+		registry: r,
+		assertionsEvaluated: r.NewCounter("aaip_assertions_evaluated_total",
+			"Assertions evaluated, by expected result", "engine", "expected_result"),
+		assertionsPassed: r.NewCounter("aaip_assertions_passed_total",
+			"Assertions passed, by expected result", "engine", "expected_result"),
+		assertionsFailed: r.NewCounter("aaip_assertions_failed_total",
+			"Assertions failed, by expected result", "engine", "expected_result"),
+		simulatorCalls: r.NewCounter("aaip_simulator_calls_total",
+			"Calls to the IAM policy simulator API, by operation", "engine", "operation"),
+		simulatorErrors: r.NewCounter("aaip_simulator_errors_total",
+			"Failed calls to the IAM policy simulator API, by operation and AWS error code", "engine", "operation", "code"),
+		simulatorThrottles: r.NewCounter("aaip_simulator_throttles_total",
+			"Throttled requests to the IAM policy simulator API, including those retried, by operation", "engine", "operation"),
+		cacheHits: r.NewCounter("aaip_simulation_cache_hits_total",
+			"Simulations answered from the cache of simulator responses", "engine"),
+		cacheMisses: r.NewCounter("aaip_simulation_cache_misses_total",
+			"Simulations not found in the cache of simulator responses", "engine"),
+		simulationSeconds: r.NewHistogram("aaip_simulation_duration_seconds",
+			"The time taken to evaluate each assertion",
+			[]float64{.001, .005, .01, .05, .1, .25, .5, 1, 2.5, 5, 10}, "engine"),
+		policyLength: r.NewHistogram("aaip_policy_length_characters",
+			"The length of the evaluated policy documents, excluding whitespace",
+			[]float64{256, 512, 1024, 2048, 4096, 6144, 10240, 20480}, "engine"),
+	}
+}
+
+// observe counts the assertions of a result, their durations and the length
+// of its policy
+func (m *serverMetrics) observe(result *runner.TargetResult) {
+	if len(result.PolicyJSON) > 0 {
+		m.policyLength.Observe(float64(policy.PolicyLength(result.PolicyJSON)), result.Engine)
+	}
+	for _, assertion := range result.Assertions {
+		if assertion.Status == runner.Skip {
+			continue
+		}
+		expected := expectedResultLabel(assertion.Assertion.ExpectedResult)
+		m.assertionsEvaluated.Inc(result.Engine, expected)
+		switch assertion.Status {
+		case runner.Pass:
+			m.assertionsPassed.Inc(result.Engine, expected)
+		case runner.Fail:
+			m.assertionsFailed.Inc(result.Engine, expected)
+		}
+		m.simulationSeconds.Observe(assertion.Duration.Seconds(), result.Engine)
+	}
+}
+
+// expectedResultLabel returns the label of an assertion's expected result;
+// since it is given by clients, unknown results are counted as "other"
+// rather than labeling a series of their own
+func expectedResultLabel(expectedResult string) string {
+	switch expectedResult {
+	case policy.Allowed, policy.ExplicitDeny, policy.ImplicitDeny:
+		return expectedResult
+	case "deny", "denied":
+		return "deny"
+	}
+	return "other"
+}
+
+// simulator wraps the IAM client of a server, counting the calls to the
+// policy simulator and caching the responses of SimulateCustomPolicy, which
+// depend only on their input; those of SimulatePrincipalPolicy depend on the
+// principal's policies, and aren't cached
+type simulator struct {
+	iamiface.IAMAPI
+	metrics *serverMetrics
+	// cache is nil when responses aren't cached
+	cache *responseCache
+}
+
+func newSimulator(iamSvc iamiface.IAMAPI, m *serverMetrics, cacheSize int) *simulator {
+	s := &simulator{IAMAPI: iamSvc, metrics: m}
+	if cacheSize > 0 {
+		s.cache = newResponseCache(cacheSize)
+	}
+	// throttled requests are retried by the client, so are counted as they're retried
+	if client, ok := iamSvc.(*iam.IAM); ok {
+		client.Handlers.Retry.PushBack(func(r *request.Request) {
+			if request.IsErrorThrottle(r.Error) {
+				m.simulatorThrottles.Inc(runner.EngineSimulator, r.Operation.Name)
+			}
+		})
+	}
+	return s
+}
+
+func (s *simulator) SimulateCustomPolicy(input *iam.SimulateCustomPolicyInput) (*iam.SimulatePolicyResponse, error) {
+	if s.cache == nil {
+		return s.call("SimulateCustomPolicy", func() (*iam.SimulatePolicyResponse, error) {
+			return s.IAMAPI.SimulateCustomPolicy(input)
+		})
+	}
+	key := policy.SimulationKey(input)
+	if response, ok := s.cache.get(key); ok {
+		s.metrics.cacheHits.Inc(runner.EngineSimulator)
+		return response, nil
+	}
+	s.metrics.cacheMisses.Inc(runner.EngineSimulator)
+	response, err := s.call("SimulateCustomPolicy", func() (*iam.SimulatePolicyResponse, error) {
+		return s.IAMAPI.SimulateCustomPolicy(input)
+	})
+	if err == nil {
+		s.cache.put(key, response)
+	}
+	return response, err
+}
+
+func (s *simulator) SimulatePrincipalPolicy(input *iam.SimulatePrincipalPolicyInput) (*iam.SimulatePolicyResponse, error) {
+	return s.call("SimulatePrincipalPolicy", func() (*iam.SimulatePolicyResponse, error) {
+		return s.IAMAPI.SimulatePrincipalPolicy(input)
+	})
+}
+
+func (s *simulator) call(operation string, simulate func() (*iam.SimulatePolicyResponse, error)) (*iam.SimulatePolicyResponse, error) {
+	s.metrics.simulatorCalls.Inc(runner.EngineSimulator, operation)
+	response, err := simulate()
+	if err != nil {
+		code := "Unknown"
+		if awsErr, ok := err.(awserr.Error); ok {
+			code = awsErr.Code()
+		}
+		s.metrics.simulatorErrors.Inc(runner.EngineSimulator, operation, code)
+	}
+	return response, err
+}
+
+// responseCache holds the most recently used simulator responses, by the
+// key of their input
+type responseCache struct {
+	mu       sync.Mutex
+	capacity int
+	order    *list.List
+	entries  map[string]*list.Element
+}
+
+type cacheEntry struct {
+	key      string
+	response *iam.SimulatePolicyResponse
+}
+
+func newResponseCache(capacity int) *responseCache {
+	return &responseCache{capacity: capacity, order: list.New(), entries: map[string]*list.Element{}}
+}
+
+func (c *responseCache) get(key string) (*iam.SimulatePolicyResponse, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	element, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(element)
+	return element.Value.(*cacheEntry).response, true
+}
+
+func (c *responseCache) put(key string, response *iam.SimulatePolicyResponse) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if element, ok := c.entries[key]; ok {
+		element.Value.(*cacheEntry).response = response
+		c.order.MoveToFront(element)
+		return
+	}
+	c.entries[key] = c.order.PushFront(&cacheEntry{key: key, response: response})
+	if c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).key)
+	}
+}
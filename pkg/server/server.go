@@ -0,0 +1,252 @@
+// Package server serves the evaluation of assertions over HTTP
+package server // import "github.com/matt-deboer/assert-aws-iam-permissions/pkg/server"
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/aws/aws-sdk-go/service/iam/iamiface"
+	"github.com/matt-deboer/assert-aws-iam-permissions/pkg/policy"
+	"github.com/matt-deboer/assert-aws-iam-permissions/pkg/report"
+	"github.com/matt-deboer/assert-aws-iam-permissions/pkg/runner"
+	"github.com/matt-deboer/assert-aws-iam-permissions/pkg/types"
+	"github.com/matt-deboer/assert-aws-iam-permissions/pkg/version"
+	log "github.com/sirupsen/logrus"
+)
+
+// maxRequestBytes limits the size of request bodies, which hold policy
+// documents of at most a few kilobytes, and their assertions
+const maxRequestBytes = 1 << 20
+
+// Server handles the requests of the assertion API:
+//
+// POST /v1/assert evaluates the assertions of the inputs (as read from stdin
+// by the main command), responding with the JSON results document of
+// docs/results.schema.json; POST /v1/validate checks the inputs without
+// evaluating them; GET /healthz and GET /version report the server's health
+// and version; GET /metrics exposes the server's metrics to Prometheus.
+type Server struct {
+	// Context holds context entries given to the assertions evaluated by the
+	// local engine, except those which set the same keys themselves
+	Context map[string]*types.ContextEntryValue
+
+	iam     iamiface.IAMAPI
+	mux     *http.ServeMux
+	metrics *serverMetrics
+}
+
+// New creates a server evaluating assertions with the policy simulator, using
+// the one client iamSvc for every request, or with the local engine when
+// iamSvc is nil; the responses of up to cacheSize simulations are cached
+func New(iamSvc iamiface.IAMAPI, cacheSize int) *Server {
+	s := &Server{mux: http.NewServeMux(), metrics: newServerMetrics()}
+	if iamSvc != nil {
+		s.iam = newSimulator(iamSvc, s.metrics, cacheSize)
+	}
+	s.mux.HandleFunc("/v1/assert", s.handle(http.MethodPost, s.assert))
+	s.mux.HandleFunc("/v1/validate", s.handle(http.MethodPost, s.validate))
+	s.mux.HandleFunc("/healthz", s.handle(http.MethodGet, s.healthz))
+	s.mux.HandleFunc("/version", s.handle(http.MethodGet, s.version))
+	s.mux.Handle("/metrics", s.metrics.registry)
+	return s
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// httpError is an error with the status code of its response
+type httpError struct {
+	Status  int
+	Message string
+}
+
+func (e *httpError) Error() string {
+	return e.Message
+}
+
+func badRequest(format string, args ...interface{}) error {
+	return &httpError{Status: http.StatusBadRequest, Message: fmt.Sprintf(format, args...)}
+}
+
+// handle adapts a handler returning the value of its JSON response, or an
+// error, to requests of the given method
+func (s *Server) handle(method string, handler func(r *http.Request) (interface{}, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != method {
+			w.Header().Set("Allow", method)
+			writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "Method not allowed; expected " + method})
+			return
+		}
+		response, err := handler(r)
+		if err != nil {
+			status := http.StatusInternalServerError
+			if e, ok := err.(*httpError); ok {
+				status = e.Status
+			}
+			log.Debugf("%s %s: %d %v", r.Method, r.URL.Path, status, err)
+			writeJSON(w, status, map[string]string{"error": err.Error()})
+			return
+		}
+		writeJSON(w, http.StatusOK, response)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(value); err != nil {
+		log.Warnf("Failed to write response; %v", err)
+	}
+}
+
+// readInputs decodes the inputs of a request, with their variables interpolated
+func readInputs(r *http.Request) (*types.Inputs, error) {
+	var inputs types.Inputs
+	decoder := json.NewDecoder(http.MaxBytesReader(nil, r.Body, maxRequestBytes))
+	if err := decoder.Decode(&inputs); err != nil {
+		return nil, badRequest("Invalid inputs; %v", err)
+	}
+	for _, value := range []*string{&inputs.PolicyJSON, &inputs.TrustPolicyJSON, &inputs.PrincipalArn} {
+		interpolated, err := policy.Interpolate(*value, inputs.Vars)
+		if err != nil {
+			return nil, badRequest("%v", err)
+		}
+		*value = interpolated
+	}
+	if err := policy.InterpolateAssertions(inputs.Assertions, inputs.Vars); err != nil {
+		return nil, badRequest("%v", err)
+	}
+	if len(inputs.Assertions) == 0 {
+		return nil, badRequest("'assertions' is required")
+	}
+	if len(inputs.TrustPolicyJSON) > 0 {
+		if len(inputs.PolicyJSON) > 0 || len(inputs.PrincipalArn) > 0 {
+			return nil, badRequest("'trust_policy_json' cannot be combined with 'policy_json' or 'principal_arn'")
+		}
+	} else if len(inputs.PolicyJSON) == 0 && len(inputs.PrincipalArn) == 0 {
+		return nil, badRequest("'policy_json' is required")
+	}
+	return &inputs, nil
+}
+
+func (s *Server) assert(r *http.Request) (interface{}, error) {
+	inputs, err := readInputs(r)
+	if err != nil {
+		return nil, err
+	}
+	if s.iam == nil || len(inputs.TrustPolicyJSON) > 0 {
+		inputs.Assertions = policy.WithContext(inputs.Assertions, s.Context)
+	}
+	result := runner.RunInputs(inputs, s.iam)
+	if result.MaxLength > 0 {
+		// as for the policies of 'test', an overlong policy errors its result
+		result.Err = policy.AssertPolicyLength(result.MaxLength, result.PolicyJSON)
+	}
+	s.metrics.observe(result)
+	return report.NewResults([]*runner.TargetResult{result}), nil
+}
+
+// Validation is the response of /v1/validate
+type Validation struct {
+	Valid  bool     `json:"valid"`
+	Errors []string `json:"errors"`
+	// Length is the length of the policy document (excluding whitespace)
+	Length    int        `json:"length"`
+	MaxLength int        `json:"max_length,omitempty"`
+	Findings  []*Finding `json:"findings"`
+}
+
+// Finding is a potential problem with a statement of the policy, found by
+// policy.LintPolicy
+type Finding struct {
+	Rule      string `json:"rule"`
+	Statement string `json:"statement"`
+	Line      int    `json:"line"`
+	Message   string `json:"message"`
+}
+
+// validate parses the policy documents and the assertions of the inputs,
+// responding with their errors, the length of the policy and the findings of
+// its lint
+func (s *Server) validate(r *http.Request) (interface{}, error) {
+	inputs, err := readInputs(r)
+	if err != nil {
+		return nil, err
+	}
+	validation := &Validation{Errors: []string{}, Findings: []*Finding{}, MaxLength: inputs.MaxLength}
+	document := inputs.PolicyJSON
+	if len(inputs.TrustPolicyJSON) > 0 {
+		document = inputs.TrustPolicyJSON
+	}
+	if len(document) > 0 {
+		validation.Length = policy.PolicyLength(document)
+		if _, err = policy.ParseDocument(document); err != nil {
+			validation.Errors = append(validation.Errors, err.Error())
+		}
+		if inputs.MaxLength > 0 {
+			if err = policy.AssertPolicyLength(inputs.MaxLength, document); err != nil {
+				validation.Errors = append(validation.Errors, err.Error())
+			}
+		}
+	}
+	if len(inputs.PolicyJSON) > 0 {
+		if findings, err := policy.LintPolicy(inputs.PolicyJSON); err == nil {
+			for _, finding := range findings {
+				validation.Findings = append(validation.Findings, &Finding{
+					Rule:      finding.Rule,
+					Statement: finding.Statement,
+					Line:      finding.Position.Line,
+					Message:   finding.Message,
+				})
+			}
+		}
+	}
+	for i, assertion := range inputs.Assertions {
+		if err = validateAssertion(assertion, len(inputs.TrustPolicyJSON) > 0); err != nil {
+			validation.Errors = append(validation.Errors, fmt.Sprintf("assertions[%d]: %v", i, err))
+		}
+	}
+	validation.Valid = len(validation.Errors) == 0
+	return validation, nil
+}
+
+// expectedResults are the values of expected_result
+var expectedResults = map[string]bool{
+	policy.Allowed:      true,
+	policy.ExplicitDeny: true,
+	policy.ImplicitDeny: true,
+	"deny":              true,
+	"denied":            true,
+}
+
+func validateAssertion(assertion *types.Assertion, trust bool) error {
+	if !expectedResults[assertion.ExpectedResult] {
+		return fmt.Errorf("Invalid expected_result '%s'; expected allowed, explicitDeny, implicitDeny, deny or denied",
+			assertion.ExpectedResult)
+	}
+	cells, err := policy.ExpandMatrix([]*types.Assertion{assertion})
+	if err != nil {
+		return err
+	}
+	for _, cell := range cells {
+		if trust {
+			err = policy.ValidateTrustAssertion(cell)
+		} else if len(cell.ActionNames) == 0 {
+			err = fmt.Errorf("'action_names' is required")
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Server) healthz(r *http.Request) (interface{}, error) {
+	return map[string]string{"status": "ok"}, nil
+}
+
+func (s *Server) version(r *http.Request) (interface{}, error) {
+	return &report.Tool{Name: version.Name, Version: version.Version}, nil
+}
@@ -0,0 +1,192 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/aws/aws-sdk-go/service/iam/iamiface"
+	"github.com/matt-deboer/assert-aws-iam-permissions/pkg/policy"
+	"github.com/matt-deboer/assert-aws-iam-permissions/pkg/report"
+	"github.com/matt-deboer/assert-aws-iam-permissions/pkg/version"
+)
+
+const testInputs = `{
+	"policy_json": "{\"Statement\": [{\"Sid\": \"Read\", \"Effect\": \"Allow\", \"Action\": \"s3:GetObject\", \"Resource\": \"arn:aws:s3:::{{bucket}}/*\"}]}",
+	"vars": {"bucket": "data"},
+	"assertions": [
+		{"comment": "Can read objects", "action_names": ["s3:GetObject"], "resource_arns": ["arn:aws:s3:::data/key"], "expected_result": "allowed"},
+		{"comment": "Can delete objects", "action_names": ["s3:DeleteObject"], "resource_arns": ["arn:aws:s3:::data/key"], "expected_result": "allowed"}
+	]
+}`
+
+func serve(t *testing.T, s *Server, method, path, body string, response interface{}) int {
+	recorder := httptest.NewRecorder()
+	s.ServeHTTP(recorder, httptest.NewRequest(method, path, strings.NewReader(body)))
+	if response != nil {
+		if err := json.Unmarshal(recorder.Body.Bytes(), response); err != nil {
+			t.Fatalf("%s %s: invalid response %s; %v", method, path, recorder.Body.String(), err)
+		}
+	}
+	return recorder.Code
+}
+
+func TestAssert(t *testing.T) {
+
+	var results report.Results
+	if status := serve(t, New(nil, 0), http.MethodPost, "/v1/assert", testInputs, &results); status != http.StatusOK {
+		t.Fatalf("expected status 200, but got %d", status)
+	}
+	if results.Summary.Passed != 1 || results.Summary.Failed != 1 || len(results.Policies) != 1 {
+		t.Fatalf("unexpected summary %+v", results.Summary)
+	}
+	assertions := results.Policies[0].Assertions
+	if assertions[0].Status != "PASS" || assertions[1].Status != "FAIL" ||
+		assertions[1].Evaluations[0].Decision != "implicitDeny" {
+		t.Errorf("unexpected assertions %+v %+v", assertions[0], assertions[1])
+	}
+
+	var failure map[string]string
+	status := serve(t, New(nil, 0), http.MethodPost, "/v1/assert", `{"policy_json": "{}"}`, &failure)
+	if status != http.StatusBadRequest || failure["error"] != "'assertions' is required" {
+		t.Errorf("unexpected response %d %v", status, failure)
+	}
+	status = serve(t, New(nil, 0), http.MethodGet, "/v1/assert", "", &failure)
+	if status != http.StatusMethodNotAllowed {
+		t.Errorf("expected status 405, but got %d", status)
+	}
+}
+
+func TestAssert_MaxLength(t *testing.T) {
+
+	var results report.Results
+	inputs := strings.Replace(testInputs, `"vars"`, `"max_length": 20, "vars"`, 1)
+	if status := serve(t, New(nil, 0), http.MethodPost, "/v1/assert", inputs, &results); status != http.StatusOK {
+		t.Fatalf("expected status 200, but got %d", status)
+	}
+	if policy := results.Policies[0]; policy.Status != "ERROR" ||
+		!strings.HasPrefix(policy.Error, "Policy document is 84 characters over") {
+		t.Errorf("unexpected policy results %+v", policy)
+	}
+}
+
+func TestValidate(t *testing.T) {
+
+	var validation Validation
+	inputs := `{
+		"policy_json": "{\"Statement\": {\"Effect\": \"Allow\", \"Action\": \"iam:PassRole\", \"Resource\": \"*\"}}",
+		"assertions": [
+			{"action_names": ["iam:PassRole"], "expected_result": "allowed"},
+			{"action_names": ["iam:PassRole"], "expected_result": "permitted"},
+			{"expected_result": "denied"}
+		]
+	}`
+	if status := serve(t, New(nil, 0), http.MethodPost, "/v1/validate", inputs, &validation); status != http.StatusOK {
+		t.Fatalf("expected status 200, but got %d", status)
+	}
+	if validation.Valid || len(validation.Errors) != 2 || validation.Length != 71 || len(validation.Findings) != 2 {
+		t.Fatalf("unexpected validation %+v", validation)
+	}
+	expected := "assertions[1]: Invalid expected_result 'permitted'; expected allowed, explicitDeny, implicitDeny, deny or denied"
+	if validation.Errors[0] != expected || validation.Errors[1] != "assertions[2]: 'action_names' is required" {
+		t.Errorf("unexpected errors %v", validation.Errors)
+	}
+
+	if serve(t, New(nil, 0), http.MethodPost, "/v1/validate", testInputs, &validation); !validation.Valid || len(validation.Findings) != 0 {
+		t.Errorf("unexpected validation %+v", validation)
+	}
+}
+
+func TestHealthzVersion(t *testing.T) {
+
+	var health map[string]string
+	if status := serve(t, New(nil, 0), http.MethodGet, "/healthz", "", &health); status != http.StatusOK || health["status"] != "ok" {
+		t.Errorf("unexpected response %d %v", status, health)
+	}
+	var tool report.Tool
+	if status := serve(t, New(nil, 0), http.MethodGet, "/version", "", &tool); status != http.StatusOK ||
+		tool.Name != version.Name || tool.Version != version.Version {
+		t.Errorf("unexpected response %d %+v", status, tool)
+	}
+}
+
+// fakeIAM simulates policies allowing only s3:GetObject, and fails for
+// actions named "invalid"
+type fakeIAM struct {
+	iamiface.IAMAPI
+}
+
+func (f *fakeIAM) SimulateCustomPolicy(input *iam.SimulateCustomPolicyInput) (*iam.SimulatePolicyResponse, error) {
+	response := &iam.SimulatePolicyResponse{}
+	for _, action := range aws.StringValueSlice(input.ActionNames) {
+		if action == "invalid" {
+			return nil, awserr.New("InvalidInput", "invalid action", nil)
+		}
+		decision := policy.ImplicitDeny
+		if action == "s3:GetObject" {
+			decision = policy.Allowed
+		}
+		for _, resource := range input.ResourceArns {
+			response.EvaluationResults = append(response.EvaluationResults, &iam.EvaluationResult{
+				EvalActionName:   aws.String(action),
+				EvalResourceName: resource,
+				EvalDecision:     aws.String(decision),
+			})
+		}
+	}
+	return response, nil
+}
+
+func TestMetrics(t *testing.T) {
+
+	s := New(&fakeIAM{}, 10)
+	for i := 0; i < 2; i++ {
+		if status := serve(t, s, http.MethodPost, "/v1/assert", testInputs, nil); status != http.StatusOK {
+			t.Fatalf("expected status 200, but got %d", status)
+		}
+	}
+	invalid := strings.Replace(testInputs, "s3:DeleteObject", "invalid", 1)
+	if status := serve(t, s, http.MethodPost, "/v1/assert", invalid, nil); status != http.StatusOK {
+		t.Fatalf("expected status 200, but got %d", status)
+	}
+
+	recorder := httptest.NewRecorder()
+	s.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	exposition := recorder.Body.String()
+	for _, expected := range []string{
+		`aaip_assertions_evaluated_total{engine="simulator",expected_result="allowed"} 6`,
+		`aaip_assertions_passed_total{engine="simulator",expected_result="allowed"} 3`,
+		`aaip_assertions_failed_total{engine="simulator",expected_result="allowed"} 2`,
+		`aaip_simulator_calls_total{engine="simulator",operation="SimulateCustomPolicy"} 3`,
+		`aaip_simulator_errors_total{engine="simulator",operation="SimulateCustomPolicy",code="InvalidInput"} 1`,
+		`aaip_simulation_cache_hits_total{engine="simulator"} 3`,
+		`aaip_simulation_cache_misses_total{engine="simulator"} 3`,
+		`aaip_simulation_duration_seconds_count{engine="simulator"} 6`,
+		`aaip_policy_length_characters_bucket{engine="simulator",le="256"} 3`,
+		`aaip_policy_length_characters_sum{engine="simulator"} 312`,
+	} {
+		if !strings.Contains(exposition, expected+"\n") {
+			t.Errorf("expected %s in the metrics:\n%s", expected, exposition)
+		}
+	}
+}
+
+func TestExpectedResultLabel(t *testing.T) {
+	for expectedResult, label := range map[string]string{
+		"allowed":      "allowed",
+		"explicitDeny": "explicitDeny",
+		"denied":       "deny",
+		"deny":         "deny",
+		"Allowed":      "other",
+		"anything":     "other",
+	} {
+		if actual := expectedResultLabel(expectedResult); actual != label {
+			t.Errorf("%s: expected the label %s, but got %s", expectedResult, label, actual)
+		}
+	}
+}
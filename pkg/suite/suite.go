@@ -0,0 +1,441 @@
+package suite
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/matt-deboer/assert-aws-iam-permissions/pkg/types"
+	yaml "gopkg.in/yaml.v3"
+)
+
+// Suite is a named group of assertions loaded from a suite file; the
+// assertions found outside of any named suite have an empty name
+type Suite struct {
+	Name       string
+	File       string
+	Assertions []*types.Assertion
+}
+
+// Defaults are inherited by every assertion of a suite that does not set
+// them itself; context entries are merged, with the assertion's taking
+// precedence, and tags are added to the assertion's own
+type Defaults struct {
+	CallerArn      string                              `json:"caller_arn"`
+	ResourceOwner  string                              `json:"resource_owner"`
+	ContextEntries map[string]*types.ContextEntryValue `json:"context_entries"`
+	Tags           []string                            `json:"tags"`
+}
+
+// Error locates a problem within a suite file
+type Error struct {
+	File    string
+	Line    int
+	Column  int
+	Message string
+}
+
+func (e *Error) Error() string {
+	if e.Column > 0 {
+		return fmt.Sprintf("%s:%d:%d: %s", e.File, e.Line, e.Column, e.Message)
+	}
+	return fmt.Sprintf("%s:%d: %s", e.File, e.Line, e.Message)
+}
+
+// Load reads the suite file at path, written in JSON or YAML, which holds
+// either an array of assertions or an object with the optional keys 'include'
+// (paths of other suite files, relative to this one, whose suites are loaded
+// first), 'defaults' (inherited by every assertion of the file), 'assertions'
+// and 'suites' (mapping suite names to objects with their own 'defaults' and
+// 'assertions')
+func Load(path string) ([]*Suite, error) {
+	l := &loader{loading: make(map[string]bool)}
+	if err := l.load(path); err != nil {
+		return nil, err
+	}
+	return l.suites, nil
+}
+
+// Assertions returns the assertions of all of the suites, in order
+func Assertions(suites []*Suite) []*types.Assertion {
+	assertions := []*types.Assertion{}
+	for _, s := range suites {
+		assertions = append(assertions, s.Assertions...)
+	}
+	return assertions
+}
+
+type loader struct {
+	suites []*Suite
+	// loading holds the files currently being loaded, to detect include cycles
+	loading map[string]bool
+}
+
+type file struct {
+	path string
+}
+
+func (l *loader) load(path string) error {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("Failed to read suite file; %v", err)
+	}
+	l.loading[absPath] = true
+	defer delete(l.loading, absPath)
+
+	f := &file{path: path}
+	root, err := f.parse(data)
+	if err != nil {
+		return err
+	}
+	if root == nil {
+		return nil
+	}
+	if root.Kind == yaml.SequenceNode {
+		assertions, err := f.assertions(root, &Defaults{})
+		if err != nil {
+			return err
+		}
+		l.suites = append(l.suites, &Suite{File: path, Assertions: assertions})
+		return nil
+	}
+	if root.Kind != yaml.MappingNode {
+		return f.errorf(root, "expected an array of assertions or an object, got %s", describe(root))
+	}
+
+	keys := map[string]*yaml.Node{}
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		key := root.Content[i]
+		switch key.Value {
+		case "include", "defaults", "assertions", "suites":
+			keys[key.Value] = root.Content[i+1]
+		default:
+			return f.errorf(key, "unknown key '%s'; expected include, defaults, assertions or suites", key.Value)
+		}
+	}
+
+	if node := keys["include"]; node != nil {
+		var includes []string
+		if err := f.decode(node, reflect.ValueOf(&includes).Elem()); err != nil {
+			return err
+		}
+		for i, include := range includes {
+			includePath := include
+			if !filepath.IsAbs(includePath) {
+				includePath = filepath.Join(filepath.Dir(path), include)
+			}
+			if absInclude, err := filepath.Abs(includePath); err == nil && l.loading[absInclude] {
+				return f.errorf(node.Content[i], "'%s' is included recursively", include)
+			}
+			if err := l.load(includePath); err != nil {
+				if _, ok := err.(*Error); ok {
+					return err
+				}
+				return f.errorf(node.Content[i], "%v", err)
+			}
+		}
+	}
+
+	defaults := &Defaults{}
+	if node := keys["defaults"]; node != nil {
+		if err := f.decode(node, reflect.ValueOf(defaults).Elem()); err != nil {
+			return err
+		}
+	}
+	if node := keys["assertions"]; node != nil {
+		assertions, err := f.assertions(node, defaults)
+		if err != nil {
+			return err
+		}
+		l.suites = append(l.suites, &Suite{File: path, Assertions: assertions})
+	}
+	if node := keys["suites"]; node != nil {
+		if node.Kind != yaml.MappingNode {
+			return f.errorf(node, "expected 'suites' to be an object mapping names to suites, got %s", describe(node))
+		}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			s, err := f.suite(node.Content[i], node.Content[i+1], defaults)
+			if err != nil {
+				return err
+			}
+			l.suites = append(l.suites, s)
+		}
+	}
+	return nil
+}
+
+// parse returns the root node of the document, or nil for an empty file
+func (f *file) parse(data []byte) (*yaml.Node, error) {
+	// report JSON syntax errors with their column, which yaml does not provide
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && (trimmed[0] == '[' || trimmed[0] == '{') {
+		var v interface{}
+		if err := json.Unmarshal(data, &v); err != nil {
+			if syntaxErr, ok := err.(*json.SyntaxError); ok {
+				line, column := position(data, syntaxErr.Offset)
+				return nil, &Error{File: f.path, Line: line, Column: column, Message: syntaxErr.Error()}
+			}
+		}
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, f.syntaxError(err)
+	}
+	if len(doc.Content) == 0 {
+		return nil, nil
+	}
+	return doc.Content[0], nil
+}
+
+var yamlErrorPattern = regexp.MustCompile(`^yaml: line (\d+): (.*)$`)
+
+func (f *file) syntaxError(err error) error {
+	if match := yamlErrorPattern.FindStringSubmatch(err.Error()); match != nil {
+		line, _ := strconv.Atoi(match[1])
+		return &Error{File: f.path, Line: line, Message: match[2]}
+	}
+	return &Error{File: f.path, Line: 1, Message: strings.TrimPrefix(err.Error(), "yaml: ")}
+}
+
+func (f *file) suite(name, node *yaml.Node, fileDefaults *Defaults) (*Suite, error) {
+	if node.Kind != yaml.MappingNode {
+		return nil, f.errorf(node, "expected suite '%s' to be an object, got %s", name.Value, describe(node))
+	}
+	defaults := fileDefaults
+	var assertionsNode *yaml.Node
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i], node.Content[i+1]
+		switch key.Value {
+		case "defaults":
+			suiteDefaults := &Defaults{}
+			if err := f.decode(value, reflect.ValueOf(suiteDefaults).Elem()); err != nil {
+				return nil, err
+			}
+			defaults = suiteDefaults.inherit(fileDefaults)
+		case "assertions":
+			assertionsNode = value
+		default:
+			return nil, f.errorf(key, "unknown key '%s' in suite '%s'; expected defaults or assertions", key.Value, name.Value)
+		}
+	}
+	s := &Suite{Name: name.Value, File: f.path, Assertions: []*types.Assertion{}}
+	if assertionsNode != nil {
+		assertions, err := f.assertions(assertionsNode, defaults)
+		if err != nil {
+			return nil, err
+		}
+		s.Assertions = assertions
+	}
+	return s, nil
+}
+
+func (f *file) assertions(node *yaml.Node, defaults *Defaults) ([]*types.Assertion, error) {
+	if node.Kind != yaml.SequenceNode {
+		return nil, f.errorf(node, "expected an array of assertions, got %s", describe(node))
+	}
+	assertions := make([]*types.Assertion, 0, len(node.Content))
+	for _, item := range node.Content {
+		assertion := &types.Assertion{}
+		if err := f.decode(item, reflect.ValueOf(assertion).Elem()); err != nil {
+			return nil, err
+		}
+		defaults.apply(assertion)
+		assertion.Location = &types.Location{File: f.path, Line: item.Line, Column: item.Column}
+		assertions = append(assertions, assertion)
+	}
+	return assertions, nil
+}
+
+// inherit returns the defaults overlaid on those of the parent
+func (d *Defaults) inherit(parent *Defaults) *Defaults {
+	merged := &Defaults{
+		CallerArn:      d.CallerArn,
+		ResourceOwner:  d.ResourceOwner,
+		ContextEntries: mergeEntries(parent.ContextEntries, d.ContextEntries),
+		Tags:           mergeTags(parent.Tags, d.Tags),
+	}
+	if len(merged.CallerArn) == 0 {
+		merged.CallerArn = parent.CallerArn
+	}
+	if len(merged.ResourceOwner) == 0 {
+		merged.ResourceOwner = parent.ResourceOwner
+	}
+	return merged
+}
+
+func (d *Defaults) apply(assertion *types.Assertion) {
+	if len(assertion.CallerArn) == 0 {
+		assertion.CallerArn = d.CallerArn
+	}
+	if len(assertion.ResourceOwner) == 0 {
+		assertion.ResourceOwner = d.ResourceOwner
+	}
+	assertion.ContextEntries = mergeEntries(d.ContextEntries, assertion.ContextEntries)
+	assertion.Tags = mergeTags(d.Tags, assertion.Tags)
+}
+
+// mergeTags returns the union of the tags, in order
+func mergeTags(base, additions []string) []string {
+	if len(base) == 0 {
+		return additions
+	}
+	merged := append([]string(nil), base...)
+	for _, tag := range additions {
+		found := false
+		for _, existing := range merged {
+			found = found || existing == tag
+		}
+		if !found {
+			merged = append(merged, tag)
+		}
+	}
+	return merged
+}
+
+// mergeEntries copies the base entries, overlaid with the overrides; entries
+// are copied so that interpolation of one assertion does not affect another
+func mergeEntries(base, overrides map[string]*types.ContextEntryValue) map[string]*types.ContextEntryValue {
+	if len(base) == 0 {
+		return overrides
+	}
+	merged := make(map[string]*types.ContextEntryValue, len(base)+len(overrides))
+	for _, entries := range []map[string]*types.ContextEntryValue{base, overrides} {
+		for key, entry := range entries {
+			if entry != nil {
+				copied := *entry
+				copied.Values = append([]string(nil), entry.Values...)
+				entry = &copied
+			}
+			merged[key] = entry
+		}
+	}
+	return merged
+}
+
+// decode sets v from the node, matching object keys to the json tags of
+// struct fields, so that suite files use the same keys as the 'assertions' input
+func (f *file) decode(node *yaml.Node, v reflect.Value) error {
+	if node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+	if node.Kind == yaml.ScalarNode && node.Tag == "!!null" {
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return f.decode(node, v.Elem())
+	case reflect.Struct:
+		if node.Kind != yaml.MappingNode {
+			return f.errorf(node, "expected an object, got %s", describe(node))
+		}
+		fields := jsonFields(v.Type())
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			index, ok := fields[key.Value]
+			if !ok {
+				return f.errorf(key, "unknown key '%s'", key.Value)
+			}
+			if err := f.decode(value, v.Field(index)); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		if node.Kind != yaml.MappingNode {
+			return f.errorf(node, "expected an object, got %s", describe(node))
+		}
+		if v.IsNil() {
+			v.Set(reflect.MakeMap(v.Type()))
+		}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			value := reflect.New(v.Type().Elem()).Elem()
+			if err := f.decode(node.Content[i+1], value); err != nil {
+				return err
+			}
+			v.SetMapIndex(reflect.ValueOf(node.Content[i].Value), value)
+		}
+	case reflect.Slice:
+		if node.Kind != yaml.SequenceNode {
+			return f.errorf(node, "expected an array, got %s", describe(node))
+		}
+		slice := reflect.MakeSlice(v.Type(), len(node.Content), len(node.Content))
+		for i, item := range node.Content {
+			if err := f.decode(item, slice.Index(i)); err != nil {
+				return err
+			}
+		}
+		v.Set(slice)
+	case reflect.String:
+		if node.Kind != yaml.ScalarNode {
+			return f.errorf(node, "expected a string, got %s", describe(node))
+		}
+		v.SetString(node.Value)
+	case reflect.Bool:
+		var b bool
+		if node.Kind != yaml.ScalarNode || node.Decode(&b) != nil {
+			return f.errorf(node, "expected true or false, got %s", describe(node))
+		}
+		v.SetBool(b)
+	case reflect.Int:
+		var n int
+		if node.Kind != yaml.ScalarNode || node.Decode(&n) != nil {
+			return f.errorf(node, "expected an integer, got %s", describe(node))
+		}
+		v.SetInt(int64(n))
+	default:
+		return f.errorf(node, "unsupported value of type %s", v.Type())
+	}
+	return nil
+}
+
+// jsonFields maps the json key of each field of the struct type to its index
+func jsonFields(t reflect.Type) map[string]int {
+	fields := make(map[string]int, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		if len(name) > 0 && name != "-" {
+			fields[name] = i
+		}
+	}
+	return fields
+}
+
+func describe(node *yaml.Node) string {
+	switch node.Kind {
+	case yaml.MappingNode:
+		return "an object"
+	case yaml.SequenceNode:
+		return "an array"
+	}
+	return fmt.Sprintf("'%s'", node.Value)
+}
+
+func (f *file) errorf(node *yaml.Node, format string, args ...interface{}) error {
+	return &Error{File: f.path, Line: node.Line, Column: node.Column, Message: fmt.Sprintf(format, args...)}
+}
+
+// position converts a byte offset into a 1-based line and column
+func position(data []byte, offset int64) (int, int) {
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	if offset < 1 {
+		offset = 1
+	}
+	// the offset counts the offending byte
+	before := data[:offset-1]
+	line := bytes.Count(before, []byte("\n")) + 1
+	column := len(before) - bytes.LastIndexByte(before, '\n')
+	return line, column
+}
@@ -0,0 +1,145 @@
+package suite
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeFiles(t *testing.T, files map[string]string) string {
+	dir, err := ioutil.TempDir("", "suite")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestLoad(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"common/basics.json": `[
+	{
+		"comment": "Can list the bucket",
+		"expected_result": "allowed",
+		"action_names": ["s3:ListBucket"],
+		"resource_arns": ["arn:aws:s3:::my-bucket"]
+	}
+]`,
+		"suite.yaml": `
+include:
+  - common/basics.json
+defaults:
+  resource_owner: arn:aws:iam::123456789012:root
+  context_entries:
+    aws:SourceVpce: {values: [vpce-1234]}
+suites:
+  partner:
+    defaults:
+      caller_arn: arn:aws:iam::210987654321:role/reader
+      context_entries:
+        aws:SecureTransport: {type: boolean, values: ["true"]}
+    assertions:
+      - comment: Partner reads objects
+        expected_result: allowed
+        action_names: [s3:GetObject]
+        resource_arns: [arn:aws:s3:::my-bucket/*]
+      - comment: Partner reads over the public internet
+        expected_result: denied
+        action_names: [s3:GetObject]
+        resource_arns: [arn:aws:s3:::my-bucket/*]
+        caller_arn: arn:aws:iam::210987654321:role/other
+        context_entries:
+          aws:SourceVpce: {values: [""]}
+`,
+	})
+	defer os.RemoveAll(dir)
+
+	suites, err := Load(filepath.Join(dir, "suite.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(suites) != 2 || len(suites[0].Name) > 0 || suites[1].Name != "partner" {
+		t.Fatalf("expected the included suite followed by 'partner', but got %+v", suites)
+	}
+	if assertions := suites[0].Assertions; len(assertions) != 1 || len(assertions[0].ResourceOwner) > 0 {
+		t.Errorf("expected the included assertion without the including file's defaults, but got %+v", assertions)
+	}
+
+	assertions := suites[1].Assertions
+	if len(assertions) != 2 {
+		t.Fatalf("expected 2 assertions, but got %d", len(assertions))
+	}
+	first, second := assertions[0], assertions[1]
+	if first.CallerArn != "arn:aws:iam::210987654321:role/reader" || first.ResourceOwner != "arn:aws:iam::123456789012:root" {
+		t.Errorf("expected the defaults to be inherited, but got %+v", first)
+	}
+	if first.ContextEntries["aws:SourceVpce"].Values[0] != "vpce-1234" ||
+		first.ContextEntries["aws:SecureTransport"].Type != "boolean" {
+		t.Errorf("expected the file and suite context entries to be merged, but got %+v", first.ContextEntries)
+	}
+	if second.CallerArn != "arn:aws:iam::210987654321:role/other" || second.ContextEntries["aws:SourceVpce"].Values[0] != "" ||
+		len(second.ContextEntries) != 2 {
+		t.Errorf("expected the assertion's own values to take precedence, but got %+v", second)
+	}
+	second.ContextEntries["aws:SecureTransport"].Values[0] = "false"
+	if first.ContextEntries["aws:SecureTransport"].Values[0] != "true" {
+		t.Error("expected the inherited context entries to be copied per assertion")
+	}
+
+	if all := Assertions(suites); len(all) != 3 || all[0].Comment != "Can list the bucket" {
+		t.Errorf("unexpected assertions %+v", all)
+	}
+}
+
+func TestLoad_Errors(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"unknown.yaml": `
+assertions:
+  - comment: Misspelled
+    expected_result: allowed
+    action_name: [s3:GetObject]
+`,
+		"type.yaml": `
+assertions:
+  - comment: Not a list
+    action_names: {s3: GetObject}
+`,
+		"syntax.json": `[
+  {"comment": "missing comma" "expected_result": "allowed"}
+]`,
+		"cycle.yaml":   "include: [cycle-b.yaml]\n",
+		"cycle-b.yaml": "include:\n  - cycle.yaml\n",
+		"missing.yaml": "include:\n  - nowhere.yaml\n",
+	})
+	defer os.RemoveAll(dir)
+
+	for name, expected := range map[string]string{
+		"unknown.yaml": "unknown.yaml:5:5: unknown key 'action_name'",
+		"type.yaml":    "type.yaml:4:19: expected an array, got an object",
+		"syntax.json":  "syntax.json:2:31: invalid character '\"' after object key:value pair",
+		"cycle.yaml":   "cycle-b.yaml:2:5: 'cycle.yaml' is included recursively",
+	} {
+		_, err := Load(filepath.Join(dir, name))
+		if err == nil {
+			t.Errorf("expected an error loading %s", name)
+			continue
+		}
+		if err.Error() != filepath.Join(dir, expected) {
+			t.Errorf("expected '%s', but got '%v'", filepath.Join(dir, expected), err)
+		}
+	}
+
+	_, err := Load(filepath.Join(dir, "missing.yaml"))
+	if suiteErr, ok := err.(*Error); !ok || suiteErr.Line != 2 || suiteErr.Column != 5 {
+		t.Errorf("expected the missing include to be located, but got %v", err)
+	}
+}
@@ -0,0 +1,262 @@
+// Package tfplan extracts the policy documents of the resources of a terraform plan
+package tfplan // import "github.com/matt-deboer/assert-aws-iam-permissions/pkg/tfplan"
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Kinds of policy documents, also those of the resources of CloudFormation
+// templates (see package cfn)
+const (
+	// Identity policies are attached to users, groups and roles
+	Identity = "identity"
+	// Trust policies are the assume role policies of roles
+	Trust = "trust"
+	// Resource policies are attached to resources, such as buckets and queues
+	Resource = "resource"
+)
+
+// policyAttribute is an attribute of a resource type holding a policy document
+type policyAttribute struct {
+	Name string
+	Kind string
+}
+
+// policyAttributes are the attributes holding policy documents, by resource type
+var policyAttributes = map[string][]policyAttribute{
+	"aws_iam_policy":                     {{"policy", Identity}},
+	"aws_iam_role_policy":                {{"policy", Identity}},
+	"aws_iam_user_policy":                {{"policy", Identity}},
+	"aws_iam_group_policy":               {{"policy", Identity}},
+	"aws_iam_role":                       {{"assume_role_policy", Trust}},
+	"aws_s3_bucket_policy":               {{"policy", Resource}},
+	"aws_s3_bucket":                      {{"policy", Resource}},
+	"aws_sns_topic_policy":               {{"policy", Resource}},
+	"aws_sns_topic":                      {{"policy", Resource}},
+	"aws_sqs_queue_policy":               {{"policy", Resource}},
+	"aws_sqs_queue":                      {{"policy", Resource}},
+	"aws_kms_key":                        {{"policy", Resource}},
+	"aws_ecr_repository_policy":          {{"policy", Resource}},
+	"aws_secretsmanager_secret_policy":   {{"policy", Resource}},
+	"aws_secretsmanager_secret":          {{"policy", Resource}},
+	"aws_cloudwatch_log_resource_policy": {{"policy_document", Resource}},
+	"aws_elasticsearch_domain_policy":    {{"access_policies", Resource}},
+}
+
+// Policy is a policy document of a resource in a plan
+type Policy struct {
+	// Address locates the policy: the address of its resource, followed by
+	// the name of the policy for the inline policies of roles
+	Address string
+	Type    string
+	Kind    string
+	// Document is empty when the policy is not known until apply
+	Document string
+	Unknown  bool
+	// Tags are the tags of the resource, including the provider's default tags
+	Tags map[string]string
+}
+
+type plan struct {
+	PlannedValues   *values           `json:"planned_values"`
+	Values          *values           `json:"values"`
+	ResourceChanges []*resourceChange `json:"resource_changes"`
+}
+
+type values struct {
+	RootModule *module `json:"root_module"`
+}
+
+type module struct {
+	Resources    []*resource `json:"resources"`
+	ChildModules []*module   `json:"child_modules"`
+}
+
+type resource struct {
+	Address string                 `json:"address"`
+	Mode    string                 `json:"mode"`
+	Type    string                 `json:"type"`
+	Values  map[string]interface{} `json:"values"`
+}
+
+type resourceChange struct {
+	Address string `json:"address"`
+	Change  struct {
+		AfterUnknown map[string]interface{} `json:"after_unknown"`
+	} `json:"change"`
+}
+
+// Extract returns the policy documents of the resources in the output of
+// 'terraform show -json', for either a plan (its planned values) or a state.
+// Policies computed during apply are returned as Unknown.
+func Extract(data []byte) ([]*Policy, error) {
+	var p plan
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, fmt.Errorf("Failed to parse terraform plan; %v", err)
+	}
+	planned := p.PlannedValues
+	if planned == nil {
+		planned = p.Values
+	}
+	if planned == nil || planned.RootModule == nil {
+		return nil, fmt.Errorf("Failed to parse terraform plan; expected the output of 'terraform show -json'")
+	}
+	unknown := map[string]map[string]interface{}{}
+	for _, change := range p.ResourceChanges {
+		unknown[change.Address] = change.Change.AfterUnknown
+	}
+
+	policies := []*Policy{}
+	var walk func(m *module)
+	walk = func(m *module) {
+		for _, r := range m.Resources {
+			if r.Mode == "managed" || len(r.Mode) == 0 {
+				policies = append(policies, resourcePolicies(r, unknown[r.Address])...)
+			}
+		}
+		for _, child := range m.ChildModules {
+			walk(child)
+		}
+	}
+	walk(planned.RootModule)
+	return policies, nil
+}
+
+func resourcePolicies(r *resource, unknown map[string]interface{}) []*Policy {
+	policies := []*Policy{}
+	tags := resourceTags(r.Values)
+	for _, attribute := range policyAttributes[r.Type] {
+		document, _ := r.Values[attribute.Name].(string)
+		isUnknown := unknown[attribute.Name] == true
+		if len(document) == 0 && !isUnknown {
+			continue
+		}
+		policies = append(policies, &Policy{
+			Address:  r.Address,
+			Type:     r.Type,
+			Kind:     attribute.Kind,
+			Document: document,
+			Unknown:  isUnknown,
+			Tags:     tags,
+		})
+	}
+	// roles may also hold their identity policies inline, any of which may
+	// be computed during apply (as may the whole list)
+	if r.Type == "aws_iam_role" {
+		if unknown["inline_policy"] == true {
+			policies = append(policies, &Policy{
+				Address: r.Address + ".inline_policy",
+				Type:    r.Type,
+				Kind:    Identity,
+				Unknown: true,
+				Tags:    tags,
+			})
+			return policies
+		}
+		inlinePolicies, _ := r.Values["inline_policy"].([]interface{})
+		unknownInlinePolicies, _ := unknown["inline_policy"].([]interface{})
+		for i, inline := range inlinePolicies {
+			values, _ := inline.(map[string]interface{})
+			name, _ := values["name"].(string)
+			document, _ := values["policy"].(string)
+			isUnknown := false
+			if i < len(unknownInlinePolicies) {
+				unknownValues, _ := unknownInlinePolicies[i].(map[string]interface{})
+				isUnknown = unknownValues["policy"] == true
+			}
+			if len(document) == 0 && !isUnknown {
+				continue
+			}
+			policies = append(policies, &Policy{
+				Address:  fmt.Sprintf("%s.inline_policy[%q]", r.Address, name),
+				Type:     r.Type,
+				Kind:     Identity,
+				Document: document,
+				Unknown:  isUnknown,
+				Tags:     tags,
+			})
+		}
+	}
+	return policies
+}
+
+func resourceTags(values map[string]interface{}) map[string]string {
+	tags := map[string]string{}
+	for _, attribute := range []string{"tags_all", "tags"} {
+		attributeTags, _ := values[attribute].(map[string]interface{})
+		for key, value := range attributeTags {
+			if s, ok := value.(string); ok {
+				tags[key] = s
+			}
+		}
+	}
+	return tags
+}
+
+// Rule matches policies to the assertion suite file evaluated against them,
+// by the address of their resource or by one of its tags; addresses may be
+// those of other sources of policies, such as the logical IDs of templates
+type Rule struct {
+	// Address is a pattern of resource addresses, in which '*' matches any
+	// sequence of characters
+	Address        string
+	TagKey         string
+	TagValue       string
+	AssertionsFile string
+	address        *regexp.Regexp
+}
+
+// tagPrefix prefixes the tag patterns of rules
+const tagPrefix = "tag:"
+
+// ParseRule parses a rule of the form PATTERN=FILE, where PATTERN is either a
+// pattern of resource addresses (e.g. "module.app.aws_iam_role_policy.*") or
+// a tag of the form tag:Key=Value
+func ParseRule(rule string) (*Rule, error) {
+	separator := strings.LastIndex(rule, "=")
+	if separator <= 0 || separator == len(rule)-1 {
+		return nil, fmt.Errorf("Invalid suite rule '%s'; expected PATTERN=FILE, where PATTERN is a resource address "+
+			"pattern or tag:Key=Value", rule)
+	}
+	pattern, file := rule[:separator], rule[separator+1:]
+	r := &Rule{AssertionsFile: file}
+	if strings.HasPrefix(pattern, tagPrefix) {
+		tag := strings.SplitN(strings.TrimPrefix(pattern, tagPrefix), "=", 2)
+		if len(tag) != 2 || len(tag[0]) == 0 {
+			return nil, fmt.Errorf("Invalid suite rule '%s'; expected a tag of the form tag:Key=Value", rule)
+		}
+		r.TagKey, r.TagValue = tag[0], tag[1]
+		return r, nil
+	}
+	r.Address = pattern
+	quoted := strings.Replace(regexp.QuoteMeta(pattern), `\*`, ".*", -1)
+	r.address = regexp.MustCompile("^" + quoted + "$")
+	return r, nil
+}
+
+// Matches reports whether the rule applies to the policy at the address,
+// whose resource has the tags
+func (r *Rule) Matches(address string, tags map[string]string) bool {
+	if r.address != nil {
+		return r.address.MatchString(address)
+	}
+	value, ok := tags[r.TagKey]
+	return ok && value == r.TagValue
+}
+
+// Match returns the assertion suite files of the rules matching the policy at
+// the address, without duplicates and in the order of the rules
+func Match(rules []*Rule, address string, tags map[string]string) []string {
+	files := []string{}
+	seen := map[string]bool{}
+	for _, r := range rules {
+		if r.Matches(address, tags) && !seen[r.AssertionsFile] {
+			seen[r.AssertionsFile] = true
+			files = append(files, r.AssertionsFile)
+		}
+	}
+	return files
+}
@@ -0,0 +1,113 @@
+package tfplan
+
+import (
+	"testing"
+)
+
+const testPlan = `{
+  "format_version": "1.1",
+  "planned_values": {
+    "root_module": {
+      "resources": [
+        {"address": "aws_iam_role.app", "mode": "managed", "type": "aws_iam_role", "name": "app",
+         "values": {
+           "assume_role_policy": "{\"Statement\": {\"Effect\": \"Allow\", \"Principal\": {\"Service\": \"ec2.amazonaws.com\"}, \"Action\": \"sts:AssumeRole\"}}",
+           "inline_policy": [{"name": "logs", "policy": "{\"Statement\": {\"Effect\": \"Allow\", \"Action\": \"logs:PutLogEvents\", \"Resource\": \"*\"}}"},
+             {"name": "deploy"}],
+           "tags": {"Team": "data"},
+           "tags_all": {"Team": "platform", "Env": "prod"}
+         }},
+        {"address": "aws_s3_bucket.data", "mode": "managed", "type": "aws_s3_bucket", "name": "data",
+         "values": {"bucket": "data", "policy": ""}},
+        {"address": "data.aws_iam_policy_document.reader", "mode": "data", "type": "aws_iam_policy_document", "name": "reader",
+         "values": {"json": "{}"}}
+      ],
+      "child_modules": [
+        {"address": "module.bucket", "resources": [
+          {"address": "module.bucket.aws_s3_bucket_policy.this", "mode": "managed", "type": "aws_s3_bucket_policy", "name": "this",
+           "values": {"bucket": "data"}},
+          {"address": "module.bucket.aws_iam_policy.reader[\"data\"]", "mode": "managed", "type": "aws_iam_policy", "name": "reader",
+           "values": {"policy": "{\"Statement\": {\"Effect\": \"Allow\", \"Action\": \"s3:GetObject\", \"Resource\": \"*\"}}"}}
+        ]}
+      ]
+    }
+  },
+  "resource_changes": [
+    {"address": "aws_iam_role.app", "change": {"actions": ["update"], "after_unknown": {"inline_policy": [{}, {"policy": true}]}}},
+    {"address": "module.bucket.aws_s3_bucket_policy.this", "change": {"actions": ["create"], "after_unknown": {"policy": true}}}
+  ]
+}`
+
+func TestExtract(t *testing.T) {
+	policies, err := Extract([]byte(testPlan))
+	if err != nil {
+		t.Fatal(err)
+	}
+	type extracted struct {
+		address, kind string
+		unknown       bool
+	}
+	expected := []extracted{
+		{`aws_iam_role.app`, Trust, false},
+		{`aws_iam_role.app.inline_policy["logs"]`, Identity, false},
+		{`aws_iam_role.app.inline_policy["deploy"]`, Identity, true},
+		{`module.bucket.aws_s3_bucket_policy.this`, Resource, true},
+		{`module.bucket.aws_iam_policy.reader["data"]`, Identity, false},
+	}
+	if len(policies) != len(expected) {
+		t.Fatalf("expected %d policies, but got %d", len(expected), len(policies))
+	}
+	for i, p := range policies {
+		if actual := (extracted{p.Address, p.Kind, p.Unknown}); actual != expected[i] {
+			t.Errorf("expected policy %+v, but got %+v", expected[i], actual)
+		}
+	}
+	if tags := policies[0].Tags; tags["Team"] != "data" || tags["Env"] != "prod" {
+		t.Errorf("expected the resource's tags over the default tags, but got %v", tags)
+	}
+
+	// when the whole list of inline policies is computed, their names aren't known either
+	policies, err = Extract([]byte(`{"planned_values": {"root_module": {"resources": [
+		{"address": "aws_iam_role.app", "mode": "managed", "type": "aws_iam_role", "values": {}}]}},
+		"resource_changes": [{"address": "aws_iam_role.app", "change": {"after_unknown": {"inline_policy": true}}}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(policies) != 1 || policies[0].Address != "aws_iam_role.app.inline_policy" || !policies[0].Unknown {
+		t.Errorf("expected the unknown inline policies, but got %+v", policies)
+	}
+
+	if _, err := Extract([]byte(`{"format_version": "1.1"}`)); err == nil {
+		t.Errorf("expected an error for a document which isn't a plan")
+	}
+}
+
+func TestMatch(t *testing.T) {
+	rules := []*Rule{}
+	for _, definition := range []string{
+		`module.bucket.aws_iam_policy.*=readers.assertions.yaml`,
+		`tag:Team=data=data.assertions.yaml`,
+		`*["data"]=data.assertions.yaml`,
+	} {
+		rule, err := ParseRule(definition)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rules = append(rules, rule)
+	}
+	if files := Match(rules, `module.bucket.aws_iam_policy.reader["data"]`, nil); len(files) != 2 || files[0] != "readers.assertions.yaml" || files[1] != "data.assertions.yaml" {
+		t.Errorf("unexpected suites %v", files)
+	}
+	if files := Match(rules, "aws_iam_role.app", map[string]string{"Team": "data"}); len(files) != 1 || files[0] != "data.assertions.yaml" {
+		t.Errorf("unexpected suites %v", files)
+	}
+	if files := Match(rules, "aws_iam_policy.other", nil); len(files) != 0 {
+		t.Errorf("unexpected suites %v", files)
+	}
+
+	for _, invalid := range []string{"readers.assertions.yaml", "aws_iam_policy.x=", "tag:Team=x.yaml"} {
+		if _, err := ParseRule(invalid); err == nil {
+			t.Errorf("expected an error for the rule %s", invalid)
+		}
+	}
+}
@@ -1,24 +1,64 @@
 package types
 
 type Assertion struct {
-	Comment                string                        `json:"comment"`
+	Comment                string                        `json:"comment,omitempty"`
 	ExpectedResult         string                        `json:"expected_result"`
-	ActionNames            []string                      `json:"action_names"`
-	ResourceArns           []string                      `json:"resource_arns"`
-	ResourcePolicy         string                        `json:"resource_policy"`
-	ResourceOwner          string                        `json:"resource_owner"`
-	CallerArn              string                        `json:"caller_arn"`
-	ContextEntries         map[string]*ContextEntryValue `json:"context_entries"`
-	ResourceHandlingOption string                        `json:"resource_handling_option"`
+	ActionNames            []string                      `json:"action_names,omitempty"`
+	ResourceArns           []string                      `json:"resource_arns,omitempty"`
+	ResourcePolicy         string                        `json:"resource_policy,omitempty"`
+	ResourceOwner          string                        `json:"resource_owner,omitempty"`
+	CallerArn              string                        `json:"caller_arn,omitempty"`
+	ContextEntries         map[string]*ContextEntryValue `json:"context_entries,omitempty"`
+	ResourceHandlingOption string                        `json:"resource_handling_option,omitempty"`
+	CrossAccount           bool                          `json:"cross_account,omitempty"`
+	Principals             map[string][]string           `json:"principals,omitempty"`
+	ExceptPrincipals       []string                      `json:"except_principals,omitempty"`
+	Matrix                 *Matrix                       `json:"matrix,omitempty"`
+	Tags                   []string                      `json:"tags,omitempty"`
+
+	// MatrixCell holds the coordinates of an assertion expanded from a matrix
+	MatrixCell string `json:"-"`
+	// Location is the position of the assertion within its suite file, when
+	// it was loaded from one
+	Location *Location `json:"-"`
+}
+
+// Location is a 1-based line and column within a file
+type Location struct {
+	File   string
+	Line   int
+	Column int
+}
+
+// Matrix expands an assertion into one assertion per combination of action,
+// resource and named context variant; the expected result of each combination
+// is given by the first matching rule, or else by the assertion's expected_result
+type Matrix struct {
+	ActionNames  []string                                 `json:"action_names,omitempty"`
+	ResourceArns []string                                 `json:"resource_arns,omitempty"`
+	Contexts     map[string]map[string]*ContextEntryValue `json:"contexts,omitempty"`
+	Rules        []*MatrixRule                            `json:"rules,omitempty"`
+}
+
+// MatrixRule maps the matrix combinations it matches to an expected result;
+// an empty dimension matches any value
+type MatrixRule struct {
+	ActionNames    []string `json:"action_names,omitempty"`
+	ResourceArns   []string `json:"resource_arns,omitempty"`
+	Contexts       []string `json:"contexts,omitempty"`
+	ExpectedResult string   `json:"expected_result"`
 }
 
 type ContextEntryValue struct {
-	Type   string   `json:"type"`
+	Type   string   `json:"type,omitempty"`
 	Values []string `json:"values"`
 }
 
 type Inputs struct {
-	Assertions []*Assertion `json:"assertions"`
-	PolicyJSON string       `json:"policy_json"`
-	MaxLength  int          `json:"max_length"`
+	Assertions      []*Assertion      `json:"assertions"`
+	PolicyJSON      string            `json:"policy_json"`
+	MaxLength       int               `json:"max_length"`
+	PrincipalArn    string            `json:"principal_arn"`
+	TrustPolicyJSON string            `json:"trust_policy_json"`
+	Vars            map[string]string `json:"vars"`
 }